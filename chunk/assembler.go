@@ -0,0 +1,138 @@
+package chunk
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TerrexTech/go-eventstore-models/model"
+	"github.com/TerrexTech/uuuid"
+	"github.com/pkg/errors"
+)
+
+// DefaultPendingTTL is how long the parts of a response are kept without
+// receiving another part, if Assembler.PendingTTL is not set.
+const DefaultPendingTTL = 5 * time.Minute
+
+// Assembler reassembles chunked KafkaResponses from their parts, which may
+// be received in any order. It is safe for concurrent use.
+type Assembler struct {
+	// PendingTTL is how long the parts of a response are kept without
+	// receiving another part, after which they are discarded, so responses
+	// whose remaining parts are lost don't accumulate.
+	PendingTTL time.Duration
+
+	lock    sync.Mutex
+	pending map[string]*partial
+	now     func() time.Time
+}
+
+// partial is a response with parts still to be received.
+type partial struct {
+	resp   *model.KafkaResponse
+	chunks []*Chunk
+	count  int
+	// received is when the last part was received
+	received time.Time
+}
+
+// NewAssembler creates an empty Assembler.
+func NewAssembler() *Assembler {
+	return &Assembler{
+		pending: map[string]*partial{},
+		now:     time.Now,
+	}
+}
+
+// Add adds a received response. Returns the reassembled response once all of
+// its parts are added, and nil while parts are missing. Responses which are
+// not chunked are returned as is. Returns an error if the reassembled Result
+// does not match its checksum, in which case its parts are discarded.
+func (a *Assembler) Add(resp *model.KafkaResponse) (*model.KafkaResponse, error) {
+	c, isChunk := Parse(resp)
+	if !isChunk {
+		return resp, nil
+	}
+	if c.Parts < 1 || c.Part < 1 || c.Part > c.Parts {
+		return nil, errors.Errorf("Invalid Chunk-part %d of %d", c.Part, c.Parts)
+	}
+
+	// Responses are identified by their CorrelationID and checksum, so
+	// different responses to a request aren't mixed.
+	key := resp.CorrelationID.String() + "/" + c.Checksum
+
+	a.lock.Lock()
+	now := a.now()
+	a.evict(now)
+	p, exists := a.pending[key]
+	if !exists {
+		p = &partial{
+			resp:   resp,
+			chunks: make([]*Chunk, c.Parts),
+		}
+		a.pending[key] = p
+	}
+	if len(p.chunks) != c.Parts {
+		a.lock.Unlock()
+		return nil, errors.Errorf(
+			"Chunk has %d parts, previous Chunks had %d", c.Parts, len(p.chunks),
+		)
+	}
+	p.received = now
+	// Redelivered parts are ignored
+	if p.chunks[c.Part-1] == nil {
+		p.chunks[c.Part-1] = c
+		p.count++
+	}
+	complete := p.count == len(p.chunks)
+	if complete {
+		delete(a.pending, key)
+	}
+	a.lock.Unlock()
+
+	if !complete {
+		return nil, nil
+	}
+	result, err := decode(p.chunks)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error reassembling CorrelationID %s", resp.CorrelationID)
+	}
+	assembled := *p.resp
+	assembled.Result = result
+	return &assembled, nil
+}
+
+// Pending returns the number of responses with parts still to be received.
+func (a *Assembler) Pending() int {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.evict(a.now())
+	return len(a.pending)
+}
+
+// evict discards the parts of responses which received no part within the
+// PendingTTL. The lock must be held.
+func (a *Assembler) evict(now time.Time) {
+	ttl := a.PendingTTL
+	if ttl <= 0 {
+		ttl = DefaultPendingTTL
+	}
+	for key, p := range a.pending {
+		if now.Sub(p.received) > ttl {
+			delete(a.pending, key)
+		}
+	}
+}
+
+// Discard drops the received parts of all responses with the CorrelationID,
+// such as after a timeout waiting for missing parts.
+func (a *Assembler) Discard(correlationID uuuid.UUID) {
+	prefix := correlationID.String() + "/"
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for key := range a.pending {
+		if strings.HasPrefix(key, prefix) {
+			delete(a.pending, key)
+		}
+	}
+}
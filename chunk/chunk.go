@@ -0,0 +1,164 @@
+// Package chunk splits KafkaResponses with large Results into numbered parts,
+// which fit into Kafka-messages, and reassembles them for consumers.
+//
+// Each part is a KafkaResponse with the CorrelationID, AggregateID and errors
+// of the original response, and a JSON-encoded Chunk as its Result. The
+// Chunk holds a slice of the original Result, which may be compressed, with
+// the number of the part, the total number of parts and the checksum of the
+// original Result.
+package chunk
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/TerrexTech/go-eventstore-models/model"
+	"github.com/pkg/errors"
+)
+
+// Protocol identifies Results that are Chunks.
+const Protocol = "report-chunk/1"
+
+const (
+	// EncodingIdentity is for uncompressed Chunk-data.
+	EncodingIdentity = ""
+	// EncodingGzip is for gzip-compressed Chunk-data.
+	EncodingGzip = "gzip"
+)
+
+// Chunk is a part of the Result of a chunked KafkaResponse.
+type Chunk struct {
+	Protocol string `json:"chunk_protocol"`
+	// Part is the 1-based number of the part.
+	Part int `json:"part"`
+	// Parts is the total number of parts.
+	Parts int `json:"parts"`
+	// Checksum is the hex-encoded SHA-256 of the original, uncompressed,
+	// Result.
+	Checksum string `json:"checksum"`
+	// Encoding is the encoding of the data of all parts, such as EncodingGzip.
+	Encoding string `json:"encoding,omitempty"`
+	Data     []byte `json:"data"`
+}
+
+// PartSize returns the largest part-size of which the chunked responses fit
+// into Kafka-messages of maxMessageBytes. Chunk-data is base64-encoded in the
+// Chunk, which is base64-encoded again in the KafkaResponse.
+func PartSize(maxMessageBytes int) int {
+	// Space for the KafkaResponse and Chunk fields
+	const overhead = 1024
+	size := (maxMessageBytes - overhead) * 9 / 16
+	if size < 1 {
+		return 1
+	}
+	return size
+}
+
+// Split splits the response into parts whose Chunk-data is at most partSize
+// bytes. Responses are returned as is if their Result fits into one part
+// and compress is not set. If compress is set, the Result is gzip-compressed
+// before splitting, and a single Chunk is produced even if it fits.
+func Split(resp *model.KafkaResponse, partSize int, compress bool) ([]*model.KafkaResponse, error) {
+	if partSize < 1 {
+		return nil, errors.New("Part-size must be positive")
+	}
+	if !compress && len(resp.Result) <= partSize {
+		return []*model.KafkaResponse{resp}, nil
+	}
+
+	sum := sha256.Sum256(resp.Result)
+	checksum := hex.EncodeToString(sum[:])
+
+	data := resp.Result
+	encoding := EncodingIdentity
+	if compress {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		_, err := gz.Write(resp.Result)
+		if err == nil {
+			err = gz.Close()
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "Error compressing Result")
+		}
+		data = buf.Bytes()
+		encoding = EncodingGzip
+	}
+
+	parts := (len(data) + partSize - 1) / partSize
+	if parts == 0 {
+		parts = 1
+	}
+	chunks := make([]*model.KafkaResponse, parts)
+	for i := range chunks {
+		end := (i + 1) * partSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunkJSON, err := json.Marshal(Chunk{
+			Protocol: Protocol,
+			Part:     i + 1,
+			Parts:    parts,
+			Checksum: checksum,
+			Encoding: encoding,
+			Data:     data[i*partSize : end],
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "Error marshalling Chunk")
+		}
+
+		part := *resp
+		part.Result = chunkJSON
+		chunks[i] = &part
+	}
+	return chunks, nil
+}
+
+// Parse returns the Chunk of the response, or false if its Result is not a
+// Chunk.
+func Parse(resp *model.KafkaResponse) (*Chunk, bool) {
+	if !bytes.Contains(resp.Result, []byte(Protocol)) {
+		return nil, false
+	}
+	c := &Chunk{}
+	err := json.Unmarshal(resp.Result, c)
+	if err != nil || c.Protocol != Protocol {
+		return nil, false
+	}
+	return c, true
+}
+
+// decode joins the data of the ordered Chunks, decompresses it, and verifies
+// it against the checksum.
+func decode(chunks []*Chunk) ([]byte, error) {
+	var data []byte
+	for _, c := range chunks {
+		data = append(data, c.Data...)
+	}
+
+	first := chunks[0]
+	switch first.Encoding {
+	case EncodingIdentity:
+	case EncodingGzip:
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, errors.Wrap(err, "Error decompressing Result")
+		}
+		data, err = ioutil.ReadAll(gz)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error decompressing Result")
+		}
+	default:
+		return nil, errors.Errorf("Unknown Chunk-encoding: %s", first.Encoding)
+	}
+
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != first.Checksum {
+		return nil, errors.New("Checksum mismatch of reassembled Result")
+	}
+	return data, nil
+}
@@ -0,0 +1,13 @@
+package chunk
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestChunk(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Chunk Suite")
+}
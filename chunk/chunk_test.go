@@ -0,0 +1,178 @@
+package chunk
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/TerrexTech/go-eventstore-models/model"
+	"github.com/TerrexTech/uuuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Chunk", func() {
+	var resp *model.KafkaResponse
+
+	BeforeEach(func() {
+		correlationID, err := uuuid.NewV4()
+		Expect(err).ToNot(HaveOccurred())
+		resp = &model.KafkaResponse{
+			AggregateID:   4,
+			CorrelationID: correlationID,
+			Result:        bytes.Repeat([]byte(`{"item":"apple"},`), 100),
+		}
+	})
+
+	It("should return responses that fit as is", func() {
+		parts, err := Split(resp, len(resp.Result), false)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(parts).To(HaveLen(1))
+		Expect(parts[0]).To(Equal(resp))
+
+		_, isChunk := Parse(parts[0])
+		Expect(isChunk).To(BeFalse())
+	})
+
+	It("should split responses into numbered parts", func() {
+		parts, err := Split(resp, 500, false)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(parts).To(HaveLen(4))
+
+		for i, part := range parts {
+			Expect(part.CorrelationID).To(Equal(resp.CorrelationID))
+			Expect(part.AggregateID).To(Equal(resp.AggregateID))
+
+			c, isChunk := Parse(part)
+			Expect(isChunk).To(BeTrue())
+			Expect(c.Part).To(Equal(i + 1))
+			Expect(c.Parts).To(Equal(4))
+			Expect(len(c.Data)).To(BeNumerically("<=", 500))
+		}
+	})
+
+	It("should reassemble parts in any order", func() {
+		parts, err := Split(resp, 300, false)
+		Expect(err).ToNot(HaveOccurred())
+
+		assembler := NewAssembler()
+		var assembled *model.KafkaResponse
+		for i := len(parts) - 1; i >= 0; i-- {
+			Expect(assembled).To(BeNil())
+			assembled, err = assembler.Add(parts[i])
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(assembled).ToNot(BeNil())
+		Expect(assembled.Result).To(Equal(resp.Result))
+		Expect(assembled.CorrelationID).To(Equal(resp.CorrelationID))
+		Expect(assembler.Pending()).To(Equal(0))
+	})
+
+	It("should ignore redelivered parts", func() {
+		parts, err := Split(resp, 300, false)
+		Expect(err).ToNot(HaveOccurred())
+
+		assembler := NewAssembler()
+		assembled, err := assembler.Add(parts[0])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(assembled).To(BeNil())
+		assembled, err = assembler.Add(parts[0])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(assembled).To(BeNil())
+
+		for _, part := range parts[1:] {
+			assembled, err = assembler.Add(part)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(assembled.Result).To(Equal(resp.Result))
+	})
+
+	It("should compress parts", func() {
+		parts, err := Split(resp, 10000, true)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(parts).To(HaveLen(1))
+
+		c, isChunk := Parse(parts[0])
+		Expect(isChunk).To(BeTrue())
+		Expect(c.Encoding).To(Equal(EncodingGzip))
+		Expect(len(c.Data)).To(BeNumerically("<", len(resp.Result)))
+
+		assembled, err := NewAssembler().Add(parts[0])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(assembled.Result).To(Equal(resp.Result))
+	})
+
+	It("should return an error if the checksum mismatches", func() {
+		parts, err := Split(resp, 1000, false)
+		Expect(err).ToNot(HaveOccurred())
+
+		c, _ := Parse(parts[1])
+		c.Data[0] = 'x'
+		parts[1].Result, err = json.Marshal(c)
+		Expect(err).ToNot(HaveOccurred())
+
+		assembler := NewAssembler()
+		_, err = assembler.Add(parts[0])
+		Expect(err).ToNot(HaveOccurred())
+		_, err = assembler.Add(parts[1])
+		Expect(err).To(HaveOccurred())
+		Expect(assembler.Pending()).To(Equal(0))
+	})
+
+	It("should discard pending parts", func() {
+		parts, err := Split(resp, 300, false)
+		Expect(err).ToNot(HaveOccurred())
+
+		assembler := NewAssembler()
+		_, err = assembler.Add(parts[0])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(assembler.Pending()).To(Equal(1))
+
+		assembler.Discard(resp.CorrelationID)
+		Expect(assembler.Pending()).To(Equal(0))
+	})
+
+	It("should discard parts pending longer than the PendingTTL", func() {
+		parts, err := Split(resp, 300, false)
+		Expect(err).ToNot(HaveOccurred())
+
+		now := time.Now()
+		assembler := NewAssembler()
+		assembler.PendingTTL = time.Minute
+		assembler.now = func() time.Time {
+			return now
+		}
+		_, err = assembler.Add(parts[0])
+		Expect(err).ToNot(HaveOccurred())
+
+		// Receiving another part keeps the response pending
+		now = now.Add(50 * time.Second)
+		_, err = assembler.Add(parts[1])
+		Expect(err).ToNot(HaveOccurred())
+		now = now.Add(50 * time.Second)
+		Expect(assembler.Pending()).To(Equal(1))
+
+		now = now.Add(20 * time.Second)
+		Expect(assembler.Pending()).To(Equal(0))
+
+		// Late parts start the response over
+		assembled, err := assembler.Add(parts[2])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(assembled).To(BeNil())
+		Expect(assembler.Pending()).To(Equal(1))
+	})
+
+	It("should fit chunked responses into the max message-bytes", func() {
+		resp.Result = bytes.Repeat([]byte{0xff}, 50000)
+		maxBytes := 8000
+		parts, err := Split(resp, PartSize(maxBytes), false)
+		Expect(err).ToNot(HaveOccurred())
+
+		for _, part := range parts {
+			partJSON, err := json.Marshal(part)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(partJSON)).To(BeNumerically("<=", maxBytes))
+		}
+		Expect(PartSize(10)).To(Equal(1))
+	})
+})
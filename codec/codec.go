@@ -0,0 +1,90 @@
+// Package codec encodes report-results as JSON, CSV or Protobuf. Encoders are
+// registered by name, so requests can select the encoding of their results.
+//
+// CSV and Protobuf encode results by reflection over their JSON-fields, so any
+// report-result of structs, or slices of structs, can be encoded. The Protobuf
+// schema of results is generated by ProtoSchema.
+package codec
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Names of the default encoders.
+const (
+	NameJSON     = "json"
+	NameCSV      = "csv"
+	NameProtobuf = "protobuf"
+)
+
+// ErrUnknownEncoding is the cause of errors from looking up encoders that
+// are not registered.
+var ErrUnknownEncoding = errors.New("Unknown encoding")
+
+// Encoder encodes report-results.
+type Encoder interface {
+	// ContentType is the MIME-type of the encoded results.
+	ContentType() string
+	Encode(v interface{}) ([]byte, error)
+}
+
+var (
+	encodersLock sync.RWMutex
+	encoders     = map[string]Encoder{
+		NameJSON:     JSON{},
+		NameCSV:      CSV{},
+		NameProtobuf: Protobuf{},
+	}
+)
+
+// Register registers the encoder as name, replacing any encoder registered
+// as name before.
+func Register(name string, encoder Encoder) {
+	encodersLock.Lock()
+	defer encodersLock.Unlock()
+	encoders[name] = encoder
+}
+
+// Lookup returns the encoder registered as name. An empty name returns the
+// JSON encoder.
+func Lookup(name string) (Encoder, error) {
+	if name == "" {
+		name = NameJSON
+	}
+	encodersLock.RLock()
+	defer encodersLock.RUnlock()
+	encoder, exists := encoders[name]
+	if !exists {
+		return nil, errors.Wrapf(ErrUnknownEncoding, "Encoding %s", name)
+	}
+	return encoder, nil
+}
+
+// Names returns the sorted names of the registered encoders.
+func Names() []string {
+	encodersLock.RLock()
+	defer encodersLock.RUnlock()
+	names := make([]string, 0, len(encoders))
+	for name := range encoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// JSON encodes results with encoding/json.
+type JSON struct{}
+
+// ContentType is "application/json".
+func (JSON) ContentType() string {
+	return "application/json"
+}
+
+// Encode encodes v as JSON.
+func (JSON) Encode(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
@@ -0,0 +1,82 @@
+package codec
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+// testPeriod and testItem are report-results for the encoder specs.
+type testPeriod struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+type testItem struct {
+	SKU      int64       `json:"sku"`
+	Name     string      `json:"name,omitempty"`
+	Weight   float64     `json:"weight"`
+	DeltaPct *float64    `json:"delta_pct,omitempty"`
+	Key      interface{} `json:"key"`
+	Period   testPeriod  `json:"period"`
+	Values   []float64   `json:"values,omitempty"`
+	internal string
+}
+
+type testReport struct {
+	Period testPeriod `json:"period"`
+	Items  []testItem `json:"items"`
+}
+
+// testRow is a testItem with the period of its testReport.
+type testRow struct {
+	ReportStart int64 `json:"report_start"`
+	testItem
+}
+
+func (r *testReport) Rows() interface{} {
+	rows := []testRow{}
+	for _, item := range r.Items {
+		rows = append(rows, testRow{
+			ReportStart: r.Period.Start,
+			testItem:    item,
+		})
+	}
+	return rows
+}
+
+var _ = Describe("Registry", func() {
+	It("should return the JSON encoder by default", func() {
+		encoder, err := Lookup("")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(encoder).To(Equal(JSON{}))
+
+		result, err := encoder.Encode([]testPeriod{{Start: 1, End: 2}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(result)).To(Equal(`[{"start":1,"end":2}]`))
+	})
+
+	It("should return the default encoders", func() {
+		Expect(Names()).To(ContainElement(NameJSON))
+		Expect(Names()).To(ContainElement(NameCSV))
+		Expect(Names()).To(ContainElement(NameProtobuf))
+
+		encoder, err := Lookup(NameCSV)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(encoder.ContentType()).To(Equal("text/csv"))
+	})
+
+	It("should return an error for unknown encodings", func() {
+		_, err := Lookup("xml")
+		Expect(err).To(HaveOccurred())
+		Expect(errors.Cause(err)).To(Equal(ErrUnknownEncoding))
+	})
+
+	It("should return registered encoders", func() {
+		Register("csv-test", CSV{})
+		encoder, err := Lookup("csv-test")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(encoder).To(Equal(CSV{}))
+		Expect(Names()).To(ContainElement("csv-test"))
+	})
+})
@@ -0,0 +1,77 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Rower is implemented by results that are not a slice of rows, to return
+// their rows for tabular encodings such as CSV.
+type Rower interface {
+	Rows() interface{}
+}
+
+// CSV encodes results as CSV with a header, with the rows and columns of
+// their Table.
+type CSV struct{}
+
+// ContentType is "text/csv".
+func (CSV) ContentType() string {
+	return "text/csv"
+}
+
+// Encode encodes v as CSV.
+func (CSV) Encode(v interface{}) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	table, err := Tabulate(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	record := make([]string, len(table.Columns))
+	for i, c := range table.Columns {
+		record[i] = c.Name
+	}
+	err = w.Write(record)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error writing CSV-header")
+	}
+
+	for _, row := range table.Rows {
+		for i, cell := range row {
+			record[i] = FormatCell(cell, -1)
+		}
+		err = w.Write(record)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error writing CSV-row")
+		}
+	}
+	w.Flush()
+	if err = w.Error(); err != nil {
+		return nil, errors.Wrap(err, "Error writing CSV")
+	}
+	return buf.Bytes(), nil
+}
+
+// FormatCell returns the text of the Table-cell. Floats are formatted with
+// precision decimals, or as few as needed if precision is negative.
+func FormatCell(cell interface{}, precision int) string {
+	switch value := cell.(type) {
+	case string:
+		return value
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case float64:
+		return strconv.FormatFloat(value, 'f', precision, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	}
+	return ""
+}
@@ -0,0 +1,57 @@
+package codec
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CSV", func() {
+	It("should encode slices as rows with a header", func() {
+		delta := 12.5
+		result, err := CSV{}.Encode([]testItem{
+			{
+				SKU:      3,
+				Name:     "Apples, red",
+				Weight:   10.25,
+				DeltaPct: &delta,
+				Key:      "apples",
+				Period:   testPeriod{Start: 100, End: 200},
+				Values:   []float64{1, 2},
+			},
+			{
+				SKU: 4,
+				Key: 40,
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(result)).To(Equal(
+			"sku,name,weight,delta_pct,key,period.start,period.end,values\n" +
+				`3,"Apples, red",10.25,12.5,apples,100,200,"[1,2]"` + "\n" +
+				"4,,0,,40,0,0,\n",
+		))
+	})
+
+	It("should encode only the header of empty slices", func() {
+		result, err := CSV{}.Encode([]testPeriod(nil))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(result)).To(Equal("start,end\n"))
+	})
+
+	It("should encode structs as a single row", func() {
+		result, err := CSV{}.Encode(&testPeriod{Start: 1, End: 2})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(result)).To(Equal("start,end\n1,2\n"))
+	})
+
+	It("should encode the rows of Rowers", func() {
+		result, err := CSV{}.Encode(&testReport{
+			Period: testPeriod{Start: 100},
+			Items:  []testItem{{SKU: 3}},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(result)).To(Equal(
+			"report_start,sku,name,weight,delta_pct,key,period.start,period.end,values\n" +
+				"100,3,,0,,,0,0,\n",
+		))
+	})
+})
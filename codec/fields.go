@@ -0,0 +1,180 @@
+package codec
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// field is an encoded struct-field.
+type field struct {
+	// name is the JSON-name of the field.
+	name      string
+	index     []int
+	typ       reflect.Type
+	omitEmpty bool
+	// num is the Protobuf field-number of the proto-tag, or 0 if untagged.
+	num int
+}
+
+// structFields returns the encoded fields of the struct-type in order, as
+// encoding/json would: unexported fields and fields tagged "-" are skipped,
+// and the fields of embedded structs are inlined.
+func structFields(t reflect.Type) []field {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if comma := strings.Index(tag, ","); comma >= 0 {
+			name, opts = tag[:comma], tag[comma+1:]
+		}
+
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+			for _, f := range structFields(sf.Type) {
+				f.index = append([]int{i}, f.index...)
+				fields = append(fields, f)
+			}
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		num, _ := strconv.Atoi(sf.Tag.Get("proto"))
+		fields = append(fields, field{
+			name:      name,
+			index:     []int{i},
+			typ:       sf.Type,
+			omitEmpty: strings.Contains(","+opts+",", ",omitempty,"),
+			num:       num,
+		})
+	}
+	return fields
+}
+
+// protoFields returns the encoded fields of the struct-type with their
+// Protobuf field-numbers. The numbers are the proto-tags of the fields, such
+// as `proto:"3"`, so reordering fields keeps the encoding compatible. Fields
+// of untagged structs are numbered in order from 1.
+func protoFields(t reflect.Type) ([]field, error) {
+	fields := structFields(t)
+	tagged := false
+	for _, f := range fields {
+		if f.num != 0 {
+			tagged = true
+			break
+		}
+	}
+	if !tagged {
+		for i := range fields {
+			fields[i].num = i + 1
+		}
+		return fields, nil
+	}
+
+	nums := map[int]string{}
+	for _, f := range fields {
+		if f.num <= 0 {
+			return nil, errors.Errorf("Field %s of %s has no valid proto-tag", f.name, t)
+		}
+		if prev, exists := nums[f.num]; exists {
+			return nil, errors.Errorf(
+				"Fields %s and %s of %s have proto-tag %d", prev, f.name, t, f.num,
+			)
+		}
+		nums[f.num] = f.name
+	}
+	return fields, nil
+}
+
+// isRecord returns whether values of the type are encoded as records of
+// their fields, rather than as scalars.
+func isRecord(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	return !t.Implements(textMarshalerType) &&
+		!reflect.PtrTo(t).Implements(textMarshalerType)
+}
+
+// indirect dereferences pointers and interfaces, and returns whether the
+// value is non-nil.
+func indirect(v reflect.Value) (reflect.Value, bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return v, false
+		}
+		v = v.Elem()
+	}
+	return v, v.IsValid()
+}
+
+// isEmpty returns whether the value is empty as per the omitempty option of
+// encoding/json.
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// scalarText returns the text of a scalar value. Strings are returned as
+// is, TextMarshalers as their text, and other values, such as slices, as
+// their JSON.
+func scalarText(v reflect.Value) (string, error) {
+	if v.CanInterface() {
+		if tm, ok := v.Interface().(encoding.TextMarshaler); ok {
+			text, err := tm.MarshalText()
+			return string(text), err
+		}
+	}
+	v, ok := indirect(v)
+	if !ok {
+		return "", nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), nil
+	}
+	if tm, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, err := tm.MarshalText()
+		return string(text), err
+	}
+	data, err := json.Marshal(v.Interface())
+	return string(data), err
+}
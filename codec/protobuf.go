@@ -0,0 +1,231 @@
+package codec
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// Protobuf wire-types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+// Protobuf encodes results in the Protobuf wire-format, as per the schema
+// generated by ProtoSchema. Structs are messages whose fields are numbered
+// by their proto-tags, or in order from 1 if untagged, and slice-results
+// are a list-message with the elements as its repeated field 1.
+type Protobuf struct{}
+
+// ContentType is "application/x-protobuf".
+func (Protobuf) ContentType() string {
+	return "application/x-protobuf"
+}
+
+// Encode encodes v as a Protobuf message.
+func (Protobuf) Encode(v interface{}) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice {
+		if !isRecord(rv.Type().Elem()) {
+			return nil, errors.Errorf("Cannot encode %s as a Protobuf list", rv.Type())
+		}
+		return appendField(nil, 1, rv)
+	}
+
+	if !isRecord(rv.Type()) {
+		return nil, errors.Errorf("Cannot encode %s as a Protobuf message", rv.Type())
+	}
+	rv, ok := indirect(rv)
+	if !ok {
+		return nil, nil
+	}
+	return appendMessage(nil, rv)
+}
+
+// appendMessage appends the fields of the struct-value.
+func appendMessage(buf []byte, v reflect.Value) ([]byte, error) {
+	fields, err := protoFields(v.Type())
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fields {
+		buf, err = appendField(buf, f.num, v.FieldByIndex(f.index))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error encoding field %s", f.name)
+		}
+	}
+	return buf, nil
+}
+
+// appendField appends the field-value as field num. Scalars with their zero
+// value are omitted, unless they are pointers, which are optional fields.
+func appendField(buf []byte, num int, v reflect.Value) ([]byte, error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return buf, nil
+		}
+		if !isRecord(v.Type()) && v.Type().Elem().Kind() != reflect.Interface {
+			return appendScalar(buf, num, v.Elem(), true)
+		}
+	}
+
+	if isRecord(v.Type()) {
+		v, ok := indirect(v)
+		if !ok {
+			return buf, nil
+		}
+		msg, err := appendMessage(nil, v)
+		if err != nil {
+			return nil, err
+		}
+		return appendBytes(buf, num, msg), nil
+	}
+
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		return appendRepeated(buf, num, v)
+	}
+	return appendScalar(buf, num, v, false)
+}
+
+// appendRepeated appends the elements of the slice as a repeated field.
+// Numeric elements are packed.
+func appendRepeated(buf []byte, num int, v reflect.Value) ([]byte, error) {
+	if v.Len() == 0 {
+		return buf, nil
+	}
+	elemType := v.Type().Elem()
+	if wireType(elemType) == wireBytes {
+		var err error
+		for i := 0; i < v.Len(); i++ {
+			buf, err = appendElement(buf, num, v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	}
+
+	var packed []byte
+	for i := 0; i < v.Len(); i++ {
+		packed = appendNumber(packed, v.Index(i))
+	}
+	return appendBytes(buf, num, packed), nil
+}
+
+// appendElement appends an element of a repeated field, which, unlike
+// fields, is appended even if it is empty.
+func appendElement(buf []byte, num int, v reflect.Value) ([]byte, error) {
+	if isRecord(v.Type()) {
+		msg := []byte{}
+		if v, ok := indirect(v); ok {
+			var err error
+			msg, err = appendMessage(nil, v)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return appendBytes(buf, num, msg), nil
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+		return appendBytes(buf, num, v.Bytes()), nil
+	}
+	text, err := scalarText(v)
+	if err != nil {
+		return nil, err
+	}
+	return appendBytes(buf, num, []byte(text)), nil
+}
+
+// appendScalar appends the scalar-value, which is omitted if it is the zero
+// value and present is not set.
+func appendScalar(buf []byte, num int, v reflect.Value, present bool) ([]byte, error) {
+	if !present && isZero(v) {
+		return buf, nil
+	}
+	switch wireType(v.Type()) {
+	case wireVarint:
+		buf = appendKey(buf, num, wireVarint)
+		return appendNumber(buf, v), nil
+	case wireFixed64:
+		buf = appendKey(buf, num, wireFixed64)
+		return appendNumber(buf, v), nil
+	}
+
+	if v.Kind() == reflect.Slice {
+		return appendBytes(buf, num, v.Bytes()), nil
+	}
+	text, err := scalarText(v)
+	if err != nil {
+		return nil, err
+	}
+	return appendBytes(buf, num, []byte(text)), nil
+}
+
+// isZero returns whether the scalar-value is its zero value.
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Struct, reflect.Array:
+		return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+	}
+	return isEmpty(v)
+}
+
+// wireType returns the wire-type of values of the type. TextMarshalers are
+// encoded as their text.
+func wireType(t reflect.Type) int {
+	if t.Implements(textMarshalerType) {
+		return wireBytes
+	}
+	switch t.Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return wireVarint
+	case reflect.Float32, reflect.Float64:
+		return wireFixed64
+	}
+	return wireBytes
+}
+
+// appendNumber appends the value of a varint or fixed64 type, without key.
+func appendNumber(buf []byte, v reflect.Value) []byte {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return appendVarint(buf, 1)
+		}
+		return appendVarint(buf, 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendVarint(buf, uint64(v.Int()))
+	case reflect.Float32, reflect.Float64:
+		var fixed [8]byte
+		binary.LittleEndian.PutUint64(fixed[:], math.Float64bits(v.Float()))
+		return append(buf, fixed[:]...)
+	}
+	return appendVarint(buf, v.Uint())
+}
+
+func appendKey(buf []byte, num int, wire int) []byte {
+	return appendVarint(buf, uint64(num)<<3|uint64(wire))
+}
+
+func appendBytes(buf []byte, num int, data []byte) []byte {
+	buf = appendKey(buf, num, wireBytes)
+	buf = appendVarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+func appendVarint(buf []byte, x uint64) []byte {
+	for x >= 0x80 {
+		buf = append(buf, byte(x)|0x80)
+		x >>= 7
+	}
+	return append(buf, byte(x))
+}
@@ -0,0 +1,158 @@
+package codec
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Protobuf", func() {
+	It("should encode structs as messages", func() {
+		result, err := Protobuf{}.Encode(&testPeriod{Start: 150, End: -1})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result).To(Equal([]byte{
+			0x08, 0x96, 0x01,
+			0x10, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01,
+		}))
+	})
+
+	It("should encode fields by their type", func() {
+		zero := 0.0
+		result, err := Protobuf{}.Encode(testItem{
+			SKU:      1,
+			Name:     "a",
+			Weight:   1,
+			DeltaPct: &zero,
+			Key:      2,
+			Period:   testPeriod{End: 1},
+			Values:   []float64{0.5},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result).To(Equal([]byte{
+			// sku
+			0x08, 0x01,
+			// name
+			0x12, 0x01, 'a',
+			// weight
+			0x19, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f,
+			// delta_pct, which is present though zero
+			0x21, 0, 0, 0, 0, 0, 0, 0, 0,
+			// key
+			0x2a, 0x01, '2',
+			// period
+			0x32, 0x02, 0x10, 0x01,
+			// values, packed
+			0x3a, 0x08, 0, 0, 0, 0, 0, 0, 0xe0, 0x3f,
+		}))
+	})
+
+	It("should omit zero fields", func() {
+		result, err := Protobuf{}.Encode(testItem{})
+		Expect(err).ToNot(HaveOccurred())
+		// Only the period-message is present
+		Expect(result).To(Equal([]byte{0x32, 0x00}))
+	})
+
+	It("should encode slices as list-messages", func() {
+		result, err := Protobuf{}.Encode([]testPeriod{{Start: 1}, {}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result).To(Equal([]byte{
+			0x0a, 0x02, 0x08, 0x01,
+			0x0a, 0x00,
+		}))
+	})
+
+	It("should return an error for scalar results", func() {
+		_, err := Protobuf{}.Encode([]string{"a"})
+		Expect(err).To(HaveOccurred())
+		_, err = Protobuf{}.Encode(4)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should generate the schema of results", func() {
+		schema, err := ProtoSchema("test", map[string]interface{}{
+			"items":  []testItem{},
+			"report": &testReport{},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(schema)).To(Equal(`// Code generated by -proto-schema. DO NOT EDIT.
+
+syntax = "proto3";
+
+package test;
+
+// The result-messages of the report-types:
+//   items: testItemList
+//   report: testReport
+
+message testItem {
+  int64 sku = 1;
+  string name = 2;
+  double weight = 3;
+  optional double delta_pct = 4;
+  string key = 5;
+  testPeriod period = 6;
+  repeated double values = 7;
+}
+
+message testItemList {
+  repeated testItem items = 1;
+}
+
+message testPeriod {
+  int64 start = 1;
+  int64 end = 2;
+}
+
+message testReport {
+  testPeriod period = 1;
+  repeated testItem items = 2;
+}
+`))
+	})
+
+	It("should number fields by their proto-tags", func() {
+		type testTagged struct {
+			End   int64 `json:"end" proto:"4"`
+			Start int64 `json:"start" proto:"2"`
+		}
+		result, err := Protobuf{}.Encode(testTagged{Start: 1, End: 2})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result).To(Equal([]byte{0x20, 0x02, 0x10, 0x01}))
+
+		schema, err := ProtoSchema("test", map[string]interface{}{
+			"tagged": testTagged{},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(schema)).To(ContainSubstring(`message testTagged {
+  int64 end = 4;
+  int64 start = 2;
+}`))
+	})
+
+	It("should return an error for missing or duplicate proto-tags", func() {
+		type testUntagged struct {
+			Start int64 `json:"start" proto:"1"`
+			End   int64 `json:"end"`
+		}
+		_, err := Protobuf{}.Encode(testUntagged{})
+		Expect(err).To(HaveOccurred())
+
+		type testDuplicate struct {
+			Start int64 `json:"start" proto:"1"`
+			End   int64 `json:"end" proto:"1"`
+		}
+		_, err = ProtoSchema("test", map[string]interface{}{
+			"duplicate": testDuplicate{},
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should return an error for conflicting message-names", func() {
+		type testPeriodList struct{}
+		_, err := ProtoSchema("test", map[string]interface{}{
+			"periods": []testPeriod{},
+			"list":    testPeriodList{},
+		})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,172 @@
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// protoSchema collects the message-definitions of a Protobuf schema.
+type protoSchema struct {
+	types map[string]reflect.Type
+	defs  map[string]string
+}
+
+// ProtoSchema generates the proto3 schema of the Protobuf-encoded results,
+// which are keyed by their report-type, in package pkg. The results are
+// values of the result-types, such as their zero values. Slice-results are
+// list-messages named "<element>List".
+func ProtoSchema(pkg string, results map[string]interface{}) ([]byte, error) {
+	s := &protoSchema{
+		types: map[string]reflect.Type{},
+		defs:  map[string]string{},
+	}
+
+	reportTypes := make([]string, 0, len(results))
+	for reportType := range results {
+		reportTypes = append(reportTypes, reportType)
+	}
+	sort.Strings(reportTypes)
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by -proto-schema. DO NOT EDIT.\n\n")
+	buf.WriteString("syntax = \"proto3\";\n\n")
+	fmt.Fprintf(&buf, "package %s;\n\n", pkg)
+	buf.WriteString("// The result-messages of the report-types:\n")
+	for _, reportType := range reportTypes {
+		name, err := s.result(reflect.TypeOf(results[reportType]))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error generating schema of %s", reportType)
+		}
+		fmt.Fprintf(&buf, "//   %s: %s\n", reportType, name)
+	}
+
+	names := make([]string, 0, len(s.defs))
+	for name := range s.defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		buf.WriteString("\n")
+		buf.WriteString(s.defs[name])
+	}
+	return buf.Bytes(), nil
+}
+
+// result adds the message of the result-type, and returns its name.
+func (s *protoSchema) result(t reflect.Type) (string, error) {
+	if t == nil {
+		return "", errors.New("Result must not be nil")
+	}
+	if t.Kind() != reflect.Slice {
+		if !isRecord(t) {
+			return "", errors.Errorf("Cannot encode %s as a Protobuf message", t)
+		}
+		return s.message(t)
+	}
+
+	if !isRecord(t.Elem()) {
+		return "", errors.Errorf("Cannot encode %s as a Protobuf list", t)
+	}
+	elemName, err := s.message(t.Elem())
+	if err != nil {
+		return "", err
+	}
+	name := elemName + "List"
+	err = s.add(name, t)
+	if err != nil || s.defs[name] != "" {
+		return name, err
+	}
+	s.defs[name] = fmt.Sprintf("message %s {\n  repeated %s items = 1;\n}\n", name, elemName)
+	return name, nil
+}
+
+// add reserves the message-name for the type. Returns an error if the name
+// is taken by another type.
+func (s *protoSchema) add(name string, t reflect.Type) error {
+	if prev, exists := s.types[name]; exists && prev != t {
+		return errors.Errorf("Message %s is both %s and %s", name, prev, t)
+	}
+	s.types[name] = t
+	return nil
+}
+
+// message adds the message of the struct-type, and the messages of its
+// fields, and returns its name.
+func (s *protoSchema) message(t reflect.Type) (string, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	name := t.Name()
+	if name == "" {
+		return "", errors.Errorf("Cannot name message of anonymous %s", t)
+	}
+	_, exists := s.types[name]
+	err := s.add(name, t)
+	if err != nil || exists {
+		return name, err
+	}
+
+	fields, err := protoFields(t)
+	if err != nil {
+		return "", err
+	}
+	var def bytes.Buffer
+	fmt.Fprintf(&def, "message %s {\n", name)
+	for _, f := range fields {
+		typ, err := s.fieldType(f.typ)
+		if err != nil {
+			return "", errors.Wrapf(err, "Error generating field %s.%s", name, f.name)
+		}
+		fmt.Fprintf(&def, "  %s %s = %d;\n", typ, f.name, f.num)
+	}
+	def.WriteString("}\n")
+	s.defs[name] = def.String()
+	return name, nil
+}
+
+// fieldType returns the Protobuf-type of fields of the type, as encoded by
+// appendField.
+func (s *protoSchema) fieldType(t reflect.Type) (string, error) {
+	if isRecord(t) {
+		return s.message(t)
+	}
+	if t.Kind() == reflect.Ptr && t.Elem().Kind() != reflect.Interface {
+		return "optional " + scalarType(t.Elem()), nil
+	}
+	if t.Kind() != reflect.Slice || t.Elem().Kind() == reflect.Uint8 {
+		return scalarType(t), nil
+	}
+
+	if isRecord(t.Elem()) {
+		name, err := s.message(t.Elem())
+		return "repeated " + name, err
+	}
+	return "repeated " + scalarType(t.Elem()), nil
+}
+
+// scalarType returns the Protobuf-type of scalars of the type, as encoded
+// by appendScalar. Values without a Protobuf-type are strings of their text.
+func scalarType(t reflect.Type) string {
+	if t.Implements(textMarshalerType) {
+		return "string"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "int64"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "uint64"
+	case reflect.Float32, reflect.Float64:
+		return "double"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "bytes"
+		}
+	}
+	return "string"
+}
@@ -0,0 +1,205 @@
+package codec
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Kinds of Table-columns.
+const (
+	KindString = "string"
+	KindInt    = "int"
+	KindFloat  = "float"
+	KindBool   = "bool"
+)
+
+// Column is a column of a Table.
+type Column struct {
+	Name string
+	// Kind is the kind of the column's cells, such as KindFloat.
+	Kind string
+}
+
+// Table is a result as rows of cells, as encoded by CSV. Cells are nil,
+// or a string, int64, float64 or bool as per the Kind of their column.
+type Table struct {
+	Columns []Column
+	Rows    [][]interface{}
+}
+
+// tableColumn is a Table-column, with the path of field-indices to its
+// value.
+type tableColumn struct {
+	Column
+	path      [][]int
+	omitEmpty bool
+}
+
+// Tabulate converts the result to a Table. Each element of slice-results is
+// a row, and other results are a single row, unless they are Rowers. The
+// fields of nested structs are flattened into columns named
+// "<field>.<nested-field>", while nested slices and maps are JSON-encoded
+// strings. Nil and omitted-empty values are nil cells.
+func Tabulate(v interface{}) (*Table, error) {
+	if rower, ok := v.(Rower); ok {
+		v = rower.Rows()
+	}
+	if v == nil {
+		return &Table{}, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	rowType := rv.Type()
+	rows := []reflect.Value{rv}
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		rowType = rowType.Elem()
+		rows = make([]reflect.Value, rv.Len())
+		for i := range rows {
+			rows[i] = rv.Index(i)
+		}
+	}
+
+	columns := []tableColumn{{
+		Column: Column{Name: "value", Kind: cellKind(rowType)},
+	}}
+	if isRecord(rowType) {
+		columns = tableColumns(rowType, "", nil)
+	}
+
+	table := &Table{
+		Columns: make([]Column, len(columns)),
+		Rows:    make([][]interface{}, len(rows)),
+	}
+	for i, c := range columns {
+		table.Columns[i] = c.Column
+	}
+	for i, row := range rows {
+		cells := make([]interface{}, len(columns))
+		for j, c := range columns {
+			cell, err := c.cell(row)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Error encoding column %s", c.Name)
+			}
+			cells[j] = cell
+		}
+		table.Rows[i] = cells
+	}
+	return table, nil
+}
+
+// Select returns the Table with only the named columns, in their order.
+// Returns an error if a column does not exist.
+func (t *Table) Select(names []string) (*Table, error) {
+	indices := map[string]int{}
+	for i, c := range t.Columns {
+		indices[c.Name] = i
+	}
+
+	selected := &Table{
+		Columns: make([]Column, len(names)),
+		Rows:    make([][]interface{}, len(t.Rows)),
+	}
+	var unknown []string
+	for i, name := range names {
+		index, exists := indices[name]
+		if !exists {
+			unknown = append(unknown, name)
+			continue
+		}
+		selected.Columns[i] = t.Columns[index]
+	}
+	if len(unknown) > 0 {
+		return nil, errors.Errorf("Unknown columns: %s", strings.Join(unknown, ", "))
+	}
+
+	for i, row := range t.Rows {
+		cells := make([]interface{}, len(names))
+		for j, name := range names {
+			cells[j] = row[indices[name]]
+		}
+		selected.Rows[i] = cells
+	}
+	return selected, nil
+}
+
+// tableColumns returns the columns of the struct-type, with nested structs
+// flattened.
+func tableColumns(t reflect.Type, prefix string, path [][]int) []tableColumn {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var columns []tableColumn
+	for _, f := range structFields(t) {
+		fieldPath := append(append([][]int{}, path...), f.index)
+		if isRecord(f.typ) {
+			columns = append(columns, tableColumns(f.typ, prefix+f.name+".", fieldPath)...)
+			continue
+		}
+		columns = append(columns, tableColumn{
+			Column: Column{
+				Name: prefix + f.name,
+				Kind: cellKind(f.typ),
+			},
+			path:      fieldPath,
+			omitEmpty: f.omitEmpty,
+		})
+	}
+	return columns
+}
+
+// cellKind returns the kind of cells of the type.
+func cellKind(t reflect.Type) string {
+	if t.Implements(textMarshalerType) {
+		return KindString
+	}
+	if t.Kind() == reflect.Ptr {
+		return cellKind(t.Elem())
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return KindBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return KindInt
+	case reflect.Float32, reflect.Float64:
+		return KindFloat
+	}
+	return KindString
+}
+
+// cell returns the value of the column in the row.
+func (c tableColumn) cell(row reflect.Value) (interface{}, error) {
+	v := row
+	for _, index := range c.path {
+		var ok bool
+		v, ok = indirect(v)
+		if !ok {
+			return nil, nil
+		}
+		v = v.FieldByIndex(index)
+	}
+	if c.omitEmpty && isEmpty(v) {
+		return nil, nil
+	}
+
+	if c.Kind == KindString {
+		return scalarText(v)
+	}
+	v, ok := indirect(v)
+	if !ok {
+		return nil, nil
+	}
+	switch c.Kind {
+	case KindBool:
+		return v.Bool(), nil
+	case KindFloat:
+		return v.Float(), nil
+	}
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), nil
+	}
+	return v.Int(), nil
+}
@@ -0,0 +1,42 @@
+package codec
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Table", func() {
+	It("should tabulate results with typed cells", func() {
+		delta := 1.5
+		table, err := Tabulate([]testItem{
+			{SKU: 3, DeltaPct: &delta, Key: "apples", Values: []float64{1}},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(table.Columns).To(Equal([]Column{
+			{Name: "sku", Kind: KindInt},
+			{Name: "name", Kind: KindString},
+			{Name: "weight", Kind: KindFloat},
+			{Name: "delta_pct", Kind: KindFloat},
+			{Name: "key", Kind: KindString},
+			{Name: "period.start", Kind: KindInt},
+			{Name: "period.end", Kind: KindInt},
+			{Name: "values", Kind: KindString},
+		}))
+		Expect(table.Rows).To(Equal([][]interface{}{
+			{int64(3), nil, float64(0), 1.5, "apples", int64(0), int64(0), "[1]"},
+		}))
+	})
+
+	It("should select columns", func() {
+		table, err := Tabulate([]testPeriod{{Start: 1, End: 2}})
+		Expect(err).ToNot(HaveOccurred())
+
+		selected, err := table.Select([]string{"end", "start"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(selected.Columns[0].Name).To(Equal("end"))
+		Expect(selected.Rows).To(Equal([][]interface{}{{int64(2), int64(1)}}))
+
+		_, err = table.Select([]string{"start", "middle"})
+		Expect(err).To(MatchError("Unknown columns: middle"))
+	})
+})
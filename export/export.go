@@ -0,0 +1,198 @@
+// Package export writes report-results to CSV, XLSX and Parquet files, as
+// Tables of the codec package with selected and formatted columns.
+//
+// The XLSX and Parquet writers are minimal: XLSX files have a single sheet,
+// and Parquet files a single row-group of uncompressed, PLAIN-encoded and
+// optional columns. The specs check their output against files in testdata,
+// which were read with established XLSX- and Parquet-readers.
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/TerrexTech/go-report-productsold/codec"
+	"github.com/pkg/errors"
+)
+
+// Export-formats.
+const (
+	FormatCSV     = "csv"
+	FormatXLSX    = "xlsx"
+	FormatParquet = "parquet"
+)
+
+// Options select and format the exported columns.
+type Options struct {
+	// Columns selects and orders the exported columns, by their Table-names
+	// such as "period.start". All columns are exported if empty.
+	Columns []string
+	// Precision is the number of decimals floats are rounded to.
+	// Floats keep their full precision if it is zero.
+	Precision int
+	// TimeColumns are int-columns of Unix timestamps, which are exported as
+	// text formatted with TimeLayout in Location.
+	TimeColumns []string
+	// TimeLayout defaults to time.RFC3339.
+	TimeLayout string
+	// Location defaults to UTC.
+	Location *time.Location
+
+	// Delimiter is the field-delimiter of CSV. Defaults to ','.
+	Delimiter rune
+	// NoHeader omits the header-row of CSV and XLSX.
+	NoHeader bool
+}
+
+// FormatOf returns the format of the file-extension of path.
+func FormatOf(path string) (string, error) {
+	format := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	switch format {
+	case FormatCSV, FormatXLSX, FormatParquet:
+		return format, nil
+	}
+	return "", errors.Errorf("Unknown export-format of file %s", path)
+}
+
+// WriteFile writes the table in the format to the file at path, which is
+// created or truncated.
+func WriteFile(path string, format string, table *codec.Table, opts Options) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "Error creating export-file")
+	}
+	w := bufio.NewWriter(file)
+	err = Write(w, format, table, opts)
+	if err == nil {
+		err = w.Flush()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Error writing export-file %s", path)
+	}
+	return nil
+}
+
+// Write writes the table in the format to w.
+func Write(w io.Writer, format string, table *codec.Table, opts Options) error {
+	table, err := opts.apply(table)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case FormatCSV:
+		return writeCSV(w, table, opts)
+	case FormatXLSX:
+		return writeXLSX(w, table, opts)
+	case FormatParquet:
+		return writeParquet(w, table)
+	}
+	return errors.Errorf("Unknown export-format: %s", format)
+}
+
+// apply returns a copy of the table with the columns selected and formatted
+// as per the options.
+func (opts Options) apply(table *codec.Table) (*codec.Table, error) {
+	if len(opts.Columns) > 0 {
+		var err error
+		table, err = table.Select(opts.Columns)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(table.Columns) == 0 {
+		return nil, errors.New("No columns to export")
+	}
+
+	isTime := map[string]bool{}
+	for _, name := range opts.TimeColumns {
+		isTime[name] = true
+	}
+	layout := opts.TimeLayout
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	location := opts.Location
+	if location == nil {
+		location = time.UTC
+	}
+
+	formatted := &codec.Table{
+		Columns: append([]codec.Column{}, table.Columns...),
+		Rows:    make([][]interface{}, len(table.Rows)),
+	}
+	for i, c := range formatted.Columns {
+		if !isTime[c.Name] {
+			continue
+		}
+		if c.Kind != codec.KindInt {
+			return nil, errors.Errorf("Time-column %s is not an int-column", c.Name)
+		}
+		formatted.Columns[i].Kind = codec.KindString
+		delete(isTime, c.Name)
+	}
+	for name := range isTime {
+		return nil, errors.Errorf("Unknown time-column: %s", name)
+	}
+
+	scale := math.Pow(10, float64(opts.Precision))
+	for i, row := range table.Rows {
+		cells := append([]interface{}{}, row...)
+		for j, cell := range cells {
+			switch value := cell.(type) {
+			case int64:
+				if formatted.Columns[j].Kind == codec.KindString {
+					cells[j] = time.Unix(value, 0).In(location).Format(layout)
+				}
+			case float64:
+				if opts.Precision > 0 {
+					cells[j] = math.Round(value*scale) / scale
+				}
+			}
+		}
+		formatted.Rows[i] = cells
+	}
+	return formatted, nil
+}
+
+func writeCSV(w io.Writer, table *codec.Table, opts Options) error {
+	cw := csv.NewWriter(w)
+	if opts.Delimiter != 0 {
+		cw.Comma = opts.Delimiter
+	}
+	precision := -1
+	if opts.Precision > 0 {
+		precision = opts.Precision
+	}
+
+	record := make([]string, len(table.Columns))
+	if !opts.NoHeader {
+		for i, c := range table.Columns {
+			record[i] = c.Name
+		}
+		err := cw.Write(record)
+		if err != nil {
+			return errors.Wrap(err, "Error writing CSV-header")
+		}
+	}
+	for _, row := range table.Rows {
+		for i, cell := range row {
+			record[i] = codec.FormatCell(cell, precision)
+		}
+		err := cw.Write(record)
+		if err != nil {
+			return errors.Wrap(err, "Error writing CSV-row")
+		}
+	}
+	cw.Flush()
+	return errors.Wrap(cw.Error(), "Error writing CSV")
+}
@@ -0,0 +1,97 @@
+package export
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/TerrexTech/go-report-productsold/codec"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// testTable returns a Table of sold items for the export specs.
+func testTable() *codec.Table {
+	return &codec.Table{
+		Columns: []codec.Column{
+			{Name: "sku", Kind: codec.KindInt},
+			{Name: "name", Kind: codec.KindString},
+			{Name: "revenue", Kind: codec.KindFloat},
+			{Name: "date_sold", Kind: codec.KindInt},
+			{Name: "flash", Kind: codec.KindBool},
+		},
+		Rows: [][]interface{}{
+			{int64(1), "Apples, red", 10.256, int64(1538352000), true},
+			{int64(2), nil, nil, nil, false},
+		},
+	}
+}
+
+var _ = Describe("Export", func() {
+	It("should return the format of file-extensions", func() {
+		format, err := FormatOf("/tmp/sold-2018-10.XLSX")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(format).To(Equal(FormatXLSX))
+
+		_, err = FormatOf("sold.json")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should write CSV", func() {
+		var buf bytes.Buffer
+		err := Write(&buf, FormatCSV, testTable(), Options{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buf.String()).To(Equal(
+			"sku,name,revenue,date_sold,flash\n" +
+				"1,\"Apples, red\",10.256,1538352000,true\n" +
+				"2,,,,false\n",
+		))
+	})
+
+	It("should select and format columns", func() {
+		location, err := time.LoadLocation("America/Toronto")
+		Expect(err).ToNot(HaveOccurred())
+
+		var buf bytes.Buffer
+		err = Write(&buf, FormatCSV, testTable(), Options{
+			Columns:     []string{"date_sold", "revenue"},
+			Precision:   2,
+			TimeColumns: []string{"date_sold"},
+			TimeLayout:  "2006-01-02 15:04",
+			Location:    location,
+			Delimiter:   ';',
+			NoHeader:    true,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buf.String()).To(Equal("2018-09-30 20:00;10.26\n;\n"))
+	})
+
+	It("should not modify the table", func() {
+		table := testTable()
+		err := Write(&bytes.Buffer{}, FormatCSV, table, Options{
+			Precision:   1,
+			TimeColumns: []string{"date_sold"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(table).To(Equal(testTable()))
+	})
+
+	It("should return an error for invalid columns", func() {
+		err := Write(&bytes.Buffer{}, FormatCSV, testTable(), Options{
+			Columns: []string{"sku", "weight"},
+		})
+		Expect(err).To(HaveOccurred())
+
+		err = Write(&bytes.Buffer{}, FormatCSV, testTable(), Options{
+			TimeColumns: []string{"name"},
+		})
+		Expect(err).To(HaveOccurred())
+
+		err = Write(&bytes.Buffer{}, FormatCSV, testTable(), Options{
+			TimeColumns: []string{"expiry_date"},
+		})
+		Expect(err).To(HaveOccurred())
+
+		err = Write(&bytes.Buffer{}, FormatCSV, &codec.Table{}, Options{})
+		Expect(err).To(HaveOccurred())
+	})
+})
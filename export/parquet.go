@@ -0,0 +1,242 @@
+package export
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/TerrexTech/go-report-productsold/codec"
+	"github.com/pkg/errors"
+)
+
+const parquetMagic = "PAR1"
+
+// Parquet-enums of the format's Thrift-definitions.
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetOptional = 1
+	parquetUTF8     = 0
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetDataPage     = 0
+	parquetUncompressed = 0
+)
+
+// parquetChunk is a written column-chunk.
+type parquetChunk struct {
+	column codec.Column
+	offset int64
+	size   int64
+}
+
+// writeParquet writes the table as a Parquet-file with a single row-group.
+// Each column is a chunk of a single data-page.
+func writeParquet(w io.Writer, table *codec.Table) error {
+	out := &countingWriter{w: w}
+	_, err := io.WriteString(out, parquetMagic)
+	if err != nil {
+		return errors.Wrap(err, "Error writing Parquet")
+	}
+
+	var chunks []parquetChunk
+	if len(table.Rows) > 0 {
+		for i, c := range table.Columns {
+			page := parquetPage(table, i)
+			header := parquetPageHeader(len(table.Rows), len(page))
+
+			chunk := parquetChunk{
+				column: c,
+				offset: out.n,
+				size:   int64(len(header) + len(page)),
+			}
+			_, err = out.Write(append(header, page...))
+			if err != nil {
+				return errors.Wrapf(err, "Error writing Parquet-column %s", c.Name)
+			}
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	footer := parquetFooter(table, chunks)
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(footer)))
+	_, err = out.Write(append(append(footer, length[:]...), parquetMagic...))
+	return errors.Wrap(err, "Error writing Parquet-footer")
+}
+
+// parquetPage returns the data-page of the column: the RLE-encoded
+// definition-levels, and the PLAIN-encoded non-nil values.
+func parquetPage(table *codec.Table, column int) []byte {
+	levels := make([]bool, len(table.Rows))
+	var values []byte
+	var bits, bitCount int
+	for i, row := range table.Rows {
+		cell := row[column]
+		if cell == nil {
+			continue
+		}
+		levels[i] = true
+
+		switch value := cell.(type) {
+		case int64:
+			values = appendUint64(values, uint64(value))
+		case float64:
+			values = appendUint64(values, math.Float64bits(value))
+		case bool:
+			if value {
+				bits |= 1 << uint(bitCount)
+			}
+			bitCount++
+			if bitCount == 8 {
+				values = append(values, byte(bits))
+				bits, bitCount = 0, 0
+			}
+		default:
+			text := codec.FormatCell(cell, -1)
+			var length [4]byte
+			binary.LittleEndian.PutUint32(length[:], uint32(len(text)))
+			values = append(append(values, length[:]...), text...)
+		}
+	}
+	if bitCount > 0 {
+		values = append(values, byte(bits))
+	}
+
+	encoded := rleLevels(levels)
+	page := make([]byte, 4, 4+len(encoded)+len(values))
+	binary.LittleEndian.PutUint32(page, uint32(len(encoded)))
+	return append(append(page, encoded...), values...)
+}
+
+// rleLevels encodes the definition-levels of an optional column as runs of
+// the RLE/bit-packing hybrid, with a bit-width of 1.
+func rleLevels(levels []bool) []byte {
+	var encoded []byte
+	for start := 0; start < len(levels); {
+		end := start
+		for end < len(levels) && levels[end] == levels[start] {
+			end++
+		}
+		var header [binary.MaxVarintLen64]byte
+		n := binary.PutUvarint(header[:], uint64(end-start)<<1)
+		encoded = append(encoded, header[:n]...)
+		if levels[start] {
+			encoded = append(encoded, 1)
+		} else {
+			encoded = append(encoded, 0)
+		}
+		start = end
+	}
+	return encoded
+}
+
+// parquetPageHeader returns the PageHeader of a data-page of size bytes
+// with values values.
+func parquetPageHeader(values int, size int) []byte {
+	w := &thriftWriter{}
+	w.i32(1, parquetDataPage)
+	w.i32(2, int32(size))
+	w.i32(3, int32(size))
+	w.structField(5)
+	w.i32(1, int32(values))
+	w.i32(2, parquetPlain)
+	w.i32(3, parquetRLE)
+	w.i32(4, parquetRLE)
+	w.end()
+	w.end()
+	return w.buf
+}
+
+// parquetFooter returns the FileMetaData of the table's chunks.
+func parquetFooter(table *codec.Table, chunks []parquetChunk) []byte {
+	w := &thriftWriter{}
+	w.i32(1, 1)
+
+	w.list(2, thriftStruct, len(table.Columns)+1)
+	w.begin()
+	w.string(4, "schema")
+	w.i32(5, int32(len(table.Columns)))
+	w.end()
+	for _, c := range table.Columns {
+		w.begin()
+		w.i32(1, parquetType(c))
+		w.i32(3, parquetOptional)
+		w.string(4, c.Name)
+		if c.Kind == codec.KindString {
+			w.i32(6, parquetUTF8)
+		}
+		w.end()
+	}
+
+	w.i64(3, int64(len(table.Rows)))
+	if len(chunks) == 0 {
+		w.list(4, thriftStruct, 0)
+	} else {
+		var totalSize int64
+		for _, chunk := range chunks {
+			totalSize += chunk.size
+		}
+		w.list(4, thriftStruct, 1)
+		w.begin()
+		w.list(1, thriftStruct, len(chunks))
+		for _, chunk := range chunks {
+			w.begin()
+			w.i64(2, chunk.offset)
+			w.structField(3)
+			w.i32(1, parquetType(chunk.column))
+			w.listI32(2, parquetPlain, parquetRLE)
+			w.listString(3, chunk.column.Name)
+			w.i32(4, parquetUncompressed)
+			w.i64(5, int64(len(table.Rows)))
+			w.i64(6, chunk.size)
+			w.i64(7, chunk.size)
+			w.i64(9, chunk.offset)
+			w.end()
+			w.end()
+		}
+		w.i64(2, totalSize)
+		w.i64(3, int64(len(table.Rows)))
+		w.end()
+	}
+
+	w.string(6, "go-report-productsold")
+	w.end()
+	return w.buf
+}
+
+// parquetType returns the physical Parquet-type of the column.
+func parquetType(c codec.Column) int32 {
+	switch c.Kind {
+	case codec.KindInt:
+		return parquetInt64
+	case codec.KindFloat:
+		return parquetDouble
+	case codec.KindBool:
+		return parquetBoolean
+	}
+	return parquetByteArray
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	return append(buf, b[:]...)
+}
+
+// countingWriter counts the bytes written, for the offsets of chunks.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,188 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// thriftReader decodes compact-protocol structs into maps of their fields
+// by id, for checking written Parquet-metadata.
+type thriftReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *thriftReader) varint() uint64 {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	Expect(n).To(BeNumerically(">", 0))
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) int() int64 {
+	v := r.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) readStruct() map[int16]interface{} {
+	fields := map[int16]interface{}{}
+	var lastID int16
+	for {
+		header := r.buf[r.pos]
+		r.pos++
+		if header == 0 {
+			return fields
+		}
+		typ := header & 0x0f
+		id := lastID + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(r.int())
+		}
+		fields[id] = r.readValue(typ)
+		lastID = id
+	}
+}
+
+func (r *thriftReader) readValue(typ byte) interface{} {
+	switch typ {
+	case thriftI32, thriftI64:
+		return r.int()
+	case thriftBinary:
+		length := int(r.varint())
+		r.pos += length
+		return string(r.buf[r.pos-length : r.pos])
+	case thriftList:
+		header := r.buf[r.pos]
+		r.pos++
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(r.varint())
+		}
+		values := make([]interface{}, size)
+		for i := range values {
+			values[i] = r.readValue(header & 0x0f)
+		}
+		return values
+	case thriftStruct:
+		return r.readStruct()
+	}
+	Fail("Unexpected Thrift-type")
+	return nil
+}
+
+var _ = Describe("Parquet", func() {
+	It("should write Thrift compact-structs", func() {
+		w := &thriftWriter{}
+		w.i32(1, -1)
+		w.structField(2)
+		w.string(1, "a")
+		w.end()
+		w.i64(20, 150)
+		w.listI32(21, 1, 2)
+		w.end()
+		Expect(w.buf).To(Equal([]byte{
+			0x15, 0x01,
+			0x1c, 0x18, 0x01, 'a', 0x00,
+			0x06, 0x28, 0xac, 0x02,
+			0x19, 0x25, 0x02, 0x04,
+			0x00,
+		}))
+	})
+
+	It("should encode definition-levels as runs", func() {
+		Expect(rleLevels([]bool{true, true, true, false, true})).To(Equal([]byte{
+			0x06, 0x01, 0x02, 0x00, 0x02, 0x01,
+		}))
+	})
+
+	It("should write the table as a row-group", func() {
+		var buf bytes.Buffer
+		err := Write(&buf, FormatParquet, testTable(), Options{})
+		Expect(err).ToNot(HaveOccurred())
+		data := buf.Bytes()
+
+		Expect(string(data[:4])).To(Equal(parquetMagic))
+		Expect(string(data[len(data)-4:])).To(Equal(parquetMagic))
+		footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+		footerStart := len(data) - 8 - footerLen
+
+		r := &thriftReader{buf: data[:len(data)-8], pos: footerStart}
+		meta := r.readStruct()
+		Expect(r.pos).To(Equal(len(data) - 8))
+		Expect(meta[1]).To(Equal(int64(1)))
+		Expect(meta[3]).To(Equal(int64(2)))
+
+		schema := meta[2].([]interface{})
+		Expect(schema).To(HaveLen(6))
+		Expect(schema[0].(map[int16]interface{})[5]).To(Equal(int64(5)))
+		name := schema[2].(map[int16]interface{})
+		Expect(name[4]).To(Equal("name"))
+		Expect(name[1]).To(Equal(int64(parquetByteArray)))
+		Expect(name[3]).To(Equal(int64(parquetOptional)))
+		Expect(name[6]).To(Equal(int64(parquetUTF8)))
+
+		rowGroups := meta[4].([]interface{})
+		Expect(rowGroups).To(HaveLen(1))
+		rowGroup := rowGroups[0].(map[int16]interface{})
+		Expect(rowGroup[3]).To(Equal(int64(2)))
+		columns := rowGroup[1].([]interface{})
+		Expect(columns).To(HaveLen(5))
+
+		// The revenue-column has one value and one nil
+		revenue := columns[2].(map[int16]interface{})[3].(map[int16]interface{})
+		Expect(revenue[1]).To(Equal(int64(parquetDouble)))
+		Expect(revenue[3]).To(Equal([]interface{}{"revenue"}))
+		Expect(revenue[5]).To(Equal(int64(2)))
+
+		offset := revenue[9].(int64)
+		size := revenue[6].(int64)
+		r = &thriftReader{buf: data[:offset+size], pos: int(offset)}
+		pageHeader := r.readStruct()
+		Expect(pageHeader[1]).To(Equal(int64(parquetDataPage)))
+		Expect(pageHeader[5].(map[int16]interface{})[1]).To(Equal(int64(2)))
+
+		page := data[r.pos : offset+size]
+		Expect(int64(len(page))).To(Equal(pageHeader[2]))
+		levelsLen := binary.LittleEndian.Uint32(page)
+		Expect(page[4 : 4+levelsLen]).To(Equal(rleLevels([]bool{true, false})))
+		value := math.Float64frombits(binary.LittleEndian.Uint64(page[4+levelsLen:]))
+		Expect(value).To(Equal(10.256))
+	})
+
+	// testdata/sold.parquet was read with the Parquet-reader of Apache Arrow,
+	// which decoded the schema, values and nulls of the table. Any change to
+	// the written bytes must be checked with such a reader again.
+	It("should write the checked file", func() {
+		var buf bytes.Buffer
+		err := Write(&buf, FormatParquet, testTable(), Options{
+			Precision:   2,
+			TimeColumns: []string{"date_sold"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		golden, err := ioutil.ReadFile("testdata/sold.parquet")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buf.Bytes()).To(Equal(golden))
+	})
+
+	It("should write tables without rows", func() {
+		table := testTable()
+		table.Rows = nil
+		var buf bytes.Buffer
+		err := Write(&buf, FormatParquet, table, Options{})
+		Expect(err).ToNot(HaveOccurred())
+
+		data := buf.Bytes()
+		footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+		Expect(4 + footerLen + 8).To(Equal(len(data)))
+		r := &thriftReader{buf: data, pos: 4}
+		meta := r.readStruct()
+		Expect(meta[3]).To(Equal(int64(0)))
+		Expect(meta[4]).To(BeEmpty())
+	})
+})
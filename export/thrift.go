@@ -0,0 +1,112 @@
+package export
+
+import "encoding/binary"
+
+// Types of the Thrift compact-protocol.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter writes structs in the Thrift compact-protocol, as used by
+// Parquet-metadata. Fields must be written in ascending order of their ids.
+type thriftWriter struct {
+	buf []byte
+	// lastID is the id of the last field of the current struct, and
+	// lastIDs those of the enclosing structs.
+	lastID  int16
+	lastIDs []int16
+}
+
+func (w *thriftWriter) field(id int16, typ byte) {
+	delta := id - w.lastID
+	if delta > 0 && delta <= 15 {
+		w.buf = append(w.buf, byte(delta)<<4|typ)
+	} else {
+		w.buf = append(w.buf, typ)
+		w.varint(zigzag(int64(id)))
+	}
+	w.lastID = id
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.field(id, thriftI32)
+	w.varint(zigzag(int64(v)))
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.field(id, thriftI64)
+	w.varint(zigzag(v))
+}
+
+func (w *thriftWriter) string(id int16, v string) {
+	w.field(id, thriftBinary)
+	w.binary(v)
+}
+
+// list begins a list-field of size elements of the type, which are written
+// after it.
+func (w *thriftWriter) list(id int16, elemType byte, size int) {
+	w.field(id, thriftList)
+	if size < 15 {
+		w.buf = append(w.buf, byte(size)<<4|elemType)
+		return
+	}
+	w.buf = append(w.buf, 0xf0|elemType)
+	w.varint(uint64(size))
+}
+
+// listI32 writes a list-field of i32s.
+func (w *thriftWriter) listI32(id int16, values ...int32) {
+	w.list(id, thriftI32, len(values))
+	for _, v := range values {
+		w.varint(zigzag(int64(v)))
+	}
+}
+
+// listString writes a list-field of strings.
+func (w *thriftWriter) listString(id int16, values ...string) {
+	w.list(id, thriftBinary, len(values))
+	for _, v := range values {
+		w.binary(v)
+	}
+}
+
+// structField begins a struct-field, which is ended by end.
+func (w *thriftWriter) structField(id int16) {
+	w.field(id, thriftStruct)
+	w.begin()
+}
+
+// begin begins a struct, such as an element of a list of structs.
+func (w *thriftWriter) begin() {
+	w.lastIDs = append(w.lastIDs, w.lastID)
+	w.lastID = 0
+}
+
+// end ends the current struct.
+func (w *thriftWriter) end() {
+	w.buf = append(w.buf, 0)
+	if len(w.lastIDs) > 0 {
+		w.lastID = w.lastIDs[len(w.lastIDs)-1]
+		w.lastIDs = w.lastIDs[:len(w.lastIDs)-1]
+	}
+}
+
+func (w *thriftWriter) binary(v string) {
+	w.varint(uint64(len(v)))
+	w.buf = append(w.buf, v...)
+}
+
+func (w *thriftWriter) varint(x uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], x)
+	w.buf = append(w.buf, b[:n]...)
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
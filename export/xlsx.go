@@ -0,0 +1,186 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/TerrexTech/go-report-productsold/codec"
+	"github.com/pkg/errors"
+)
+
+const (
+	xlsxMainNS = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+	xlsxRelNS  = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	xlsxPkgNS  = "http://schemas.openxmlformats.org/package/2006/relationships"
+)
+
+// Styles of XLSX-cells, as indices of the cellXfs in xlsxStyles.
+const (
+	xlsxStyleDefault = 0
+	xlsxStyleHeader  = 1
+	xlsxStyleFloat   = 2
+)
+
+// xlsxParts are the static parts of XLSX-files.
+var xlsxParts = map[string]string{
+	"[Content_Types].xml": `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+		`</Types>`,
+	"_rels/.rels": `<Relationships xmlns="` + xlsxPkgNS + `">` +
+		`<Relationship Id="rId1" Type="` + xlsxRelNS + `/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`,
+	"xl/workbook.xml": `<workbook xmlns="` + xlsxMainNS + `" xmlns:r="` + xlsxRelNS + `">` +
+		`<sheets><sheet name="Report" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`,
+	"xl/_rels/workbook.xml.rels": `<Relationships xmlns="` + xlsxPkgNS + `">` +
+		`<Relationship Id="rId1" Type="` + xlsxRelNS + `/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`<Relationship Id="rId2" Type="` + xlsxRelNS + `/styles" Target="styles.xml"/>` +
+		`</Relationships>`,
+}
+
+// xlsxPartOrder is the order of the parts in XLSX-files, with the
+// content-types first.
+var xlsxPartOrder = []string{
+	"[Content_Types].xml",
+	"_rels/.rels",
+	"xl/workbook.xml",
+	"xl/_rels/workbook.xml.rels",
+	"xl/styles.xml",
+	"xl/worksheets/sheet1.xml",
+}
+
+// writeXLSX writes the table as the single sheet of an XLSX-file. The
+// header is bold, and floats are formatted with the Precision, if set.
+func writeXLSX(w io.Writer, table *codec.Table, opts Options) error {
+	parts := map[string]string{
+		"xl/styles.xml":            xlsxStyles(opts.Precision),
+		"xl/worksheets/sheet1.xml": xlsxSheet(table, opts),
+	}
+	for name, content := range xlsxParts {
+		parts[name] = content
+	}
+
+	zw := zip.NewWriter(w)
+	for _, name := range xlsxPartOrder {
+		fw, err := zw.Create(name)
+		if err == nil {
+			_, err = io.WriteString(fw, xml.Header+parts[name])
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Error writing XLSX-part %s", name)
+		}
+	}
+	return errors.Wrap(zw.Close(), "Error writing XLSX")
+}
+
+// xlsxStyles returns the stylesheet with the cellXfs of the xlsxStyle
+// constants.
+func xlsxStyles(precision int) string {
+	floatFormat := 0
+	numFmts := ""
+	if precision > 0 {
+		floatFormat = 164
+		numFmts = fmt.Sprintf(
+			`<numFmts count="1"><numFmt numFmtId="%d" formatCode="0.%s"/></numFmts>`,
+			floatFormat, strings.Repeat("0", precision),
+		)
+	}
+
+	return `<styleSheet xmlns="` + xlsxMainNS + `">` + numFmts +
+		`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font>` +
+		`<font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+		`<fills count="2"><fill><patternFill patternType="none"/></fill>` +
+		`<fill><patternFill patternType="gray125"/></fill></fills>` +
+		`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+		`<cellXfs count="3">` +
+		`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+		`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+		fmt.Sprintf(`<xf numFmtId="%d" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>`, floatFormat) +
+		`</cellXfs></styleSheet>`
+}
+
+// xlsxSheet returns the worksheet of the table, with strings inlined.
+func xlsxSheet(table *codec.Table, opts Options) string {
+	var buf bytes.Buffer
+	buf.WriteString(`<worksheet xmlns="` + xlsxMainNS + `"><sheetData>`)
+
+	rowNum := 0
+	writeRow := func(cells []interface{}, style int) {
+		rowNum++
+		fmt.Fprintf(&buf, `<row r="%d">`, rowNum)
+		for i, cell := range cells {
+			xlsxCell(&buf, xlsxCellRef(i, rowNum), cell, style)
+		}
+		buf.WriteString(`</row>`)
+	}
+
+	if !opts.NoHeader {
+		header := make([]interface{}, len(table.Columns))
+		for i, c := range table.Columns {
+			header[i] = c.Name
+		}
+		writeRow(header, xlsxStyleHeader)
+	}
+	for _, row := range table.Rows {
+		writeRow(row, xlsxStyleDefault)
+	}
+
+	buf.WriteString(`</sheetData></worksheet>`)
+	return buf.String()
+}
+
+// xlsxCell writes the cell at ref. Nil cells are omitted, and floats that
+// are not finite are written as strings.
+func xlsxCell(buf *bytes.Buffer, ref string, cell interface{}, style int) {
+	switch value := cell.(type) {
+	case int64:
+		fmt.Fprintf(buf, `<c r="%s"><v>%d</v></c>`, ref, value)
+		return
+	case float64:
+		if !math.IsNaN(value) && !math.IsInf(value, 0) {
+			fmt.Fprintf(
+				buf, `<c r="%s" s="%d"><v>%s</v></c>`,
+				ref, xlsxStyleFloat, strconv.FormatFloat(value, 'g', -1, 64),
+			)
+			return
+		}
+	case bool:
+		v := 0
+		if value {
+			v = 1
+		}
+		fmt.Fprintf(buf, `<c r="%s" t="b"><v>%d</v></c>`, ref, v)
+		return
+	case nil:
+		return
+	}
+
+	fmt.Fprintf(buf, `<c r="%s" t="inlineStr"`, ref)
+	if style != xlsxStyleDefault {
+		fmt.Fprintf(buf, ` s="%d"`, style)
+	}
+	buf.WriteString(`><is><t xml:space="preserve">`)
+	xml.EscapeText(buf, []byte(codec.FormatCell(cell, -1)))
+	buf.WriteString(`</t></is></c>`)
+}
+
+// xlsxCellRef returns the A1-reference of the 0-based column and 1-based
+// row, such as "AB12".
+func xlsxCellRef(column int, row int) string {
+	name := ""
+	for column++; column > 0; column = (column - 1) / 26 {
+		name = string(rune('A'+(column-1)%26)) + name
+	}
+	return name + strconv.Itoa(row)
+}
@@ -0,0 +1,118 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// xlsxTestSheet is the worksheet of XLSX-files, as far as the specs check.
+type xlsxTestSheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R      string `xml:"r,attr"`
+			T      string `xml:"t,attr"`
+			S      int    `xml:"s,attr"`
+			V      string `xml:"v"`
+			Inline string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+var _ = Describe("XLSX", func() {
+	readParts := func(data []byte) map[string][]byte {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		Expect(err).ToNot(HaveOccurred())
+		parts := map[string][]byte{}
+		for _, f := range zr.File {
+			r, err := f.Open()
+			Expect(err).ToNot(HaveOccurred())
+			parts[f.Name], err = ioutil.ReadAll(r)
+			Expect(err).ToNot(HaveOccurred())
+			r.Close()
+		}
+		return parts
+	}
+
+	It("should write the table as a sheet", func() {
+		var buf bytes.Buffer
+		err := Write(&buf, FormatXLSX, testTable(), Options{Precision: 2})
+		Expect(err).ToNot(HaveOccurred())
+
+		parts := readParts(buf.Bytes())
+		Expect(parts).To(HaveLen(len(xlsxPartOrder)))
+		for name, part := range parts {
+			var doc interface{}
+			Expect(xml.Unmarshal(part, &doc)).To(Succeed(), name)
+		}
+		Expect(string(parts["xl/styles.xml"])).To(ContainSubstring(`formatCode="0.00"`))
+
+		var sheet xlsxTestSheet
+		err = xml.Unmarshal(parts["xl/worksheets/sheet1.xml"], &sheet)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sheet.Rows).To(HaveLen(3))
+
+		header := sheet.Rows[0].Cells
+		Expect(header).To(HaveLen(5))
+		Expect(header[0].R).To(Equal("A1"))
+		Expect(header[0].Inline).To(Equal("sku"))
+		Expect(header[0].S).To(Equal(xlsxStyleHeader))
+
+		cells := sheet.Rows[1].Cells
+		Expect(cells[0].V).To(Equal("1"))
+		Expect(cells[1].T).To(Equal("inlineStr"))
+		Expect(cells[1].Inline).To(Equal("Apples, red"))
+		Expect(cells[2].V).To(Equal("10.26"))
+		Expect(cells[2].S).To(Equal(xlsxStyleFloat))
+		Expect(cells[4].T).To(Equal("b"))
+		Expect(cells[4].V).To(Equal("1"))
+
+		// Nil cells are omitted
+		cells = sheet.Rows[2].Cells
+		Expect(cells).To(HaveLen(2))
+		Expect(cells[1].R).To(Equal("E3"))
+	})
+
+	// testdata/sold.xlsx was opened with excelize, which read the sheet with
+	// its values, cell-types and styles. Any change to the written parts must
+	// be checked with a spreadsheet-application or such a reader again.
+	It("should write the parts of the checked file", func() {
+		var buf bytes.Buffer
+		err := Write(&buf, FormatXLSX, testTable(), Options{
+			Precision:   2,
+			TimeColumns: []string{"date_sold"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		golden, err := ioutil.ReadFile("testdata/sold.xlsx")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(readParts(buf.Bytes())).To(Equal(readParts(golden)))
+	})
+
+	It("should escape strings", func() {
+		table := testTable()
+		table.Rows[0][1] = `<Pears & "Plums">`
+		var buf bytes.Buffer
+		err := Write(&buf, FormatXLSX, table, Options{NoHeader: true})
+		Expect(err).ToNot(HaveOccurred())
+
+		var sheet xlsxTestSheet
+		err = xml.Unmarshal(readParts(buf.Bytes())["xl/worksheets/sheet1.xml"], &sheet)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sheet.Rows).To(HaveLen(2))
+		Expect(sheet.Rows[0].Cells[1].Inline).To(Equal(`<Pears & "Plums">`))
+	})
+
+	It("should reference columns beyond Z", func() {
+		Expect(xlsxCellRef(0, 1)).To(Equal("A1"))
+		Expect(xlsxCellRef(25, 2)).To(Equal("Z2"))
+		Expect(xlsxCellRef(26, 3)).To(Equal("AA3"))
+		Expect(xlsxCellRef(701, 4)).To(Equal("ZZ4"))
+		Expect(xlsxCellRef(702, 5)).To(Equal("AAA5"))
+	})
+})
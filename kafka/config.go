@@ -0,0 +1,244 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"time"
+
+	"github.com/Shopify/sarama"
+	cluster "github.com/bsm/sarama-cluster"
+	"github.com/pkg/errors"
+)
+
+// DefaultMaxProcessingTime is the default ConsumerConfig.MaxProcessingTime.
+const DefaultMaxProcessingTime = 10 * time.Second
+
+// DefaultVersion is the default Adapter.Version, which supports the headers
+// of produced responses.
+const DefaultVersion = "1.0.0"
+
+// ConsumerConfig configures the consumers of the Adapter.
+// Unset fields use the defaults.
+type ConsumerConfig struct {
+	// InitialOffset is "newest" or "oldest", and is used by consumer-groups
+	// without committed offsets. Defaults to "newest".
+	InitialOffset string
+	// MaxProcessingTime is the time a consumed message may take to be
+	// processed before the consumer pauses. Defaults to
+	// DefaultMaxProcessingTime.
+	MaxProcessingTime time.Duration
+	// SessionTimeout is the time after which the consumer is removed from the
+	// consumer-group if its heartbeats stop.
+	SessionTimeout time.Duration
+	// HeartbeatInterval is the interval of the consumer's heartbeats, which
+	// must be less than a third of the SessionTimeout.
+	HeartbeatInterval time.Duration
+}
+
+// ProducerConfig configures the producers of the Adapter.
+// Unset fields use the defaults.
+type ProducerConfig struct {
+	// RequiredAcks is "none", "local" or "all", for no acknowledgement, the
+	// partition-leader's, or all in-sync replicas'. Defaults to "local", or
+	// to "all" for Idempotent producers.
+	RequiredAcks string
+	// Compression is "none", "gzip", "snappy" or "lz4". Defaults to "none".
+	Compression string
+	// MaxMessageBytes is the maximum size of produced messages, which must
+	// not exceed the broker's message.max.bytes.
+	MaxMessageBytes int
+	// Idempotent makes the brokers discard messages the producers retried,
+	// but which were already written. Requires RequiredAcks "all" and a
+	// Version of at least 0.11.0, and limits the producers to one request
+	// in flight per broker.
+	Idempotent bool
+}
+
+// SecurityConfig configures SASL and TLS for the Adapter's connections.
+type SecurityConfig struct {
+	// SASLUser enables SASL/PLAIN authentication if set.
+	SASLUser     string
+	SASLPassword string
+
+	// TLSEnable enables TLS. The system's root CAs are used unless
+	// TLSCAFile is set.
+	TLSEnable bool
+	TLSCAFile string
+	// TLSCertFile and TLSKeyFile are the client-certificate, if the brokers
+	// require client-authentication.
+	TLSCertFile           string
+	TLSKeyFile            string
+	TLSInsecureSkipVerify bool
+}
+
+// consumerConfig creates the sarama-config of the Adapter's consumers.
+func (ka *Adapter) consumerConfig() (*cluster.Config, error) {
+	saramaCfg := cluster.NewConfig()
+	saramaCfg.Consumer.Return.Errors = true
+
+	cc := ka.Consumer
+	switch cc.InitialOffset {
+	case "", "newest":
+		saramaCfg.Consumer.Offsets.Initial = sarama.OffsetNewest
+	case "oldest":
+		saramaCfg.Consumer.Offsets.Initial = sarama.OffsetOldest
+	default:
+		return nil, errors.Errorf("Unknown InitialOffset: %s", cc.InitialOffset)
+	}
+
+	saramaCfg.Consumer.MaxProcessingTime = DefaultMaxProcessingTime
+	if cc.MaxProcessingTime > 0 {
+		saramaCfg.Consumer.MaxProcessingTime = cc.MaxProcessingTime
+	}
+	if cc.SessionTimeout > 0 {
+		saramaCfg.Group.Session.Timeout = cc.SessionTimeout
+	}
+	if cc.HeartbeatInterval > 0 {
+		saramaCfg.Group.Heartbeat.Interval = cc.HeartbeatInterval
+	}
+
+	if saramaCfg.Group.Heartbeat.Interval*3 >= saramaCfg.Group.Session.Timeout {
+		return nil, errors.New(
+			"HeartbeatInterval must be less than a third of the SessionTimeout",
+		)
+	}
+
+	err := ka.applyCommon(&saramaCfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	err = saramaCfg.Validate()
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid consumer-config")
+	}
+	return saramaCfg, nil
+}
+
+// producerConfig creates the sarama-config of the Adapter's producers.
+func (ka *Adapter) producerConfig() (*sarama.Config, error) {
+	config := sarama.NewConfig()
+	config.Producer.Return.Errors = true
+
+	pc := ka.Producer
+	switch pc.RequiredAcks {
+	case "":
+		config.Producer.RequiredAcks = sarama.WaitForLocal
+		if pc.Idempotent {
+			config.Producer.RequiredAcks = sarama.WaitForAll
+		}
+	case "local":
+		config.Producer.RequiredAcks = sarama.WaitForLocal
+	case "all":
+		config.Producer.RequiredAcks = sarama.WaitForAll
+	case "none":
+		config.Producer.RequiredAcks = sarama.NoResponse
+	default:
+		return nil, errors.Errorf("Unknown RequiredAcks: %s", pc.RequiredAcks)
+	}
+
+	switch pc.Compression {
+	case "", "none":
+		config.Producer.Compression = sarama.CompressionNone
+	case "gzip":
+		config.Producer.Compression = sarama.CompressionGZIP
+	case "snappy":
+		config.Producer.Compression = sarama.CompressionSnappy
+	case "lz4":
+		config.Producer.Compression = sarama.CompressionLZ4
+	default:
+		return nil, errors.Errorf("Unknown Compression: %s", pc.Compression)
+	}
+
+	if pc.MaxMessageBytes > 0 {
+		config.Producer.MaxMessageBytes = pc.MaxMessageBytes
+	}
+
+	if pc.Idempotent {
+		if config.Producer.RequiredAcks != sarama.WaitForAll {
+			return nil, errors.Errorf(
+				"Idempotent producers require RequiredAcks all, got %s", pc.RequiredAcks,
+			)
+		}
+		config.Producer.Idempotent = true
+		// Retried requests could otherwise overtake later ones
+		config.Net.MaxOpenRequests = 1
+	}
+
+	err := ka.applyCommon(config)
+	if err != nil {
+		return nil, err
+	}
+	err = config.Validate()
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid producer-config")
+	}
+	return config, nil
+}
+
+// kafkaVersion returns the parsed Version, or the DefaultVersion if unset.
+func (ka *Adapter) kafkaVersion() (sarama.KafkaVersion, error) {
+	v := ka.Version
+	if v == "" {
+		v = DefaultVersion
+	}
+	version, err := sarama.ParseKafkaVersion(v)
+	if err != nil {
+		return sarama.KafkaVersion{}, errors.Wrap(err, "Error parsing Version")
+	}
+	return version, nil
+}
+
+// applyCommon applies the Kafka-version and SecurityConfig to the config.
+func (ka *Adapter) applyCommon(config *sarama.Config) error {
+	version, err := ka.kafkaVersion()
+	if err != nil {
+		return err
+	}
+	config.Version = version
+
+	sc := ka.Security
+	if sc.SASLUser != "" {
+		config.Net.SASL.Enable = true
+		config.Net.SASL.User = sc.SASLUser
+		config.Net.SASL.Password = sc.SASLPassword
+	}
+
+	if sc.TLSEnable {
+		tlsConfig, err := sc.tlsConfig()
+		if err != nil {
+			return errors.Wrap(err, "Error creating TLS-config")
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+	return nil
+}
+
+// tlsConfig creates the TLS-config from the configured files.
+func (sc *SecurityConfig) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: sc.TLSInsecureSkipVerify,
+	}
+
+	if sc.TLSCAFile != "" {
+		caPEM, err := ioutil.ReadFile(sc.TLSCAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error reading TLSCAFile")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, errors.New("No certificates found in TLSCAFile")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if sc.TLSCertFile != "" || sc.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(sc.TLSCertFile, sc.TLSKeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error loading client-certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,113 @@
+package kafka
+
+import (
+	"time"
+
+	"github.com/Shopify/sarama"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Adapter config", func() {
+	It("should use the defaults for unset fields", func() {
+		adapter := &Adapter{}
+
+		consumerCfg, err := adapter.consumerConfig()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(consumerCfg.Version).To(Equal(sarama.V1_0_0_0))
+		Expect(consumerCfg.Consumer.Offsets.Initial).To(Equal(sarama.OffsetNewest))
+		Expect(consumerCfg.Consumer.MaxProcessingTime).To(Equal(DefaultMaxProcessingTime))
+		Expect(consumerCfg.Consumer.Return.Errors).To(BeTrue())
+		Expect(consumerCfg.Net.SASL.Enable).To(BeFalse())
+		Expect(consumerCfg.Net.TLS.Enable).To(BeFalse())
+
+		producerCfg, err := adapter.producerConfig()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(producerCfg.Producer.RequiredAcks).To(Equal(sarama.WaitForLocal))
+		Expect(producerCfg.Producer.Compression).To(Equal(sarama.CompressionNone))
+		Expect(producerCfg.Producer.Return.Errors).To(BeTrue())
+	})
+
+	It("should apply the configured settings", func() {
+		adapter := &Adapter{
+			Version: "1.0.0",
+			Consumer: ConsumerConfig{
+				InitialOffset:     "oldest",
+				MaxProcessingTime: time.Minute,
+				SessionTimeout:    45 * time.Second,
+				HeartbeatInterval: 5 * time.Second,
+			},
+			Producer: ProducerConfig{
+				RequiredAcks:    "all",
+				Compression:     "snappy",
+				MaxMessageBytes: 2000000,
+			},
+			Security: SecurityConfig{
+				SASLUser:              "user",
+				SASLPassword:          "pass",
+				TLSEnable:             true,
+				TLSInsecureSkipVerify: true,
+			},
+		}
+
+		consumerCfg, err := adapter.consumerConfig()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(consumerCfg.Version).To(Equal(sarama.V1_0_0_0))
+		Expect(consumerCfg.Consumer.Offsets.Initial).To(Equal(sarama.OffsetOldest))
+		Expect(consumerCfg.Consumer.MaxProcessingTime).To(Equal(time.Minute))
+		Expect(consumerCfg.Group.Session.Timeout).To(Equal(45 * time.Second))
+		Expect(consumerCfg.Group.Heartbeat.Interval).To(Equal(5 * time.Second))
+		Expect(consumerCfg.Net.SASL.Enable).To(BeTrue())
+		Expect(consumerCfg.Net.SASL.User).To(Equal("user"))
+		Expect(consumerCfg.Net.TLS.Enable).To(BeTrue())
+		Expect(consumerCfg.Net.TLS.Config.InsecureSkipVerify).To(BeTrue())
+
+		producerCfg, err := adapter.producerConfig()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(producerCfg.Producer.RequiredAcks).To(Equal(sarama.WaitForAll))
+		Expect(producerCfg.Producer.Compression).To(Equal(sarama.CompressionSnappy))
+		Expect(producerCfg.Producer.MaxMessageBytes).To(Equal(2000000))
+		Expect(producerCfg.Net.SASL.Password).To(Equal("pass"))
+	})
+
+	It("should configure idempotent producers", func() {
+		adapter := &Adapter{
+			Version: "1.0.0",
+			Producer: ProducerConfig{
+				Idempotent: true,
+			},
+		}
+		producerCfg, err := adapter.producerConfig()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(producerCfg.Producer.Idempotent).To(BeTrue())
+		Expect(producerCfg.Producer.RequiredAcks).To(Equal(sarama.WaitForAll))
+		Expect(producerCfg.Net.MaxOpenRequests).To(Equal(1))
+	})
+
+	It("should reject invalid settings", func() {
+		invalid := []*Adapter{
+			{Consumer: ConsumerConfig{InitialOffset: "latest"}},
+			{Version: "one"},
+			{Security: SecurityConfig{TLSEnable: true, TLSCAFile: "/nonexistent/ca.pem"}},
+			{Consumer: ConsumerConfig{
+				SessionTimeout:    time.Second,
+				HeartbeatInterval: 2 * time.Second,
+			}},
+		}
+		for _, adapter := range invalid {
+			_, err := adapter.consumerConfig()
+			Expect(err).To(HaveOccurred(), "%+v", adapter)
+		}
+
+		invalid = []*Adapter{
+			{Producer: ProducerConfig{RequiredAcks: "some"}},
+			{Producer: ProducerConfig{Compression: "zstd"}},
+			{Version: "1.0.0", Producer: ProducerConfig{Idempotent: true, RequiredAcks: "local"}},
+			{Version: "0.10.2", Producer: ProducerConfig{Idempotent: true}},
+		}
+		for _, adapter := range invalid {
+			_, err := adapter.producerConfig()
+			Expect(err).To(HaveOccurred(), "%+v", adapter)
+		}
+	})
+})
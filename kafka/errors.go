@@ -0,0 +1,240 @@
+package kafka
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/TerrexTech/go-kafkautils/producer"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultProducerRetries is the number of times retriable producer-errors
+	// are retried if Adapter.ProducerRetries is not set.
+	DefaultProducerRetries = 3
+	// DefaultRetryBackoff is the backoff before the first retry if
+	// Adapter.RetryBackoff is not set.
+	DefaultRetryBackoff = 100 * time.Millisecond
+	// maxRetryBackoff caps the doubling retry-backoff.
+	maxRetryBackoff = 30 * time.Second
+)
+
+// DeadLetter is a message that could not be processed or produced, which is
+// produced to the Adapter's DeadLetterTopic.
+type DeadLetter struct {
+	// Topic is the topic the message was consumed from or produced to.
+	Topic string `json:"topic"`
+	// Error is the reason the message was dead-lettered.
+	Error string `json:"error"`
+	// Attempts is the number of times processing or producing was attempted.
+	Attempts int `json:"attempts"`
+	// Timestamp is the Unix-time the message was dead-lettered at.
+	Timestamp int64 `json:"timestamp"`
+	// Value is the original message-value.
+	Value []byte `json:"value"`
+}
+
+// NewDeadLetter creates a DeadLetter for a consumed message that failed
+// processing.
+func NewDeadLetter(msg *sarama.ConsumerMessage, err error, attempts int) *DeadLetter {
+	return &DeadLetter{
+		Topic:     msg.Topic,
+		Error:     err.Error(),
+		Attempts:  attempts,
+		Timestamp: time.Now().Unix(),
+		Value:     msg.Value,
+	}
+}
+
+// handleError passes the error to the ErrorHandler, or logs it if none is set.
+func (ka *Adapter) handleError(err error) {
+	if ka.ErrorHandler != nil {
+		ka.ErrorHandler(err)
+		return
+	}
+	log.Println(err)
+}
+
+// deadLetter produces the DeadLetter to the DeadLetterTopic. The DeadLetter
+// is dropped if no DeadLetterTopic is set, or if it failed being produced to
+// the DeadLetterTopic itself, so it doesn't loop.
+func (ka *Adapter) deadLetter(input chan<- *sarama.ProducerMessage, dl *DeadLetter) {
+	if ka.DeadLetterTopic == "" || dl.Topic == ka.DeadLetterTopic {
+		return
+	}
+	dlJSON, err := json.Marshal(dl)
+	if err != nil {
+		err = errors.Wrap(err, "Error marshalling DeadLetter")
+		ka.handleError(err)
+		return
+	}
+	input <- producer.CreateMessage(ka.DeadLetterTopic, dlJSON)
+}
+
+// produceDeadLetters produces the DeadLetters received on deadLetterChan until
+// it is closed.
+func (ka *Adapter) produceDeadLetters(
+	input chan<- *sarama.ProducerMessage,
+	deadLetterChan <-chan *DeadLetter,
+) {
+	for dl := range deadLetterChan {
+		ka.deadLetter(input, dl)
+	}
+}
+
+// handleProducerError retries the failed message after a backoff if the error
+// is retriable and it has retries left, else it is dead-lettered. The number
+// of attempts of a message is tracked in its Metadata. Retries and
+// DeadLetters are sent to the input asynchronously, since the input blocks
+// while the producer's errors are not drained. They are added to pending, if
+// set, so the producer is only closed once they were sent.
+func (ka *Adapter) handleProducerError(
+	input chan<- *sarama.ProducerMessage,
+	prodErr *sarama.ProducerError,
+	pending *pendingSends,
+) {
+	msg := prodErr.Msg
+	attempts, _ := msg.Metadata.(int)
+	attempts++
+
+	retries := ka.ProducerRetries
+	if retries == 0 {
+		retries = DefaultProducerRetries
+	}
+	if retriable(prodErr.Err) && attempts <= retries {
+		msg.Metadata = attempts
+		pending.add()
+		time.AfterFunc(ka.backoff(attempts), func() {
+			input <- msg
+			pending.done()
+		})
+		return
+	}
+
+	err := errors.Wrapf(
+		prodErr.Err, "Error producing message to %s after %d attempts", msg.Topic, attempts,
+	)
+	ka.handleError(err)
+
+	value, encErr := msg.Value.Encode()
+	if encErr != nil {
+		encErr = errors.Wrap(encErr, "Error encoding failed message")
+		ka.handleError(encErr)
+		return
+	}
+	dl := &DeadLetter{
+		Topic:     msg.Topic,
+		Error:     prodErr.Err.Error(),
+		Attempts:  attempts,
+		Timestamp: time.Now().Unix(),
+		Value:     value,
+	}
+	pending.add()
+	go func() {
+		ka.deadLetter(input, dl)
+		pending.done()
+	}()
+}
+
+// awaitPending waits until the pending retries and DeadLetters were sent to
+// the input, while handling the producer's errors, which may add further
+// retries and DeadLetters.
+func (ka *Adapter) awaitPending(
+	input chan<- *sarama.ProducerMessage,
+	prodErrs <-chan *sarama.ProducerError,
+	pending *pendingSends,
+) {
+	for {
+		select {
+		case prodErr := <-prodErrs:
+			ka.handleProducerError(input, prodErr, pending)
+		case <-pending.sent():
+			return
+		}
+	}
+}
+
+// pendingSends counts the retries and DeadLetters of failed messages not yet
+// sent to the producer's input. A nil pendingSends counts nothing.
+type pendingSends struct {
+	mutex sync.Mutex
+	count int
+	// idle is closed once count drops to 0
+	idle chan struct{}
+}
+
+func (p *pendingSends) add() {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.count == 0 {
+		p.idle = make(chan struct{})
+	}
+	p.count++
+}
+
+func (p *pendingSends) done() {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.count--
+	if p.count == 0 {
+		close(p.idle)
+	}
+}
+
+// sent returns a channel which is closed once nothing is pending.
+func (p *pendingSends) sent() <-chan struct{} {
+	if p != nil {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		if p.count > 0 {
+			return p.idle
+		}
+	}
+	idle := make(chan struct{})
+	close(idle)
+	return idle
+}
+
+// backoff returns the delay before the retry of the attempt, which doubles
+// from the RetryBackoff with each attempt.
+func (ka *Adapter) backoff(attempt int) time.Duration {
+	backoff := ka.RetryBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	for i := 1; i < attempt && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return backoff
+}
+
+// retriable returns whether a producer-error is transient, such as from
+// leader-elections or unreachable brokers.
+func retriable(err error) bool {
+	switch err {
+	case sarama.ErrOutOfBrokers,
+		sarama.ErrNotConnected,
+		sarama.ErrLeaderNotAvailable,
+		sarama.ErrNotLeaderForPartition,
+		sarama.ErrRequestTimedOut,
+		sarama.ErrBrokerNotAvailable,
+		sarama.ErrNetworkException,
+		sarama.ErrNotEnoughReplicas,
+		sarama.ErrNotEnoughReplicasAfterAppend,
+		sarama.ErrUnknownTopicOrPartition:
+		return true
+	}
+	return false
+}
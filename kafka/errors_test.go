@@ -0,0 +1,209 @@
+package kafka
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Shopify/sarama"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+var _ = Describe("Error handling", func() {
+	var (
+		adapter *Adapter
+		input   chan *sarama.ProducerMessage
+		handled []error
+	)
+
+	BeforeEach(func() {
+		handled = []error{}
+		adapter = &Adapter{
+			ProducerTopic:   "test.response",
+			DeadLetterTopic: "test.deadletter",
+			RetryBackoff:    time.Millisecond,
+			ErrorHandler: func(err error) {
+				handled = append(handled, err)
+			},
+		}
+		input = make(chan *sarama.ProducerMessage, 1)
+	})
+
+	failed := func(err error) *sarama.ProducerError {
+		return &sarama.ProducerError{
+			Msg: &sarama.ProducerMessage{
+				Topic: "test.response",
+				Value: sarama.ByteEncoder(`{"result":1}`),
+			},
+			Err: err,
+		}
+	}
+
+	It("should retry retriable producer-errors with attempt-counts", func() {
+		prodErr := failed(sarama.ErrLeaderNotAvailable)
+		adapter.handleProducerError(input, prodErr, nil)
+
+		var retried *sarama.ProducerMessage
+		Eventually(input).Should(Receive(&retried))
+		Expect(retried.Topic).To(Equal("test.response"))
+		Expect(retried.Metadata).To(Equal(1))
+		Expect(handled).To(BeEmpty())
+	})
+
+	It("should dead-letter messages out of retries", func() {
+		prodErr := failed(sarama.ErrRequestTimedOut)
+		prodErr.Msg.Metadata = DefaultProducerRetries
+		adapter.handleProducerError(input, prodErr, nil)
+
+		var dlMsg *sarama.ProducerMessage
+		Eventually(input).Should(Receive(&dlMsg))
+		Expect(dlMsg.Topic).To(Equal("test.deadletter"))
+
+		value, err := dlMsg.Value.Encode()
+		Expect(err).ToNot(HaveOccurred())
+		dl := DeadLetter{}
+		err = json.Unmarshal(value, &dl)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dl.Topic).To(Equal("test.response"))
+		Expect(dl.Attempts).To(Equal(DefaultProducerRetries + 1))
+		Expect(dl.Error).To(Equal(sarama.ErrRequestTimedOut.Error()))
+		Expect(dl.Value).To(Equal([]byte(`{"result":1}`)))
+		Expect(handled).To(HaveLen(1))
+	})
+
+	It("should dead-letter non-retriable producer-errors immediately", func() {
+		adapter.handleProducerError(input, failed(sarama.ErrMessageSizeTooLarge), nil)
+
+		var dlMsg *sarama.ProducerMessage
+		Eventually(input).Should(Receive(&dlMsg))
+		Expect(dlMsg.Topic).To(Equal("test.deadletter"))
+		Expect(handled).To(HaveLen(1))
+	})
+
+	It("should not block on the input while dead-lettering", func() {
+		input = make(chan *sarama.ProducerMessage)
+		adapter.handleProducerError(input, failed(sarama.ErrMessageSizeTooLarge), nil)
+		adapter.handleProducerError(input, failed(sarama.ErrMessageSizeTooLarge), nil)
+
+		Eventually(input).Should(Receive())
+		Eventually(input).Should(Receive())
+	})
+
+	It("should await pending retries and dead-letters", func() {
+		pending := &pendingSends{}
+		input = make(chan *sarama.ProducerMessage)
+		adapter.handleProducerError(input, failed(sarama.ErrLeaderNotAvailable), pending)
+
+		prodErrs := make(chan *sarama.ProducerError)
+		awaited := make(chan struct{})
+		go func() {
+			adapter.awaitPending(input, prodErrs, pending)
+			close(awaited)
+		}()
+		// Producer-errors are handled while awaiting
+		prodErrs <- failed(sarama.ErrMessageSizeTooLarge)
+		Consistently(awaited).ShouldNot(BeClosed())
+
+		Eventually(input).Should(Receive())
+		Eventually(input).Should(Receive())
+		Eventually(awaited).Should(BeClosed())
+		Eventually(pending.sent()).Should(BeClosed())
+	})
+
+	It("should not dead-letter failed dead-letters", func() {
+		prodErr := failed(sarama.ErrMessageSizeTooLarge)
+		prodErr.Msg.Topic = "test.deadletter"
+		adapter.handleProducerError(input, prodErr, nil)
+
+		Consistently(input).ShouldNot(Receive())
+		Expect(handled).To(HaveLen(1))
+	})
+
+	It("should drop dead-letters without a DeadLetterTopic", func() {
+		adapter.DeadLetterTopic = ""
+		adapter.deadLetter(input, NewDeadLetter(
+			&sarama.ConsumerMessage{Topic: "test.events"},
+			errors.New("bad event"),
+			1,
+		))
+		Expect(input).ToNot(Receive())
+	})
+
+	It("should create dead-letters from consumed messages", func() {
+		dl := NewDeadLetter(
+			&sarama.ConsumerMessage{
+				Topic: "test.events",
+				Value: []byte("{bad"),
+			},
+			errors.New("bad event"),
+			2,
+		)
+		Expect(dl.Topic).To(Equal("test.events"))
+		Expect(dl.Error).To(Equal("bad event"))
+		Expect(dl.Attempts).To(Equal(2))
+		Expect(dl.Value).To(Equal([]byte("{bad")))
+		Expect(dl.Timestamp).To(BeNumerically("~", time.Now().Unix(), 1))
+	})
+
+	It("should double the retry-backoff up to a maximum", func() {
+		adapter.RetryBackoff = 100 * time.Millisecond
+		Expect(adapter.backoff(1)).To(Equal(100 * time.Millisecond))
+		Expect(adapter.backoff(3)).To(Equal(400 * time.Millisecond))
+		Expect(adapter.backoff(20)).To(Equal(maxRetryBackoff))
+
+		adapter.RetryBackoff = 0
+		Expect(adapter.backoff(1)).To(Equal(DefaultRetryBackoff))
+	})
+
+	It("should only retry transient errors", func() {
+		Expect(retriable(sarama.ErrOutOfBrokers)).To(BeTrue())
+		Expect(retriable(sarama.ErrNotLeaderForPartition)).To(BeTrue())
+		Expect(retriable(sarama.ErrMessageSizeTooLarge)).To(BeFalse())
+		Expect(retriable(errors.New("other"))).To(BeFalse())
+	})
+})
+
+var _ = Describe("DeadLetter replay", func() {
+	deadLetter := func(dl DeadLetter) *sarama.ConsumerMessage {
+		value, err := json.Marshal(dl)
+		Expect(err).ToNot(HaveOccurred())
+		return &sarama.ConsumerMessage{
+			Topic: "test.deadletter",
+			Value: value,
+		}
+	}
+
+	It("should re-produce the original value to its topic", func() {
+		msg, err := replayMessage(deadLetter(DeadLetter{
+			Topic:    "test.events",
+			Attempts: 1,
+			Value:    []byte(`{"action":"query"}`),
+		}), 3)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(msg.Topic).To(Equal("test.events"))
+		value, err := msg.Value.Encode()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(value).To(Equal([]byte(`{"action":"query"}`)))
+	})
+
+	It("should skip dead-letters out of attempts", func() {
+		dl := DeadLetter{
+			Topic:    "test.events",
+			Attempts: 3,
+		}
+		_, err := replayMessage(deadLetter(dl), 3)
+		Expect(err).To(HaveOccurred())
+
+		_, err = replayMessage(deadLetter(dl), 0)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should skip malformed dead-letters", func() {
+		_, err := replayMessage(&sarama.ConsumerMessage{Value: []byte("{bad")}, 0)
+		Expect(err).To(HaveOccurred())
+
+		_, err = replayMessage(deadLetter(DeadLetter{}), 0)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -6,18 +6,14 @@ import (
 )
 
 // IO provides channels for interacting with Kafka.
-// Note: All receive-channels must be read from to prevent deadlock.
+// Note: The consumer-messages channel must be read from to prevent deadlock.
+// Errors are passed to the Adapter's ErrorHandler.
 type IO struct {
-	consumerErrChan    <-chan error
 	consumerMsgChan    <-chan *sarama.ConsumerMessage
 	consumerOffsetChan chan<- *sarama.ConsumerMessage
-	producerErrChan    <-chan *sarama.ProducerError
+	deadLetterChan     chan<- *DeadLetter
 	producerInputChan  chan<- *model.KafkaResponse
-}
-
-// ConsumerErrors returns send-channel where consumer errors are published.
-func (kio *IO) ConsumerErrors() <-chan error {
-	return kio.consumerErrChan
+	responseChan       chan<- *Response
 }
 
 // ConsumerMessages returns send-channel where consumer messages are published.
@@ -26,17 +22,27 @@ func (kio *IO) ConsumerMessages() <-chan *sarama.ConsumerMessage {
 }
 
 // MarkOffset marks the consumer message-offset to be committed.
-// This should be used once a message has done its job.
+// This should be used once a message has done its job. Messages can be
+// marked out of order, the offset is only committed once all messages
+// consumed before it from its partition are marked too.
 func (kio *IO) MarkOffset() chan<- *sarama.ConsumerMessage {
 	return kio.consumerOffsetChan
 }
 
-// ProducerErrors returns send-channel where producer errors are published.
-func (kio *IO) ProducerErrors() <-chan *sarama.ProducerError {
-	return kio.producerErrChan
+// DeadLetters returns receive-channel where DeadLetters of messages that
+// could not be processed can be produced to the Adapter's DeadLetterTopic.
+// The offsets of such messages should still be marked.
+func (kio *IO) DeadLetters() chan<- *DeadLetter {
+	return kio.deadLetterChan
 }
 
 // ProducerInput returns receive-channel where kafka-responses can be produced.
 func (kio *IO) ProducerInput() chan<- *model.KafkaResponse {
 	return kio.producerInputChan
 }
+
+// Responses returns receive-channel where Responses can be produced, with
+// their metadata as message-headers.
+func (kio *IO) Responses() chan<- *Response {
+	return kio.responseChan
+}
@@ -1,7 +1,6 @@
 package kafka
 
 import (
-	"encoding/json"
 	"log"
 	"time"
 
@@ -9,7 +8,7 @@ import (
 	"github.com/TerrexTech/go-eventstore-models/model"
 	"github.com/TerrexTech/go-kafkautils/consumer"
 	"github.com/TerrexTech/go-kafkautils/producer"
-	cluster "github.com/bsm/sarama-cluster"
+	"github.com/TerrexTech/go-report-productsold/chunk"
 	"github.com/pkg/errors"
 )
 
@@ -20,6 +19,36 @@ type Adapter struct {
 	ConsumerGroupName string
 	ConsumerTopics    []string
 	ProducerTopic     string
+	// ChunkBytes splits responses with larger Results into chunks with at
+	// most as many bytes of the Result each. Use chunk.PartSize to fit them
+	// into the brokers' message.max.bytes. Chunking is disabled if 0.
+	ChunkBytes int
+	// CompressResults gzip-compresses the Results of responses into chunks.
+	CompressResults bool
+	// KeyBy is KeyByCorrelationID or KeyByAggregateID, and is what response
+	// messages are keyed by. Defaults to KeyByCorrelationID.
+	KeyBy string
+
+	// ErrorHandler is called with every error of the IO, none of which are
+	// fatal. Errors are logged if it is not set.
+	ErrorHandler func(error)
+	// DeadLetterTopic is where DeadLetters of messages that could not be
+	// processed or produced are produced. Dead-lettering is disabled if empty.
+	DeadLetterTopic string
+	// ProducerRetries is the number of times messages failing with retriable
+	// errors are retried before being dead-lettered. Defaults to
+	// DefaultProducerRetries if 0, and negative values disable retries.
+	ProducerRetries int
+	// RetryBackoff is the delay before the first retry, which doubles with
+	// each retry. Defaults to DefaultRetryBackoff.
+	RetryBackoff time.Duration
+
+	// Version is the Kafka-version of the brokers, such as "1.0.0".
+	// Defaults to DefaultVersion.
+	Version  string
+	Consumer ConsumerConfig
+	Producer ProducerConfig
+	Security SecurityConfig
 }
 
 // responseProducer creates a new Kafka-Producer used for producing the
@@ -27,8 +56,13 @@ type Adapter struct {
 func (ka *Adapter) responseProducer(
 	brokers []string,
 ) (*producer.Producer, error) {
+	saramaCfg, err := ka.producerConfig()
+	if err != nil {
+		return nil, err
+	}
 	config := producer.Config{
 		KafkaBrokers: brokers,
+		SaramaConfig: saramaCfg,
 	}
 	resProducer, err := producer.New(&config)
 	if err != nil {
@@ -39,10 +73,10 @@ func (ka *Adapter) responseProducer(
 
 // Consumer creates a new Kafka-Consumer which listens for the events.
 func (ka *Adapter) consumer() (*consumer.Consumer, error) {
-	saramaCfg := cluster.NewConfig()
-	saramaCfg.Consumer.Offsets.Initial = sarama.OffsetNewest
-	saramaCfg.Consumer.MaxProcessingTime = 10 * time.Second
-	saramaCfg.Consumer.Return.Errors = true
+	saramaCfg, err := ka.consumerConfig()
+	if err != nil {
+		return nil, err
+	}
 
 	config := &consumer.Config{
 		ConsumerGroup: ka.ConsumerGroupName,
@@ -60,6 +94,10 @@ func (ka *Adapter) consumer() (*consumer.Consumer, error) {
 // and the service won't run.
 func (ka *Adapter) InitIO() (*IO, error) {
 	log.Println("Initializing KafkaIO")
+	err := ka.validateKeyBy()
+	if err != nil {
+		return nil, err
+	}
 
 	// Create Kafka Response-Producer
 	resProducer, err := ka.responseProducer(ka.Brokers)
@@ -74,27 +112,47 @@ func (ka *Adapter) InitIO() (*IO, error) {
 		return nil, err
 	}
 
+	// Producer-errors are retried or dead-lettered
+	go func() {
+		for prodErr := range resProducer.Errors() {
+			ka.handleProducerError(resProducerInput, prodErr, nil)
+		}
+	}()
+
 	// Setup Producer I/O channels
 	producerInputChan := make(chan *model.KafkaResponse)
+	responseChan := make(chan *Response)
+	deadLetterChan := make(chan *DeadLetter)
 	kio := &IO{
+		deadLetterChan:    (chan<- *DeadLetter)(deadLetterChan),
 		producerInputChan: (chan<- *model.KafkaResponse)(producerInputChan),
-		producerErrChan:   resProducer.Errors(),
+		responseChan:      (chan<- *Response)(responseChan),
 	}
 
-	// The Kafka-Response post-processing the consumed events
+	// KafkaResponses are produced as Responses without metadata
 	go func() {
 		for msg := range producerInputChan {
-			msgJSON, err := json.Marshal(msg)
-			if err != nil {
-				// Something went severely wrong
-				err = errors.Wrapf(err, "Error Marshalling KafkaResponse")
-				log.Fatalln(err)
+			responseChan <- &Response{
+				KafkaResponse: msg,
 			}
+		}
+	}()
 
-			producerMsg := producer.CreateMessage(ka.ProducerTopic, msgJSON)
-			resProducerInput <- producerMsg
+	// The Kafka-Response post-processing the consumed events
+	withHeaders := ka.headersSupported()
+	if !withHeaders {
+		log.Printf(
+			"Kafka-Version %s does not support headers, producing responses without headers",
+			ka.Version,
+		)
+	}
+	go func() {
+		for resp := range responseChan {
+			ka.produceResponse(resProducerInput, resp, withHeaders)
 		}
 	}()
+
+	go ka.produceDeadLetters(resProducerInput, deadLetterChan)
 	log.Println("Created Kafka Response-Channel")
 
 	// Create Kafka Event-Consumer
@@ -105,20 +163,78 @@ func (ka *Adapter) InitIO() (*IO, error) {
 	}
 	log.Println("Created Kafka Event-Consumer Group")
 
-	// A channel which receives consumer-messages to be committed
+	// A channel which receives consumer-messages to be committed. Offsets are
+	// only marked once all earlier messages of their partition are done too,
+	// since messages may be handled concurrently.
+	offsets := newOffsetTracker()
 	consumerOffsetChan := make(chan *sarama.ConsumerMessage)
 	kio.consumerOffsetChan = (chan<- *sarama.ConsumerMessage)(consumerOffsetChan)
 	go func() {
 		for msg := range consumerOffsetChan {
-			eventConsumer.MarkOffset(msg, "")
+			if mark := offsets.done(msg); mark != nil {
+				eventConsumer.MarkOffset(mark, "")
+			}
 		}
 	}()
 	log.Println("Created Kafka Event Offset-Commit Channel")
 
+	go func() {
+		for err := range eventConsumer.Errors() {
+			err = errors.Wrap(err, "Error consuming events")
+			ka.handleError(err)
+		}
+	}()
+
 	// Setup Consumer I/O channels
-	kio.consumerErrChan = eventConsumer.Errors()
-	kio.consumerMsgChan = eventConsumer.Messages()
+	consumerMsgChan := make(chan *sarama.ConsumerMessage)
+	kio.consumerMsgChan = (<-chan *sarama.ConsumerMessage)(consumerMsgChan)
+	go func() {
+		for msg := range eventConsumer.Messages() {
+			offsets.start(msg)
+			consumerMsgChan <- msg
+		}
+		close(consumerMsgChan)
+	}()
 	log.Println("KafkaIO Ready")
 
 	return kio, nil
 }
+
+// InitDeadLetters creates a producer for DeadLetters to the DeadLetterTopic,
+// for services using another transport than IO. Errors are handled as by IO.
+func (ka *Adapter) InitDeadLetters() (chan<- *DeadLetter, error) {
+	dlProducer, err := ka.responseProducer(ka.Brokers)
+	if err != nil {
+		err = errors.Wrap(err, "Error Creating DeadLetter Producer")
+		return nil, err
+	}
+	dlProducerInput, err := dlProducer.Input()
+	if err != nil {
+		err = errors.Wrap(err, "Error Getting Input-Channel from Producer")
+		return nil, err
+	}
+
+	go func() {
+		for prodErr := range dlProducer.Errors() {
+			ka.handleProducerError(dlProducerInput, prodErr, nil)
+		}
+	}()
+
+	deadLetterChan := make(chan *DeadLetter)
+	go ka.produceDeadLetters(dlProducerInput, deadLetterChan)
+	return deadLetterChan, nil
+}
+
+// SplitResponse splits the response into chunks as per ChunkBytes and
+// CompressResults. Returns the response as is if neither is set.
+func (ka *Adapter) SplitResponse(resp *model.KafkaResponse) ([]*model.KafkaResponse, error) {
+	if ka.ChunkBytes <= 0 && !ka.CompressResults {
+		return []*model.KafkaResponse{resp}, nil
+	}
+	partSize := ka.ChunkBytes
+	if partSize <= 0 {
+		// Compressed Results are only split if chunking is enabled
+		partSize = len(resp.Result) + 1
+	}
+	return chunk.Split(resp, partSize, ka.CompressResults)
+}
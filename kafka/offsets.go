@@ -0,0 +1,82 @@
+package kafka
+
+import (
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// topicPartition identifies a partition of a topic.
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// partitionOffsets are the in-flight messages of a partition.
+type partitionOffsets struct {
+	// started are the offsets of in-flight messages, in consumed order
+	started []int64
+	done    map[int64]*sarama.ConsumerMessage
+}
+
+// offsetTracker tracks the consumed messages of each partition until they
+// are done. Messages handled concurrently are done out of order, and marking
+// the offset of a later message first would commit past the earlier ones
+// still in flight, losing them if the consumer stops. Instead, only the
+// latest message done with all messages before it done too is marked.
+type offsetTracker struct {
+	mutex      sync.Mutex
+	partitions map[topicPartition]*partitionOffsets
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{
+		partitions: map[topicPartition]*partitionOffsets{},
+	}
+}
+
+// start tracks the message as in flight. Messages must be started in
+// consumed order.
+func (t *offsetTracker) start(msg *sarama.ConsumerMessage) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key := topicPartition{topic: msg.Topic, partition: msg.Partition}
+	p := t.partitions[key]
+	// Messages are consumed again from the committed offset if the partition
+	// was reassigned, so the messages in flight before are forgotten
+	if p == nil || (len(p.started) > 0 && msg.Offset <= p.started[len(p.started)-1]) {
+		p = &partitionOffsets{
+			done: map[int64]*sarama.ConsumerMessage{},
+		}
+		t.partitions[key] = p
+	}
+	p.started = append(p.started, msg.Offset)
+}
+
+// done marks the message as done, and returns the latest message of its
+// partition whose offset can be marked, or nil if messages before it are
+// still in flight.
+func (t *offsetTracker) done(msg *sarama.ConsumerMessage) *sarama.ConsumerMessage {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key := topicPartition{topic: msg.Topic, partition: msg.Partition}
+	p := t.partitions[key]
+	if p == nil {
+		return nil
+	}
+	p.done[msg.Offset] = msg
+
+	var mark *sarama.ConsumerMessage
+	for len(p.started) > 0 {
+		doneMsg, isDone := p.done[p.started[0]]
+		if !isDone {
+			break
+		}
+		delete(p.done, p.started[0])
+		p.started = p.started[1:]
+		mark = doneMsg
+	}
+	return mark
+}
@@ -0,0 +1,61 @@
+package kafka
+
+import (
+	"github.com/Shopify/sarama"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Offset tracking", func() {
+	var tracker *offsetTracker
+
+	BeforeEach(func() {
+		tracker = newOffsetTracker()
+	})
+
+	// consumed starts and returns messages with the offsets of a partition.
+	consumed := func(partition int32, offsets ...int64) []*sarama.ConsumerMessage {
+		msgs := make([]*sarama.ConsumerMessage, len(offsets))
+		for i, offset := range offsets {
+			msgs[i] = &sarama.ConsumerMessage{
+				Topic:     "test.events",
+				Partition: partition,
+				Offset:    offset,
+			}
+			tracker.start(msgs[i])
+		}
+		return msgs
+	}
+
+	It("should mark messages done in order", func() {
+		msgs := consumed(0, 1, 2)
+		Expect(tracker.done(msgs[0])).To(Equal(msgs[0]))
+		Expect(tracker.done(msgs[1])).To(Equal(msgs[1]))
+	})
+
+	It("should not mark past messages still in flight", func() {
+		msgs := consumed(0, 1, 2, 3)
+		Expect(tracker.done(msgs[2])).To(BeNil())
+		Expect(tracker.done(msgs[1])).To(BeNil())
+		Expect(tracker.done(msgs[0])).To(Equal(msgs[2]))
+	})
+
+	It("should track partitions independently", func() {
+		p0 := consumed(0, 1, 2)
+		p1 := consumed(1, 1)
+		Expect(tracker.done(p0[1])).To(BeNil())
+		Expect(tracker.done(p1[0])).To(Equal(p1[0]))
+		Expect(tracker.done(p0[0])).To(Equal(p0[1]))
+	})
+
+	It("should forget messages in flight when a partition is consumed again", func() {
+		consumed(0, 1, 2)
+		msgs := consumed(0, 1)
+		Expect(tracker.done(msgs[0])).To(Equal(msgs[0]))
+	})
+
+	It("should ignore messages that were not started", func() {
+		msg := &sarama.ConsumerMessage{Topic: "test.events", Offset: 1}
+		Expect(tracker.done(msg)).To(BeNil())
+	})
+})
@@ -0,0 +1,127 @@
+package kafka
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/TerrexTech/go-kafkautils/consumer"
+	"github.com/TerrexTech/go-kafkautils/producer"
+	"github.com/pkg/errors"
+)
+
+// ReplayConfig configures ReplayDeadLetters.
+type ReplayConfig struct {
+	// ConsumerGroup commits the offsets of replayed DeadLetters, so each
+	// DeadLetter is only replayed once.
+	ConsumerGroup string
+	// MaxAttempts skips DeadLetters which were attempted as many times.
+	// DeadLetters are never skipped if 0.
+	MaxAttempts int
+	// IdleTimeout ends the replay once no DeadLetter is received for as long.
+	IdleTimeout time.Duration
+}
+
+// ReplayDeadLetters re-produces the original values of the DeadLetters in the
+// DeadLetterTopic to their topics, such as once a fix for the failures has
+// been deployed. Returns the number of replayed DeadLetters once the
+// DeadLetterTopic is idle.
+func (ka *Adapter) ReplayDeadLetters(config ReplayConfig) (int, error) {
+	if ka.DeadLetterTopic == "" {
+		return 0, errors.New("DeadLetterTopic is required to replay DeadLetters")
+	}
+
+	saramaCfg, err := ka.consumerConfig()
+	if err != nil {
+		return 0, err
+	}
+	// All DeadLetters not yet replayed by the ConsumerGroup are replayed
+	saramaCfg.Consumer.Offsets.Initial = sarama.OffsetOldest
+	dlConsumer, err := consumer.New(&consumer.Config{
+		ConsumerGroup: config.ConsumerGroup,
+		KafkaBrokers:  ka.Brokers,
+		SaramaConfig:  saramaCfg,
+		Topics:        []string{ka.DeadLetterTopic},
+	})
+	if err != nil {
+		err = errors.Wrap(err, "Error Creating DeadLetter Consumer")
+		return 0, err
+	}
+	defer dlConsumer.Close()
+
+	replayProducer, err := ka.responseProducer(ka.Brokers)
+	if err != nil {
+		err = errors.Wrap(err, "Error Creating Replay Producer")
+		return 0, err
+	}
+	defer replayProducer.Close()
+	input, err := replayProducer.Input()
+	if err != nil {
+		err = errors.Wrap(err, "Error Getting Input-Channel from Producer")
+		return 0, err
+	}
+
+	// The producer is closed once the retries and DeadLetters of failed
+	// replays were sent to its input
+	pending := &pendingSends{}
+	replayed := 0
+	idle := time.NewTimer(config.IdleTimeout)
+	defer idle.Stop()
+	for {
+		select {
+		case msg, ok := <-dlConsumer.Messages():
+			if !ok {
+				ka.awaitPending(input, replayProducer.Errors(), pending)
+				log.Printf("DeadLetter Consumer closed, replayed %d DeadLetters", replayed)
+				return replayed, nil
+			}
+			replayMsg, err := replayMessage(msg, config.MaxAttempts)
+			if err != nil {
+				err = errors.Wrapf(err, "Skipping DeadLetter at offset %d", msg.Offset)
+				ka.handleError(err)
+			} else {
+				input <- replayMsg
+				replayed++
+			}
+			dlConsumer.MarkOffset(msg, "")
+
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(config.IdleTimeout)
+
+		case err := <-dlConsumer.Errors():
+			err = errors.Wrap(err, "Error consuming DeadLetters")
+			ka.handleError(err)
+
+		case prodErr := <-replayProducer.Errors():
+			ka.handleProducerError(input, prodErr, pending)
+
+		case <-idle.C:
+			ka.awaitPending(input, replayProducer.Errors(), pending)
+			log.Printf("Replayed %d DeadLetters", replayed)
+			return replayed, nil
+		}
+	}
+}
+
+// replayMessage creates the message re-producing the original value of the
+// DeadLetter to its topic. Returns an error if the DeadLetter cannot be
+// replayed.
+func replayMessage(msg *sarama.ConsumerMessage, maxAttempts int) (*sarama.ProducerMessage, error) {
+	dl := DeadLetter{}
+	err := json.Unmarshal(msg.Value, &dl)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error unmarshalling DeadLetter")
+	}
+	if dl.Topic == "" {
+		return nil, errors.New("DeadLetter has no topic")
+	}
+	if maxAttempts > 0 && dl.Attempts >= maxAttempts {
+		return nil, errors.Errorf(
+			"DeadLetter was attempted %d times: %s", dl.Attempts, dl.Error,
+		)
+	}
+	return producer.CreateMessage(dl.Topic, dl.Value), nil
+}
@@ -0,0 +1,164 @@
+package kafka
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/TerrexTech/go-eventstore-models/model"
+	"github.com/TerrexTech/uuuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	// KeyByCorrelationID keys responses by their CorrelationID, so all
+	// responses to a request land on the same partition. Responses without a
+	// CorrelationID are keyed by their AggregateID.
+	KeyByCorrelationID = "correlation_id"
+	// KeyByAggregateID keys responses by their AggregateID.
+	KeyByAggregateID = "aggregate_id"
+)
+
+// Headers of produced responses. Headers require Adapter.Version to be at
+// least 0.11.0, which the DefaultVersion is, and are not produced otherwise.
+const (
+	HeaderContentType   = "content-type"
+	HeaderSchemaVersion = "schema-version"
+	HeaderReportType    = "report-type"
+	HeaderTenant        = "tenant"
+	// HeaderResultType is the content-type of the Result of the response.
+	HeaderResultType = "result-content-type"
+
+	// ContentTypeJSON is the content-type of JSON-encoded responses.
+	ContentTypeJSON = "application/json"
+	// SchemaVersion is the version of the KafkaResponse schema of responses.
+	SchemaVersion = "1"
+)
+
+// Response is a KafkaResponse with metadata, which is produced as the
+// headers of its message.
+type Response struct {
+	*model.KafkaResponse
+	// ReportType is the report-type the response is the result of, if any.
+	ReportType string
+	// Tenant is the tenant the response is restricted to, if any.
+	Tenant string
+	// ResultType is the content-type of the Result, if known.
+	ResultType string
+}
+
+// validateKeyBy returns an error if the Adapter's KeyBy is unknown.
+func (ka *Adapter) validateKeyBy() error {
+	switch ka.KeyBy {
+	case "", KeyByCorrelationID, KeyByAggregateID:
+		return nil
+	}
+	return errors.Errorf("Unknown KeyBy: %s", ka.KeyBy)
+}
+
+// produceResponse produces the response, in chunks if configured, to its
+// Topic or else the ProducerTopic. Responses that cannot be encoded are
+// dead-lettered.
+func (ka *Adapter) produceResponse(
+	input chan<- *sarama.ProducerMessage,
+	resp *Response,
+	withHeaders bool,
+) {
+	msg := resp.KafkaResponse
+	topic := ka.ProducerTopic
+	if msg.Topic != "" {
+		topic = msg.Topic
+	}
+
+	fail := func(err error, value []byte) {
+		err = errors.Wrapf(
+			err, "Error encoding KafkaResponse for CorrelationID %s", msg.CorrelationID,
+		)
+		ka.handleError(err)
+		ka.deadLetter(input, &DeadLetter{
+			Topic:     topic,
+			Error:     err.Error(),
+			Attempts:  1,
+			Timestamp: time.Now().Unix(),
+			Value:     value,
+		})
+	}
+
+	parts, err := ka.SplitResponse(msg)
+	if err != nil {
+		fail(errors.Wrap(err, "Error chunking Result"), msg.Result)
+		return
+	}
+	for _, part := range parts {
+		partJSON, err := json.Marshal(part)
+		if err != nil {
+			fail(errors.Wrap(err, "Error Marshalling KafkaResponse"), part.Result)
+			return
+		}
+		partResp := *resp
+		partResp.KafkaResponse = part
+		input <- ka.responseMessage(topic, &partResp, partJSON, withHeaders)
+	}
+}
+
+// headersSupported returns whether the configured Version supports message
+// headers.
+func (ka *Adapter) headersSupported() bool {
+	version, err := ka.kafkaVersion()
+	if err != nil {
+		return false
+	}
+	return version.IsAtLeast(sarama.V0_11_0_0)
+}
+
+// responseMessage creates the message of the JSON-encoded response, with
+// its key and, if withHeaders is set, its headers.
+func (ka *Adapter) responseMessage(
+	topic string,
+	resp *Response,
+	value []byte,
+	withHeaders bool,
+) *sarama.ProducerMessage {
+	msg := &sarama.ProducerMessage{
+		Topic: topic,
+		Key:   sarama.StringEncoder(ka.responseKey(resp.KafkaResponse)),
+		Value: sarama.ByteEncoder(value),
+	}
+	if !withHeaders {
+		return msg
+	}
+
+	headers := map[string]string{
+		HeaderContentType:   ContentTypeJSON,
+		HeaderSchemaVersion: SchemaVersion,
+		HeaderReportType:    resp.ReportType,
+		HeaderTenant:        resp.Tenant,
+		HeaderResultType:    resp.ResultType,
+	}
+	// Headers are ordered for consistent messages
+	for _, key := range []string{
+		HeaderContentType, HeaderSchemaVersion, HeaderReportType, HeaderTenant,
+		HeaderResultType,
+	} {
+		if headers[key] != "" {
+			msg.Headers = append(msg.Headers, sarama.RecordHeader{
+				Key:   []byte(key),
+				Value: []byte(headers[key]),
+			})
+		}
+	}
+	return msg
+}
+
+// responseKey returns the message-key of the response as per KeyBy.
+func (ka *Adapter) responseKey(resp *model.KafkaResponse) string {
+	aggregateKey := strconv.Itoa(int(resp.AggregateID))
+	if ka.KeyBy == KeyByAggregateID {
+		return aggregateKey
+	}
+	if resp.CorrelationID == (uuuid.UUID{}) {
+		return aggregateKey
+	}
+	return resp.CorrelationID.String()
+}
@@ -0,0 +1,87 @@
+package kafka
+
+import (
+	"github.com/Shopify/sarama"
+	"github.com/TerrexTech/go-eventstore-models/model"
+	"github.com/TerrexTech/uuuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Response messages", func() {
+	var (
+		adapter *Adapter
+		resp    *Response
+	)
+
+	BeforeEach(func() {
+		adapter = &Adapter{}
+		correlationID, err := uuuid.NewV4()
+		Expect(err).ToNot(HaveOccurred())
+		resp = &Response{
+			KafkaResponse: &model.KafkaResponse{
+				AggregateID:   4,
+				CorrelationID: correlationID,
+			},
+			ReportType: "comparison",
+			Tenant:     "store-1",
+			ResultType: "text/csv",
+		}
+	})
+
+	headersOf := func(msg *sarama.ProducerMessage) map[string]string {
+		headers := map[string]string{}
+		for _, h := range msg.Headers {
+			headers[string(h.Key)] = string(h.Value)
+		}
+		return headers
+	}
+
+	It("should key responses by CorrelationID", func() {
+		msg := adapter.responseMessage("test.response", resp, []byte("{}"), false)
+		Expect(msg.Topic).To(Equal("test.response"))
+		Expect(msg.Key).To(Equal(sarama.StringEncoder(resp.CorrelationID.String())))
+		Expect(msg.Headers).To(BeEmpty())
+	})
+
+	It("should key responses without CorrelationID by AggregateID", func() {
+		resp.CorrelationID = uuuid.UUID{}
+		msg := adapter.responseMessage("test.response", resp, []byte("{}"), false)
+		Expect(msg.Key).To(Equal(sarama.StringEncoder("4")))
+
+		adapter.KeyBy = KeyByAggregateID
+		resp.CorrelationID, _ = uuuid.NewV4()
+		msg = adapter.responseMessage("test.response", resp, []byte("{}"), false)
+		Expect(msg.Key).To(Equal(sarama.StringEncoder("4")))
+	})
+
+	It("should add the metadata as headers", func() {
+		msg := adapter.responseMessage("test.response", resp, []byte("{}"), true)
+		Expect(headersOf(msg)).To(Equal(map[string]string{
+			HeaderContentType:   ContentTypeJSON,
+			HeaderSchemaVersion: SchemaVersion,
+			HeaderReportType:    "comparison",
+			HeaderTenant:        "store-1",
+			HeaderResultType:    "text/csv",
+		}))
+
+		resp.Tenant = ""
+		msg = adapter.responseMessage("test.response", resp, []byte("{}"), true)
+		Expect(headersOf(msg)).ToNot(HaveKey(HeaderTenant))
+	})
+
+	It("should only produce headers for Kafka 0.11.0 or later", func() {
+		// The DefaultVersion supports headers
+		Expect(adapter.headersSupported()).To(BeTrue())
+		adapter.Version = "0.10.2.0"
+		Expect(adapter.headersSupported()).To(BeFalse())
+		adapter.Version = "1.0.0"
+		Expect(adapter.headersSupported()).To(BeTrue())
+	})
+
+	It("should reject unknown KeyBy", func() {
+		Expect(adapter.validateKeyBy()).To(Succeed())
+		adapter.KeyBy = "tenant"
+		Expect(adapter.validateKeyBy()).ToNot(Succeed())
+	})
+})
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	esmodel "github.com/TerrexTech/go-eventstore-models/model"
+	"github.com/TerrexTech/go-report-productsold/kafka"
+	"github.com/TerrexTech/go-report-productsold/report"
+	"github.com/pkg/errors"
+)
+
+// alertRetention is how long published anomalies are remembered. It exceeds
+// the day of history checked for anomalies, so anomalies are never
+// published twice.
+const alertRetention = 72 * time.Hour
+
+// alertKey identifies an anomaly across checks.
+func alertKey(anomaly report.Anomaly) string {
+	return fmt.Sprintf(
+		"%s/%d/%s/%s/%d",
+		anomaly.Source,
+		anomaly.SKU,
+		anomaly.DeviceID,
+		anomaly.Field,
+		anomaly.Timestamp,
+	)
+}
+
+// anomalyAlerter periodically detects anomalies and publishes each one
+// once, as a KafkaResponse on the alert-topic. Published anomalies are
+// recorded in the Alertdb until they are older than the alertRetention, so
+// they are not published again after restarts.
+type anomalyAlerter struct {
+	env     *Env
+	topic   string
+	produce publisher
+	now     func() time.Time
+}
+
+// runAnomalyAlerts checks for anomalies every interval until the process
+// exits. The first check runs immediately.
+func runAnomalyAlerts(
+	env *Env,
+	interval time.Duration,
+	topic string,
+	publish publisher,
+) {
+	alerter := &anomalyAlerter{
+		env:     env,
+		topic:   topic,
+		produce: publish,
+		now:     time.Now,
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		alerter.check()
+		<-ticker.C
+	}
+}
+
+func (a *anomalyAlerter) check() {
+	// Anomalies older than the retention are no longer recorded
+	expiry := a.now().Add(-alertRetention).Unix()
+
+	for _, source := range []string{report.SourceSales, report.SourceSensors} {
+		anomalies, err := a.env.Inventorydb.Anomalies(
+			a.env.Metricdb,
+			report.AnomalyParams{
+				Source: source,
+				// Sales-anomalies are only known once the day completes
+				HistoryDays: 1,
+			},
+		)
+		if err != nil {
+			err = errors.Wrapf(err, "Error detecting %s anomalies", source)
+			log.Println(err)
+			continue
+		}
+
+		for _, anomaly := range anomalies {
+			if anomaly.Timestamp < expiry {
+				continue
+			}
+			// The anomaly is recorded before publishing, so concurrent
+			// instances don't both publish it
+			expiresAt := time.Unix(anomaly.Timestamp, 0).Add(alertRetention)
+			isNew, err := a.env.Alertdb.RecordAlert(alertKey(anomaly), expiresAt)
+			if err != nil {
+				err = errors.Wrap(err, "Error recording anomaly-alert")
+				log.Println(err)
+				continue
+			}
+			if !isNew {
+				continue
+			}
+			err = a.publish(anomaly)
+			if err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+func (a *anomalyAlerter) publish(anomaly report.Anomaly) error {
+	alert, err := json.Marshal(anomaly)
+	if err != nil {
+		return errors.Wrap(err, "Error marshalling anomaly-alert")
+	}
+
+	a.produce(&kafka.Response{
+		KafkaResponse: &esmodel.KafkaResponse{
+			AggregateID: 4,
+			Result:      alert,
+			Topic:       a.topic,
+		},
+		ReportType: "anomalies",
+	})
+	return nil
+}
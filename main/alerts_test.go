@@ -0,0 +1,131 @@
+package main
+
+import (
+	"time"
+
+	"github.com/TerrexTech/go-report-productsold/kafka"
+	"github.com/TerrexTech/go-report-productsold/report"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// anomalyDB is a report.DBI returning fixed anomalies per source.
+type anomalyDB struct {
+	report.DBI
+	anomalies map[string][]report.Anomaly
+}
+
+func (db *anomalyDB) Anomalies(
+	metricDB report.DBI,
+	params report.AnomalyParams,
+) ([]report.Anomaly, error) {
+	return db.anomalies[params.Source], nil
+}
+
+// alertDB is a report.DBI recording alerts in memory.
+type alertDB struct {
+	report.DBI
+	expiries map[string]time.Time
+}
+
+func (db *alertDB) RecordAlert(key string, expiresAt time.Time) (bool, error) {
+	if _, isRecorded := db.expiries[key]; isRecorded {
+		return false, nil
+	}
+	db.expiries[key] = expiresAt
+	return true, nil
+}
+
+var _ = Describe("Anomaly alerts", func() {
+	var (
+		db        *anomalyDB
+		alerts    *alertDB
+		alerter   *anomalyAlerter
+		now       time.Time
+		published []*kafka.Response
+	)
+
+	BeforeEach(func() {
+		now = time.Date(2018, 10, 17, 12, 0, 0, 0, time.UTC)
+		published = nil
+		db = &anomalyDB{
+			anomalies: map[string][]report.Anomaly{},
+		}
+		alerts = &alertDB{
+			expiries: map[string]time.Time{},
+		}
+		alerter = &anomalyAlerter{
+			env:   &Env{Inventorydb: db, Alertdb: alerts},
+			topic: "alerts",
+			produce: func(resp *kafka.Response) {
+				published = append(published, resp)
+			},
+			now: func() time.Time {
+				return now
+			},
+		}
+	})
+
+	It("should publish each anomaly once", func() {
+		hourAgo := now.Add(-time.Hour).Unix()
+		db.anomalies[report.SourceSensors] = []report.Anomaly{
+			{Source: report.SourceSensors, DeviceID: "a", Field: "ethylene", Timestamp: hourAgo},
+		}
+		alerter.check()
+		alerter.check()
+		Expect(published).To(HaveLen(1))
+		Expect(published[0].Topic).To(Equal("alerts"))
+	})
+
+	It("should publish anomalies of other subjects and late readings", func() {
+		hourAgo := now.Add(-time.Hour).Unix()
+		db.anomalies[report.SourceSensors] = []report.Anomaly{
+			{Source: report.SourceSensors, DeviceID: "a", Field: "ethylene", Timestamp: hourAgo},
+		}
+		alerter.check()
+
+		// Same time on another device and field, and an earlier late reading
+		db.anomalies[report.SourceSensors] = []report.Anomaly{
+			{Source: report.SourceSensors, DeviceID: "a", Field: "ethylene", Timestamp: hourAgo - 600},
+			{Source: report.SourceSensors, DeviceID: "a", Field: "ethylene", Timestamp: hourAgo},
+			{Source: report.SourceSensors, DeviceID: "a", Field: "temp_in", Timestamp: hourAgo},
+			{Source: report.SourceSensors, DeviceID: "b", Field: "ethylene", Timestamp: hourAgo},
+		}
+		db.anomalies[report.SourceSales] = []report.Anomaly{
+			{Source: report.SourceSales, SKU: 1, Field: "sold_weight", Timestamp: hourAgo},
+		}
+		alerter.check()
+		Expect(published).To(HaveLen(5))
+	})
+
+	It("should not publish anomalies recorded before a restart", func() {
+		hourAgo := now.Add(-time.Hour).Unix()
+		db.anomalies[report.SourceSales] = []report.Anomaly{
+			{Source: report.SourceSales, SKU: 1, Field: "sold_weight", Timestamp: hourAgo},
+		}
+		alerter.check()
+
+		restarted := &anomalyAlerter{
+			env:     alerter.env,
+			topic:   "alerts",
+			produce: alerter.produce,
+			now:     alerter.now,
+		}
+		restarted.check()
+		Expect(published).To(HaveLen(1))
+	})
+
+	It("should record anomalies until they are older than the retention", func() {
+		hourAgo := now.Add(-time.Hour)
+		db.anomalies[report.SourceSales] = []report.Anomaly{
+			{Source: report.SourceSales, SKU: 1, Field: "sold_weight", Timestamp: hourAgo.Unix()},
+			// Older than the retention
+			{Source: report.SourceSales, SKU: 2, Field: "sold_weight", Timestamp: now.Add(-alertRetention - time.Hour).Unix()},
+		}
+		alerter.check()
+		Expect(published).To(HaveLen(1))
+		Expect(alerts.expiries).To(HaveLen(1))
+		expiresAt := alerts.expiries[alertKey(db.anomalies[report.SourceSales][0])]
+		Expect(expiresAt).To(BeTemporally("==", hourAgo.Add(alertRetention)))
+	})
+})
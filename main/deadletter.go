@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TerrexTech/go-commonutils/commonutil"
+	esmodel "github.com/TerrexTech/go-eventstore-models/model"
+	"github.com/TerrexTech/go-report-productsold/codec"
+	"github.com/TerrexTech/go-report-productsold/kafka"
+	"github.com/TerrexTech/go-report-productsold/report"
+	"github.com/pkg/errors"
+)
+
+// invalidQueryCode is the ErrorCode of responses to query-events that can
+// never succeed.
+const invalidQueryCode = 400
+
+// errInvalidQuery is the cause of errors from query-events that are not a
+// single known report-type.
+var errInvalidQuery = errors.New("Invalid query")
+
+// queryDeadLetters dead-letters query-events which can never succeed, such as
+// those with malformed data, so they can be replayed once fixed.
+type queryDeadLetters struct {
+	// topic is the topic query-events are consumed from, which replayed
+	// DeadLetters are re-produced to.
+	topic   string
+	letters chan<- *kafka.DeadLetter
+
+	lock sync.Mutex
+	// attempts counts the failures of each event since the service started,
+	// so replayed events that fail again are dead-lettered with more attempts.
+	attempts map[string]int
+}
+
+func newQueryDeadLetters(topic string, letters chan<- *kafka.DeadLetter) *queryDeadLetters {
+	return &queryDeadLetters{
+		topic:    topic,
+		letters:  letters,
+		attempts: map[string]int{},
+	}
+}
+
+// deadLetter produces a DeadLetter of the event, with the event as the
+// original payload. Events are dropped if dead-lettering is not configured.
+func (q *queryDeadLetters) deadLetter(event esmodel.Event, err error) {
+	if q == nil {
+		return
+	}
+	value, mErr := json.Marshal(event)
+	if mErr != nil {
+		mErr = errors.Wrap(mErr, "Error marshalling event for DeadLetter")
+		log.Println(mErr)
+		return
+	}
+
+	q.lock.Lock()
+	key := event.UUID.String()
+	q.attempts[key]++
+	attempts := q.attempts[key]
+	q.lock.Unlock()
+
+	q.letters <- &kafka.DeadLetter{
+		Topic:     q.topic,
+		Error:     err.Error(),
+		Attempts:  attempts,
+		Timestamp: time.Now().Unix(),
+		Value:     value,
+	}
+}
+
+// isPoison returns whether a query failed for reasons retrying cannot fix,
+// such as malformed JSON, invalid SearchParams or report-parameters, or
+// unknown encodings.
+func isPoison(err error) bool {
+	cause := errors.Cause(err)
+	switch cause.(type) {
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		return true
+	}
+	return cause == errInvalidQuery ||
+		cause == report.ErrInvalidSearchParam ||
+		cause == report.ErrInvalidParams ||
+		cause == codec.ErrUnknownEncoding
+}
+
+// poisonResponse dead-letters query-events that failed for reasons retrying
+// cannot fix, and responds to them with the error. Returns nil for other
+// errors.
+func poisonResponse(env *Env, event esmodel.Event, err error) *esmodel.KafkaResponse {
+	if !isPoison(err) {
+		return nil
+	}
+	env.QueryDeadLetters.deadLetter(event, err)
+
+	return &esmodel.KafkaResponse{
+		AggregateID:   event.AggregateID,
+		CorrelationID: event.CorrelationID,
+		Error:         err.Error(),
+		ErrorCode:     invalidQueryCode,
+	}
+}
+
+// runDeadLetterReplay re-produces the dead-lettered events to the topics
+// they were consumed from.
+func runDeadLetterReplay() error {
+	missingVar, err := commonutil.ValidateEnv(
+		"KAFKA_PRODUCER_DEADLETTER_TOPIC",
+		"KAFKA_CONSUMER_DEADLETTER_REPLAY_GROUP",
+	)
+	if err != nil {
+		return errors.Errorf(
+			"Environment variable %s is required but was not found", missingVar,
+		)
+	}
+
+	maxAttempts := 0
+	if max := os.Getenv("DEADLETTER_MAX_ATTEMPTS"); max != "" {
+		maxAttempts, err = strconv.Atoi(max)
+		if err != nil {
+			return errors.Wrap(err, "Error parsing DEADLETTER_MAX_ATTEMPTS")
+		}
+	}
+	idleTimeout := 10 * time.Second
+	if t := os.Getenv("DEADLETTER_REPLAY_IDLE_TIMEOUT"); t != "" {
+		idleTimeout, err = time.ParseDuration(t)
+		if err != nil {
+			return errors.Wrap(err, "Error parsing DEADLETTER_REPLAY_IDLE_TIMEOUT")
+		}
+	}
+
+	adapter, err := kafkaAdapterFromEnv()
+	if err != nil {
+		return errors.Wrap(err, "Error configuring KafkaAdapter")
+	}
+	_, err = adapter.ReplayDeadLetters(kafka.ReplayConfig{
+		ConsumerGroup: os.Getenv("KAFKA_CONSUMER_DEADLETTER_REPLAY_GROUP"),
+		MaxAttempts:   maxAttempts,
+		IdleTimeout:   idleTimeout,
+	})
+	return err
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"github.com/TerrexTech/go-eventspoll/poll"
+	esmodel "github.com/TerrexTech/go-eventstore-models/model"
+	"github.com/TerrexTech/go-report-productsold/kafka"
+	"github.com/TerrexTech/go-report-productsold/report"
+	"github.com/TerrexTech/uuuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+var _ = Describe("Query dead-letters", func() {
+	var (
+		env     *Env
+		letters chan *kafka.DeadLetter
+	)
+
+	BeforeEach(func() {
+		letters = make(chan *kafka.DeadLetter, 1)
+		env = &Env{
+			Inventorydb:      &report.DB{},
+			QueryDeadLetters: newQueryDeadLetters("test.events", letters),
+		}
+	})
+
+	// query handles a query-event with the data.
+	query := func(data string) *esmodel.KafkaResponse {
+		eventID, err := uuuid.NewV4()
+		Expect(err).ToNot(HaveOccurred())
+		return handleQuery(&poll.EventResponse{
+			Event: esmodel.Event{
+				UUID:        eventID,
+				AggregateID: 4,
+				Data:        []byte(data),
+			},
+		}, env)
+	}
+
+	It("should respond to and dead-letter queries with invalid report-parameters", func() {
+		resp := query(`{"ranking":{"metric":"bogus"}}`)
+		Expect(resp).ToNot(BeNil())
+		Expect(resp.ErrorCode).To(Equal(int16(invalidQueryCode)))
+		Expect(resp.Error).To(ContainSubstring("Unknown metric: bogus"))
+
+		var dl *kafka.DeadLetter
+		Expect(letters).To(Receive(&dl))
+		Expect(dl.Topic).To(Equal("test.events"))
+		Expect(dl.Attempts).To(Equal(1))
+	})
+
+	It("should respond to and dead-letter malformed queries", func() {
+		resp := query(`{"ranking":`)
+		Expect(resp).ToNot(BeNil())
+		Expect(resp.ErrorCode).To(Equal(int16(invalidQueryCode)))
+		Expect(letters).To(Receive())
+	})
+
+	It("should only treat errors retrying cannot fix as poison", func() {
+		Expect(isPoison(errors.Wrap(report.ErrInvalidParams, "Unknown metric"))).To(BeTrue())
+		Expect(isPoison(errors.Wrap(report.ErrInvalidSearchParam, "Type required."))).To(BeTrue())
+		Expect(isPoison(errors.New("connection refused"))).To(BeFalse())
+	})
+})
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/TerrexTech/go-report-productsold/codec"
+	"github.com/pkg/errors"
+)
+
+// encodingKey is the key of query-event data which selects the encoding of
+// the result, such as {"ranking": {...}, "encoding": "csv"}. Results are
+// JSON-encoded if it is unset.
+const encodingKey = "encoding"
+
+// queryEncoder removes the encoding from the query, and returns the Encoder
+// it selects.
+func queryEncoder(query map[string]json.RawMessage) (codec.Encoder, error) {
+	raw, exists := query[encodingKey]
+	if !exists {
+		return codec.Lookup(codec.NameJSON)
+	}
+	delete(query, encodingKey)
+
+	var name string
+	err := json.Unmarshal(raw, &name)
+	if err != nil {
+		return nil, errors.Wrap(errInvalidQuery, "Encoding must be a string")
+	}
+	return codec.Lookup(name)
+}
+
+// queryResultType returns the content-type of the result of the query-event
+// data, or an empty string if its encoding is invalid.
+func queryResultType(data []byte) string {
+	var query map[string]json.RawMessage
+	err := json.Unmarshal(data, &query)
+	if err != nil {
+		return ""
+	}
+	encoder, err := queryEncoder(query)
+	if err != nil {
+		return ""
+	}
+	return encoder.ContentType()
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/TerrexTech/go-eventspoll/poll"
+	esmodel "github.com/TerrexTech/go-eventstore-models/model"
+	"github.com/TerrexTech/go-report-productsold/report"
+	"github.com/pkg/errors"
+)
+
+// versionConflictCode is the ErrorCode of responses to events rejected with a
+// report.ErrVersionConflict.
+const versionConflictCode = 409
+
+// eventResult is the Result of the response to an inventory-event.
+type eventResult struct {
+	// Affected is the number of inventory-items changed by the event,
+	// which is 0 for stale or redelivered events.
+	Affected int64 `json:"affected"`
+}
+
+// handleInsert applies an inventory insert-event, where the event-data is
+// the Inventory.
+func handleInsert(eventResp *poll.EventResponse, env *Env) *esmodel.KafkaResponse {
+	if eventResp.Error != nil {
+		err := errors.Wrap(eventResp.Error, "Error in insert-event")
+		log.Println(err)
+		return nil
+	}
+
+	event := eventResp.Event
+	affected, err := applyInsert(env.Inventorydb, event)
+	if err != nil {
+		err = errors.Wrap(err, "Error applying insert-event")
+		log.Println(err)
+		return conflictResponse(event, affected, err)
+	}
+	return eventResponse(event, affected)
+}
+
+// handleUpdate applies an inventory update-event, where the event-data is
+// a report.InventoryUpdate.
+func handleUpdate(eventResp *poll.EventResponse, env *Env) *esmodel.KafkaResponse {
+	if eventResp.Error != nil {
+		err := errors.Wrap(eventResp.Error, "Error in update-event")
+		log.Println(err)
+		return nil
+	}
+
+	event := eventResp.Event
+	affected, err := applyUpdate(env.Inventorydb, event)
+	if err != nil {
+		err = errors.Wrap(err, "Error applying update-event")
+		log.Println(err)
+		return conflictResponse(event, affected, err)
+	}
+	return eventResponse(event, affected)
+}
+
+// handleDelete applies an inventory delete-event, where the event-data is
+// the filter of the inventory to delete.
+func handleDelete(eventResp *poll.EventResponse, env *Env) *esmodel.KafkaResponse {
+	if eventResp.Error != nil {
+		err := errors.Wrap(eventResp.Error, "Error in delete-event")
+		log.Println(err)
+		return nil
+	}
+
+	event := eventResp.Event
+	affected, err := applyDelete(env.Inventorydb, event)
+	if err != nil {
+		err = errors.Wrap(err, "Error applying delete-event")
+		log.Println(err)
+		return conflictResponse(event, affected, err)
+	}
+	return eventResponse(event, affected)
+}
+
+// applyEvent applies an inventory-event to the projections of db, by its
+// action. Returns the number of inventory-items changed.
+func applyEvent(db report.DBI, event esmodel.Event) (int64, error) {
+	switch event.Action {
+	case "insert":
+		return applyInsert(db, event)
+	case "update":
+		return applyUpdate(db, event)
+	case "delete":
+		return applyDelete(db, event)
+	}
+	return 0, errors.Errorf("Unknown event-action: %s", event.Action)
+}
+
+func applyInsert(db report.DBI, event esmodel.Event) (int64, error) {
+	inv := &report.Inventory{}
+	err := json.Unmarshal(event.Data, inv)
+	if err != nil {
+		return 0, errors.Wrap(err, "Error unmarshalling Inventory")
+	}
+
+	inserted, err := db.InsertInventory(inv, event.Version)
+	if err != nil || !inserted {
+		return 0, err
+	}
+	return 1, nil
+}
+
+func applyUpdate(db report.DBI, event esmodel.Event) (int64, error) {
+	var update report.InventoryUpdate
+	err := json.Unmarshal(event.Data, &update)
+	if err != nil {
+		return 0, errors.Wrap(err, "Error unmarshalling InventoryUpdate")
+	}
+	return db.UpdateInventory(update, event.Version)
+}
+
+func applyDelete(db report.DBI, event esmodel.Event) (int64, error) {
+	var filter map[string]interface{}
+	err := json.Unmarshal(event.Data, &filter)
+	if err != nil {
+		return 0, errors.Wrap(err, "Error unmarshalling delete-filter")
+	}
+	return db.DeleteInventory(filter, event.Version)
+}
+
+// conflictResponse responds to events rejected with a report.ErrVersionConflict,
+// so the conflict is visible to the producer of the event. Returns nil for
+// other errors.
+func conflictResponse(event esmodel.Event, affected int64, err error) *esmodel.KafkaResponse {
+	if errors.Cause(err) != report.ErrVersionConflict {
+		return nil
+	}
+	resp := eventResponse(event, affected)
+	if resp != nil {
+		resp.Error = err.Error()
+		resp.ErrorCode = versionConflictCode
+	}
+	return resp
+}
+
+func eventResponse(event esmodel.Event, affected int64) *esmodel.KafkaResponse {
+	result, err := json.Marshal(eventResult{
+		Affected: affected,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "Error marshalling event-result")
+		log.Println(err)
+		return nil
+	}
+
+	return &esmodel.KafkaResponse{
+		AggregateID:   event.AggregateID,
+		CorrelationID: event.CorrelationID,
+		Result:        result,
+	}
+}
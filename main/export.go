@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/TerrexTech/go-report-productsold/codec"
+	"github.com/TerrexTech/go-report-productsold/export"
+	"github.com/pkg/errors"
+)
+
+// exportConfig is the configuration of the export-subcommand.
+type exportConfig struct {
+	// query is the report-query, as the data of query-events.
+	query  map[string]json.RawMessage
+	path   string
+	format string
+	opts   export.Options
+}
+
+// parseExport parses the arguments of the export-subcommand, such as:
+//
+//	export -query '{"comparison": {"range": "last_month"}}' -out sold.xlsx
+func parseExport(args []string) (*exportConfig, error) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	query := fs.String("query", "", "The report-query, as the data of query-events")
+	queryFile := fs.String("query-file", "", "File with the report-query, instead of -query")
+	tenant := fs.String("tenant", "", "Restrict the report to the rs_customer_id")
+	out := fs.String("out", "", "Path of the exported file")
+	format := fs.String("format", "", "csv, xlsx or parquet. Defaults to the extension of -out")
+	columns := fs.String("columns", "", "Comma-separated columns to export in order. Defaults to all")
+	precision := fs.Int("precision", 0, "Decimals floats are rounded to. Zero keeps full precision")
+	timeColumns := fs.String(
+		"time-columns", "",
+		"Comma-separated columns of Unix timestamps to export as formatted times",
+	)
+	timeLayout := fs.String("time-layout", time.RFC3339, "Go time-layout of -time-columns")
+	timeZone := fs.String("time-zone", "UTC", "IANA time-zone of -time-columns")
+	delimiter := fs.String("delimiter", ",", "Field-delimiter of CSV")
+	noHeader := fs.Bool("no-header", false, "Omit the header-row of CSV and XLSX")
+	fs.Parse(args)
+
+	if *out == "" {
+		return nil, errors.New("-out is required")
+	}
+	config := &exportConfig{
+		path:   *out,
+		format: *format,
+	}
+	if config.format == "" {
+		var err error
+		config.format, err = export.FormatOf(*out)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error detecting export-format, set -format")
+		}
+	}
+
+	queryJSON := []byte(*query)
+	if *queryFile != "" {
+		var err error
+		queryJSON, err = ioutil.ReadFile(*queryFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error reading query-file")
+		}
+	}
+	err := json.Unmarshal(queryJSON, &config.query)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error unmarshalling query")
+	}
+	// Files are encoded as per the export-format
+	delete(config.query, encodingKey)
+	if len(config.query) != 1 {
+		return nil, errors.New("Query must contain exactly one report-type")
+	}
+	if *tenant != "" {
+		for reportType, params := range config.query {
+			config.query[reportType], err = scopeToTenant(reportType, params, *tenant)
+			if err != nil {
+				return nil, errors.Wrap(err, "Error scoping query to tenant")
+			}
+		}
+	}
+
+	location, err := time.LoadLocation(*timeZone)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid time-zone")
+	}
+	delimiterRunes := []rune(*delimiter)
+	if len(delimiterRunes) != 1 {
+		return nil, errors.New("Delimiter must be a single character")
+	}
+	config.opts = export.Options{
+		Columns:     splitList(*columns),
+		Precision:   *precision,
+		TimeColumns: splitList(*timeColumns),
+		TimeLayout:  *timeLayout,
+		Location:    location,
+		Delimiter:   delimiterRunes[0],
+		NoHeader:    *noHeader,
+	}
+	return config, nil
+}
+
+// runExport runs the report of the export-config, and writes its result to
+// the export-file.
+func runExport(env *Env, config *exportConfig) error {
+	result, err := runReport(env, config.query)
+	if err != nil {
+		return errors.Wrap(err, "Error running report")
+	}
+	table, err := codec.Tabulate(result)
+	if err != nil {
+		return errors.Wrap(err, "Error tabulating report-result")
+	}
+	err = export.WriteFile(config.path, config.format, table, config.opts)
+	if err != nil {
+		return err
+	}
+	log.Printf("Exported %d rows to %s", len(table.Rows), config.path)
+	return nil
+}
+
+// splitList splits the comma-separated list, dropping empty items.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
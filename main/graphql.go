@@ -0,0 +1,625 @@
+package main
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/TerrexTech/go-report-productsold/report"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/pkg/errors"
+)
+
+// graphqlTenantKey is the context-key of the tenant GraphQL-requests are
+// scoped to. Requests without a tenant may query all tenants.
+type graphqlTenantKey struct{}
+
+// graphqlTenant returns the tenant the request of the context is scoped to.
+func graphqlTenant(ctx context.Context) string {
+	tenant, _ := ctx.Value(graphqlTenantKey{}).(string)
+	return tenant
+}
+
+// newGraphQLSchema returns the GraphQL-schema over the inventory,
+// flash-sales and metrics of the Env. Inventory-items link to their
+// flash-sales and metrics, and these to their inventory-items, so related
+// reports are fetched in one request.
+func newGraphQLSchema(env *Env) (graphql.Schema, error) {
+	listOf := func(t graphql.Type) graphql.Output {
+		return graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(t)))
+	}
+
+	searchParam := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:        "SearchParam",
+		Description: "Filters documents, the same as the SearchParams of query-events.",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"field": &graphql.InputObjectFieldConfig{
+				Type: graphql.NewNonNull(graphql.String),
+			},
+			"type": &graphql.InputObjectFieldConfig{
+				Description: `The type of the field: "string", "int" or "float".`,
+				Type:        graphql.NewNonNull(graphql.String),
+			},
+			"equal":       &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"upper_limit": &graphql.InputObjectFieldConfig{Type: graphql.Float},
+			"lower_limit": &graphql.InputObjectFieldConfig{Type: graphql.Float},
+			"range": &graphql.InputObjectFieldConfig{
+				Description: `A relative date-range, such as "last_7_days".`,
+				Type:        graphql.String,
+			},
+			"from": &graphql.InputObjectFieldConfig{
+				Description: `The start of a date-range, such as "2018-10-01" or "now-30d".`,
+				Type:        graphql.String,
+			},
+			"to": &graphql.InputObjectFieldConfig{
+				Description: "The end of a date-range.",
+				Type:        graphql.String,
+			},
+		},
+	})
+	filtersArg := func(desc string) *graphql.ArgumentConfig {
+		return &graphql.ArgumentConfig{
+			Description: desc,
+			Type:        graphql.NewList(graphql.NewNonNull(searchParam)),
+		}
+	}
+	limitArg := &graphql.ArgumentConfig{
+		Description: "The maximum number of results. All are returned if absent.",
+		Type:        graphql.Int,
+	}
+
+	inventoryFields, err := graphqlFields(report.Inventory{}, "_id")
+	if err != nil {
+		return graphql.Schema{}, errors.Wrap(err, "Error creating Inventory-type")
+	}
+	inventory := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Inventory",
+		Description: "An inventory-item.",
+		Fields:      inventoryFields,
+	})
+	flashFields, err := graphqlFields(report.Flash{}, "_id")
+	if err != nil {
+		return graphql.Schema{}, errors.Wrap(err, "Error creating Flash-type")
+	}
+	flash := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Flash",
+		Description: "A flash-sale of an inventory-item.",
+		Fields:      flashFields,
+	})
+	metricFields, err := graphqlFields(report.Metric{}, "_id")
+	if err != nil {
+		return graphql.Schema{}, errors.Wrap(err, "Error creating Metric-type")
+	}
+	metric := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Metric",
+		Description: "A sensor-reading of an inventory-item.",
+		Fields:      metricFields,
+	})
+
+	// The inventory-item of flash-sales and metrics
+	itemField := &graphql.Field{
+		Description: "The inventory-item, or null if it is not in the inventory.",
+		Type:        inventory,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			var itemID string
+			switch source := p.Source.(type) {
+			case report.Flash:
+				itemID = source.ItemID.String()
+			case report.Metric:
+				itemID = source.ItemID.String()
+			}
+			return graphqlItem(p.Context, env, itemID)
+		},
+	}
+	flash.AddFieldConfig("item", itemField)
+	metric.AddFieldConfig("item", itemField)
+
+	inventory.AddFieldConfig("revenue", &graphql.Field{
+		Description: "The sold-weight at the sale-price if one was set, else the price.",
+		Type:        graphql.NewNonNull(graphql.Float),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			inv := p.Source.(report.Inventory)
+			return inv.Revenue(), nil
+		},
+	})
+	inventory.AddFieldConfig("flash_sales", &graphql.Field{
+		Description: "The flash-sales of the item, latest first.",
+		Type:        listOf(flash),
+		Args: graphql.FieldConfigArgument{
+			"limit": limitArg,
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			inv := p.Source.(report.Inventory)
+			limit, _ := p.Args["limit"].(int)
+			sales, err := env.Flashdb.SearchFlash(
+				[]report.SearchParam{itemIDFilter(inv.ItemID.String())},
+				report.SearchOptions{
+					SortBy: "-timestamp",
+					Limit:  int64(limit),
+				},
+			)
+			return sales, graphqlError(err)
+		},
+	})
+	inventory.AddFieldConfig("metrics", &graphql.Field{
+		Description: "The sensor-readings of the item in the date-range, oldest first. " +
+			"The limit keeps the latest readings.",
+		Type: listOf(metric),
+		Args: graphql.FieldConfigArgument{
+			"range": &graphql.ArgumentConfig{
+				Description: `A relative date-range, such as "last_7_days".`,
+				Type:        graphql.String,
+			},
+			"from": &graphql.ArgumentConfig{
+				Description: `The start of the date-range, such as "now-30d".`,
+				Type:        graphql.String,
+			},
+			"to": &graphql.ArgumentConfig{
+				Description: "The end of the date-range.",
+				Type:        graphql.String,
+			},
+			"limit": limitArg,
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			inv := p.Source.(report.Inventory)
+			params := []report.SearchParam{itemIDFilter(inv.ItemID.String())}
+			timeRange := report.SearchParam{
+				Field: "timestamp",
+				Type:  "int",
+			}
+			timeRange.Range, _ = p.Args["range"].(string)
+			timeRange.From, _ = p.Args["from"].(string)
+			timeRange.To, _ = p.Args["to"].(string)
+			if timeRange.Range != "" || timeRange.From != "" || timeRange.To != "" {
+				params = append(params, timeRange)
+			}
+
+			limit, _ := p.Args["limit"].(int)
+			metrics, err := env.Metricdb.SearchMetrics(params, report.SearchOptions{
+				SortBy: "-timestamp",
+				Limit:  int64(limit),
+			})
+			if err != nil {
+				return nil, graphqlError(err)
+			}
+			// Series are oldest-first, while the limit keeps the latest
+			for i, j := 0, len(metrics)-1; i < j; i, j = i+1, j-1 {
+				metrics[i], metrics[j] = metrics[j], metrics[i]
+			}
+			return metrics, nil
+		},
+	})
+
+	periodFields, err := graphqlFields(report.Period{})
+	if err != nil {
+		return graphql.Schema{}, errors.Wrap(err, "Error creating Period-type")
+	}
+	period := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Period",
+		Description: "A time-range as Unix timestamps, inclusive of start and exclusive of end.",
+		Fields:      periodFields,
+	})
+	soldComparisonFields, err := graphqlFields(report.SoldComparison{})
+	if err != nil {
+		return graphql.Schema{}, errors.Wrap(err, "Error creating SoldComparison-type")
+	}
+	soldComparison := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "SoldComparison",
+		Description: "The sales of a SKU in two periods.",
+		Fields:      soldComparisonFields,
+	})
+	comparisonReport := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "ComparisonReport",
+		Description: "The sales of SKUs in a period and its comparison-period.",
+		Fields: graphql.Fields{
+			"period":            &graphql.Field{Type: graphql.NewNonNull(period)},
+			"comparison_period": &graphql.Field{Type: graphql.NewNonNull(period)},
+			"items":             &graphql.Field{Type: listOf(soldComparison)},
+		},
+	})
+	comparison := graphql.NewEnum(graphql.EnumConfig{
+		Name:        "Comparison",
+		Description: "The period compared against.",
+		Values: graphql.EnumValueConfigMap{
+			report.PreviousPeriod:     &graphql.EnumValueConfig{Value: report.PreviousPeriod},
+			report.SamePeriodLastYear: &graphql.EnumValueConfig{Value: report.SamePeriodLastYear},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"inventory": &graphql.Field{
+				Description: "Searches the inventory.",
+				Type:        listOf(inventory),
+				Args: graphql.FieldConfigArgument{
+					"filters": filtersArg("Filters of the inventory-items."),
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					var filters []report.SearchParam
+					err := decodeGraphQLArg(p.Args["filters"], &filters)
+					if err != nil {
+						return nil, err
+					}
+					return graphqlInventory(p.Context, env, filters)
+				},
+			},
+			"item": &graphql.Field{
+				Description: "The inventory-item, or null if it is not in the inventory.",
+				Type:        inventory,
+				Args: graphql.FieldConfigArgument{
+					"item_id": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return graphqlItem(p.Context, env, p.Args["item_id"].(string))
+				},
+			},
+			"flash_sales": &graphql.Field{
+				Description: "Searches the flash-sales, latest first. Requires an all-tenants API-token.",
+				Type:        listOf(flash),
+				Args: graphql.FieldConfigArgument{
+					"filters": filtersArg("Filters of the flash-sales."),
+					"limit":   limitArg,
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					filters, limit, err := allTenantsSearch(p)
+					if err != nil {
+						return nil, err
+					}
+					sales, err := env.Flashdb.SearchFlash(filters, report.SearchOptions{
+						SortBy: "-timestamp",
+						Limit:  limit,
+					})
+					return sales, graphqlError(err)
+				},
+			},
+			"metrics": &graphql.Field{
+				Description: "Searches the sensor-readings, latest first. Requires an all-tenants API-token.",
+				Type:        listOf(metric),
+				Args: graphql.FieldConfigArgument{
+					"filters": filtersArg("Filters of the sensor-readings."),
+					"limit":   limitArg,
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					filters, limit, err := allTenantsSearch(p)
+					if err != nil {
+						return nil, err
+					}
+					metrics, err := env.Metricdb.SearchMetrics(filters, report.SearchOptions{
+						SortBy: "-timestamp",
+						Limit:  limit,
+					})
+					return metrics, graphqlError(err)
+				},
+			},
+			"sold_comparison": &graphql.Field{
+				Description: "Compares the sold-weight and revenue of SKUs between two periods.",
+				Type:        graphql.NewNonNull(comparisonReport),
+				Args: graphql.FieldConfigArgument{
+					"range":      &graphql.ArgumentConfig{Type: graphql.String},
+					"from":       &graphql.ArgumentConfig{Type: graphql.String},
+					"to":         &graphql.ArgumentConfig{Type: graphql.String},
+					"comparison": &graphql.ArgumentConfig{Type: comparison},
+					"filters":    filtersArg("Filters of the inventory-items in both periods."),
+					"limit":      limitArg,
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					var params report.ComparisonParams
+					err := decodeGraphQLArg(p.Args, &params)
+					if err != nil {
+						return nil, err
+					}
+					params.Filters = scopeFilters(p.Context, params.Filters)
+					result, err := env.Inventorydb.SoldComparison(params)
+					return result, graphqlError(err)
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query: query,
+	})
+}
+
+// graphqlLong is a non-standard scalar of signed 64-bit integers, such as
+// Unix-timestamps and SKUs, which exceed the 32 bits of Int.
+var graphqlLong = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "Long",
+	Description: "The `Long` scalar type represents signed 64-bit integers.",
+	Serialize:   coerceLong,
+	ParseValue:  coerceLong,
+	ParseLiteral: func(valueAST ast.Value) interface{} {
+		intValue, ok := valueAST.(*ast.IntValue)
+		if !ok {
+			return nil
+		}
+		n, err := strconv.ParseInt(intValue.Value, 10, 64)
+		if err != nil {
+			return nil
+		}
+		return n
+	},
+})
+
+// coerceLong converts integers, and floats without fractions, to int64.
+// Returns nil for other values, or values out of range.
+func coerceLong(value interface{}) interface{} {
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() <= math.MaxInt64 {
+			return int64(rv.Uint())
+		}
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+			return int64(f)
+		}
+	}
+	return nil
+}
+
+var (
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	stringerType      = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+)
+
+// graphqlFields returns a field for each json-tagged scalar-field of the
+// struct v, which are resolved from the struct-field by name. Excluded
+// fields, and fields tagged "-", are skipped.
+//
+// Go-types map to GraphQL-types as: bool to Boolean, integers up to 32
+// bits to Int, larger integers to Long, floats to Float, and strings,
+// encoding.TextMarshalers and fmt.Stringers to String. Non-pointer fields
+// are non-null.
+func graphqlFields(v interface{}, exclude ...string) (graphql.Fields, error) {
+	t := reflect.TypeOf(v)
+	excluded := map[string]bool{}
+	for _, f := range exclude {
+		excluded[f] = true
+	}
+
+	fields := graphql.Fields{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" || sf.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if name == "" {
+			name = sf.Name
+		}
+		if excluded[name] {
+			continue
+		}
+
+		fieldType, err := graphqlScalar(sf.Type)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error mapping field %s", sf.Name)
+		}
+		fields[name] = &graphql.Field{
+			Type: fieldType,
+		}
+	}
+	return fields, nil
+}
+
+// graphqlScalar maps Go-types to GraphQL-types as documented by
+// graphqlFields.
+func graphqlScalar(t reflect.Type) (graphql.Output, error) {
+	if t.Kind() == reflect.Ptr {
+		elem, err := graphqlScalar(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		if nonNull, ok := elem.(*graphql.NonNull); ok {
+			return nonNull.OfType, nil
+		}
+		return elem, nil
+	}
+	if t.Implements(textMarshalerType) || t.Implements(stringerType) {
+		return graphql.NewNonNull(graphql.String), nil
+	}
+
+	var scalar *graphql.Scalar
+	switch t.Kind() {
+	case reflect.Bool:
+		scalar = graphql.Boolean
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		scalar = graphql.Int
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		scalar = graphqlLong
+	case reflect.Float32, reflect.Float64:
+		scalar = graphql.Float
+	case reflect.String:
+		scalar = graphql.String
+	default:
+		return nil, errors.Errorf("Unsupported type %s", t)
+	}
+	return graphql.NewNonNull(scalar), nil
+}
+
+// graphqlInventory searches the inventory of the request's tenant.
+func graphqlInventory(
+	ctx context.Context,
+	env *Env,
+	filters []report.SearchParam,
+) ([]report.Inventory, error) {
+	items, err := env.Inventorydb.InvAdvSearch(map[string][]report.SearchParam{
+		"inventory": scopeFilters(ctx, filters),
+	})
+	if errors.Cause(err) == report.ErrNoResults {
+		return []report.Inventory{}, nil
+	}
+	return items, graphqlError(err)
+}
+
+// graphqlItem returns the inventory-item of the ID in the request's tenant,
+// or nil if there is none.
+func graphqlItem(ctx context.Context, env *Env, itemID string) (interface{}, error) {
+	if itemID == "" {
+		return nil, nil
+	}
+	items, err := graphqlInventory(ctx, env, []report.SearchParam{itemIDFilter(itemID)})
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[0], nil
+}
+
+// allTenantsSearch returns the filters and limit of flash-sale and metric
+// searches, which cannot be scoped to tenants, so require all-tenants
+// requests.
+func allTenantsSearch(p graphql.ResolveParams) ([]report.SearchParam, int64, error) {
+	if graphqlTenant(p.Context) != "" {
+		return nil, 0, errors.New("API-token cannot query all tenants")
+	}
+	var filters []report.SearchParam
+	err := decodeGraphQLArg(p.Args["filters"], &filters)
+	if err != nil {
+		return nil, 0, err
+	}
+	limit, _ := p.Args["limit"].(int)
+	return filters, int64(limit), nil
+}
+
+// scopeFilters restricts the filters to the request's tenant, if any.
+func scopeFilters(ctx context.Context, filters []report.SearchParam) []report.SearchParam {
+	tenant := graphqlTenant(ctx)
+	if tenant == "" {
+		return filters
+	}
+	return append(withoutTenant(filters), report.SearchParam{
+		Field: tenantField,
+		Type:  "string",
+		Equal: tenant,
+	})
+}
+
+func itemIDFilter(itemID string) report.SearchParam {
+	return report.SearchParam{
+		Field: "item_id",
+		Type:  "string",
+		Equal: itemID,
+	}
+}
+
+// decodeGraphQLArg decodes the coerced GraphQL-argument into v, which
+// decodes as from the JSON of query-events.
+func decodeGraphQLArg(arg interface{}, v interface{}) error {
+	if arg == nil {
+		return nil
+	}
+	argJSON, err := json.Marshal(arg)
+	if err != nil {
+		return errors.Wrap(err, "Error marshalling argument")
+	}
+	err = json.Unmarshal(argJSON, v)
+	if err != nil {
+		return errors.Wrap(err, "Error unmarshalling argument")
+	}
+	return nil
+}
+
+// graphqlError returns the errors of malformed queries and invalid
+// report-parameters as they are, since they are meant for the client, and
+// hides other errors after logging them.
+func graphqlError(err error) error {
+	if err == nil || isPoison(err) {
+		return err
+	}
+	log.Println(err)
+	return errors.New("Error running query")
+}
+
+// graphqlRequest is a GraphQL-request, as POSTed in JSON.
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// serveGraphQL executes the GraphQL-request scoped to the tenant. Queries
+// are POSTed as JSON, or sent with GET as the query, operationName and
+// variables query-params.
+func (api *httpAPI) serveGraphQL(w http.ResponseWriter, r *http.Request, tenant string) {
+	var req graphqlRequest
+	switch r.Method {
+	case http.MethodGet:
+		params := r.URL.Query()
+		req.Query = params.Get("query")
+		req.OperationName = params.Get("operationName")
+		if vars := params.Get("variables"); vars != "" {
+			err := json.Unmarshal([]byte(vars), &req.Variables)
+			if err != nil {
+				err = errors.Wrap(err, "Error unmarshalling variables")
+				writeAPIError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+	case http.MethodPost:
+		r.Body = http.MaxBytesReader(w, r.Body, maxAPIBodyBytes)
+		body, err := ioutil.ReadAll(r.Body)
+		if err == nil {
+			err = json.Unmarshal(body, &req)
+		}
+		if err != nil {
+			err = errors.Wrap(err, "Error reading GraphQL-request")
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+
+	default:
+		writeMethodNotAllowed(w, http.MethodGet+", "+http.MethodPost)
+		return
+	}
+
+	tenant, ok := requestTenant(w, r, tenant)
+	if !ok {
+		return
+	}
+	result := graphql.Do(graphql.Params{
+		Schema:         api.graphql,
+		RequestString:  req.Query,
+		OperationName:  req.OperationName,
+		VariableValues: req.Variables,
+		Context:        context.WithValue(r.Context(), graphqlTenantKey{}, tenant),
+	})
+	body, err := json.Marshal(result)
+	if err != nil {
+		err = errors.Wrap(err, "Error marshalling GraphQL-response")
+		log.Println(err)
+		writeAPIError(w, http.StatusInternalServerError, errors.New("Error running query"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	// Requests failing before execution, such as invalid queries, have no
+	// data, and no field-errors with a path
+	executed := result.Data != nil
+	for _, err := range result.Errors {
+		executed = executed || len(err.Path) > 0
+	}
+	if !executed {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	w.Write(body)
+}
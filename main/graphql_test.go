@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/TerrexTech/go-report-productsold/report"
+	"github.com/TerrexTech/uuuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// flashDB is a report.DBI recording the flash-sale searches.
+type flashDB struct {
+	report.DBI
+	searches [][]report.SearchParam
+	sales    []report.Flash
+}
+
+func (db *flashDB) SearchFlash(
+	params []report.SearchParam,
+	opts report.SearchOptions,
+) ([]report.Flash, error) {
+	db.searches = append(db.searches, params)
+	return db.sales, nil
+}
+
+var _ = Describe("GraphQL-API", func() {
+	var (
+		db      *reportDB
+		flashes *flashDB
+		api     *httpAPI
+		itemID  uuuid.UUID
+	)
+
+	BeforeEach(func() {
+		var err error
+		itemID, err = uuuid.NewV4()
+		Expect(err).ToNot(HaveOccurred())
+
+		db = &reportDB{
+			filters: map[string][]report.SearchParam{},
+			inventory: []report.Inventory{{
+				ItemID:     itemID,
+				SKU:        1 << 40,
+				Name:       "apple",
+				Price:      2,
+				SoldWeight: 10,
+			}},
+		}
+		flashes = &flashDB{
+			sales: []report.Flash{{ItemID: itemID, SalePrice: 1}},
+		}
+		env := &Env{Inventorydb: db, Flashdb: flashes}
+		api = &httpAPI{
+			env: env,
+			tokens: map[string]string{
+				"token-a":   "tenant-a",
+				"token-all": apiTenantAll,
+			},
+		}
+		api.graphql, err = newGraphQLSchema(env)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	// query POSTs the GraphQL-query with the API-token, and returns the
+	// status and the decoded response.
+	query := func(token string, q string) (int, map[string]interface{}) {
+		body, err := json.Marshal(map[string]string{"query": q})
+		Expect(err).ToNot(HaveOccurred())
+		req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+
+		resp := map[string]interface{}{}
+		err = json.Unmarshal(w.Body.Bytes(), &resp)
+		Expect(err).ToNot(HaveOccurred())
+		return w.Code, resp
+	}
+
+	It("should resolve items with their flash-sales in the tenant", func() {
+		status, resp := query("token-a", `{
+			inventory(filters: [{field: "sku", type: "int", equal: "1"}]) {
+				sku
+				name
+				revenue
+				flash_sales { sale_price }
+			}
+		}`)
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(resp).ToNot(HaveKey("errors"))
+		Expect(resp["data"]).To(Equal(map[string]interface{}{
+			"inventory": []interface{}{
+				map[string]interface{}{
+					"sku":         float64(1 << 40),
+					"name":        "apple",
+					"revenue":     float64(20),
+					"flash_sales": []interface{}{map[string]interface{}{"sale_price": float64(1)}},
+				},
+			},
+		}))
+
+		Expect(db.filters["inventory"]).To(Equal([]report.SearchParam{
+			{Field: "sku", Type: "int", Equal: "1"},
+			{Field: tenantField, Type: "string", Equal: "tenant-a"},
+		}))
+		Expect(flashes.searches).To(Equal([][]report.SearchParam{
+			{itemIDFilter(itemID.String())},
+		}))
+	})
+
+	It("should scope comparisons to the tenant", func() {
+		status, resp := query("token-a", `{
+			sold_comparison(comparison: same_period_last_year, filters: [
+				{field: "rs_customer_id", type: "string", equal: "tenant-b"}
+			]) {
+				period { start }
+			}
+		}`)
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(resp).ToNot(HaveKey("errors"))
+		Expect(db.filters["comparison"]).To(Equal([]report.SearchParam{
+			{Field: tenantField, Type: "string", Equal: "tenant-a"},
+		}))
+	})
+
+	It("should only let tokens of all tenants search flash-sales", func() {
+		status, resp := query("token-a", `{ flash_sales { sale_price } }`)
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(resp["data"]).To(BeNil())
+		Expect(resp["errors"]).To(HaveLen(1))
+		Expect(flashes.searches).To(BeEmpty())
+
+		status, resp = query("token-all", `{ flash_sales(limit: 1) { sale_price } }`)
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(resp).ToNot(HaveKey("errors"))
+		Expect(flashes.searches).To(HaveLen(1))
+	})
+
+	It("should reject invalid queries", func() {
+		status, resp := query("token-a", `{ inventory { profit } }`)
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(resp["errors"]).ToNot(BeEmpty())
+		Expect(db.filters).To(BeEmpty())
+	})
+
+	It("should return the errors of invalid report-parameters", func() {
+		env := &Env{Inventorydb: &report.DB{}}
+		var err error
+		api.graphql, err = newGraphQLSchema(env)
+		Expect(err).ToNot(HaveOccurred())
+
+		status, resp := query("token-all", `{ sold_comparison { period { start } } }`)
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(resp["errors"]).To(HaveLen(1))
+		gqlErr := resp["errors"].([]interface{})[0].(map[string]interface{})
+		Expect(gqlErr["message"]).To(ContainSubstring("Period requires a Range or From"))
+	})
+
+	It("should run queries sent with GET", func() {
+		params := url.Values{}
+		params.Set("query", `query Item($id: String!) { item(item_id: $id) { name } }`)
+		params.Set("variables", `{"id": "`+itemID.String()+`"}`)
+		req := httptest.NewRequest(http.MethodGet, "/graphql?"+params.Encode(), nil)
+		req.Header.Set("Authorization", "Bearer token-a")
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(MatchJSON(`{"data": {"item": {"name": "apple"}}}`))
+	})
+})
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/TerrexTech/go-report-productsold/codec"
+	"github.com/TerrexTech/go-report-productsold/report"
+	"github.com/graphql-go/graphql"
+	"github.com/pkg/errors"
+)
+
+// apiTenantAll is the tenant of API-tokens which may query all tenants.
+const apiTenantAll = "*"
+
+// maxAPIBodyBytes limits the size of report-params in API-requests.
+const maxAPIBodyBytes = 1 << 20
+
+// httpAPI serves the report-handlers over HTTP:
+//
+//	GET  /reports                   lists the report-types
+//	POST /reports/{type}            runs the report with the params in the body
+//	GET  /reports/inventory/search  searches the inventory with the filters param
+//	POST /graphql                   runs GraphQL-queries over the inventory,
+//	                                flash-sales and metrics, also as GET
+//
+// Reports run the same as in query-events, and the encoding query-param
+// selects the encoding of results. Requests authenticate with the bearer-token
+// "Authorization: Bearer <token>", and are scoped to the token's tenant.
+// Tokens of apiTenantAll may scope requests with the tenant query-param.
+type httpAPI struct {
+	env *Env
+	// tokens maps the API-tokens to their tenants.
+	tokens map[string]string
+	// graphql is the GraphQL-schema of the Env.
+	graphql graphql.Schema
+}
+
+// newHTTPAPI creates the httpAPI with the API-tokens, which are a
+// comma-separated list of "<tenant>:<token>".
+func newHTTPAPI(env *Env, tokens string) (*httpAPI, error) {
+	api := &httpAPI{
+		env:    env,
+		tokens: map[string]string{},
+	}
+	for _, entry := range splitList(tokens) {
+		colon := strings.Index(entry, ":")
+		if colon <= 0 || colon == len(entry)-1 {
+			return nil, errors.New("API-tokens must be formatted as <tenant>:<token>")
+		}
+		api.tokens[entry[colon+1:]] = entry[:colon]
+	}
+	if len(api.tokens) == 0 {
+		return nil, errors.New("At least one API-token is required")
+	}
+
+	var err error
+	api.graphql, err = newGraphQLSchema(env)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating GraphQL-schema")
+	}
+	return api, nil
+}
+
+// serveHTTPAPI serves the httpAPI on addr until the process exits.
+func serveHTTPAPI(api *httpAPI, addr string) {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           api,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("Serving HTTP-API on %s", addr)
+	err := server.ListenAndServe()
+	err = errors.Wrap(err, "Error serving HTTP-API")
+	log.Println(err)
+}
+
+func (api *httpAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tenant, authenticated := api.authenticate(r)
+	if !authenticated {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeAPIError(w, http.StatusUnauthorized, errors.New("Invalid or missing API-token"))
+		return
+	}
+
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case path == "/reports":
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, http.MethodGet)
+			return
+		}
+		api.listReports(w)
+
+	case path == "/reports/inventory/search":
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, http.MethodGet)
+			return
+		}
+		api.searchInventory(w, r, tenant)
+
+	case path == "/graphql":
+		api.serveGraphQL(w, r, tenant)
+
+	case strings.HasPrefix(path, "/reports/"):
+		if r.Method != http.MethodPost {
+			writeMethodNotAllowed(w, http.MethodPost)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxAPIBodyBytes)
+		params, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			err = errors.Wrap(err, "Error reading report-params")
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		reportType := strings.TrimPrefix(path, "/reports/")
+		api.runReport(w, r, tenant, reportType, params)
+
+	default:
+		writeAPIError(w, http.StatusNotFound, errors.Errorf("Not found: %s", r.URL.Path))
+	}
+}
+
+// authenticate returns the tenant of the request's API-token, and whether
+// the token is valid.
+func (api *httpAPI) authenticate(r *http.Request) (string, bool) {
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, prefix) {
+		return "", false
+	}
+	token := []byte(strings.TrimPrefix(auth, prefix))
+
+	// All tokens are compared in constant-time, so timing reveals none
+	tenant := ""
+	authenticated := false
+	for apiToken, apiTenant := range api.tokens {
+		if subtle.ConstantTimeCompare(token, []byte(apiToken)) == 1 {
+			tenant = apiTenant
+			authenticated = true
+		}
+	}
+	return tenant, authenticated
+}
+
+func (api *httpAPI) listReports(w http.ResponseWriter) {
+	reportTypes := make([]string, 0, len(reportHandlers))
+	for reportType := range reportHandlers {
+		reportTypes = append(reportTypes, reportType)
+	}
+	sort.Strings(reportTypes)
+
+	body, err := json.Marshal(map[string][]string{
+		"reports": reportTypes,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "Error marshalling report-types")
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// searchInventory runs the inventory-report with the SearchParams of the
+// filters query-param, which is a JSON-array as in query-events.
+func (api *httpAPI) searchInventory(w http.ResponseWriter, r *http.Request, tenant string) {
+	params := json.RawMessage("[]")
+	if filters := r.URL.Query().Get("filters"); filters != "" {
+		params = json.RawMessage(filters)
+	}
+	api.runReport(w, r, tenant, "inventory", params)
+}
+
+// runReport runs the report scoped to the tenant, and writes its result.
+func (api *httpAPI) runReport(
+	w http.ResponseWriter,
+	r *http.Request,
+	tenant string,
+	reportType string,
+	params json.RawMessage,
+) {
+	if _, exists := reportHandlers[reportType]; !exists {
+		err := errors.Errorf("Unknown report-type: %s", reportType)
+		writeAPIError(w, http.StatusNotFound, err)
+		return
+	}
+	if len(params) == 0 {
+		params = json.RawMessage("{}")
+		if reportType == "inventory" {
+			params = json.RawMessage("[]")
+		}
+	}
+
+	tenant, ok := requestTenant(w, r, tenant)
+	if !ok {
+		return
+	}
+	if tenant != "" {
+		var err error
+		params, err = scopeToTenant(reportType, params, tenant)
+		if errors.Cause(err) == errUnscopedReport {
+			writeAPIError(w, http.StatusForbidden, err)
+			return
+		}
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	query := map[string]json.RawMessage{
+		reportType: params,
+	}
+	if encoding := r.URL.Query().Get("encoding"); encoding != "" {
+		encodingJSON, err := json.Marshal(encoding)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		query[encodingKey] = encodingJSON
+	}
+
+	result, encoder, err := runQuery(api.env, query)
+	// Searches without matches are just empty
+	if errors.Cause(err) == report.ErrNoResults {
+		encoder, err = codec.Lookup(r.URL.Query().Get("encoding"))
+		if err == nil {
+			result, err = encoder.Encode(reportResults[reportType])
+		}
+	}
+	if err != nil {
+		// Invalid queries and report-parameters are the client's error
+		if isPoison(err) {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		log.Println(err)
+		writeAPIError(w, http.StatusInternalServerError, errors.New("Error running report"))
+		return
+	}
+	w.Header().Set("Content-Type", encoder.ContentType())
+	w.Write(result)
+}
+
+// requestTenant returns the tenant the request is scoped to, which is empty
+// for all tenants. Tokens of apiTenantAll may select the tenant with the
+// tenant query-param, while other tokens cannot query other tenants.
+// Forbidden requests are responded to, and are not ok.
+func requestTenant(w http.ResponseWriter, r *http.Request, tenant string) (string, bool) {
+	requested := r.URL.Query().Get("tenant")
+	if tenant == apiTenantAll {
+		return requested, true
+	}
+	if requested != "" && requested != tenant {
+		err := errors.Errorf("API-token cannot query tenant %s", requested)
+		writeAPIError(w, http.StatusForbidden, err)
+		return "", false
+	}
+	return tenant, true
+}
+
+// writeAPIError writes the error as a JSON-object with the status.
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	body, _ := json.Marshal(map[string]string{
+		"error": err.Error(),
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	writeAPIError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+}
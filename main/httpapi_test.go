@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/TerrexTech/go-report-productsold/report"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+// reportDB is a report.DBI recording the filters each report is run with.
+type reportDB struct {
+	report.DBI
+	filters   map[string][]report.SearchParam
+	inventory []report.Inventory
+}
+
+func (db *reportDB) InvAdvSearch(
+	search map[string][]report.SearchParam,
+) ([]report.Inventory, error) {
+	db.filters["inventory"] = search["inventory"]
+	if len(db.inventory) == 0 {
+		return nil, report.ErrNoResults
+	}
+	return db.inventory, nil
+}
+
+func (db *reportDB) SoldComparison(
+	params report.ComparisonParams,
+) (*report.ComparisonReport, error) {
+	db.filters["comparison"] = params.Filters
+	return &report.ComparisonReport{}, nil
+}
+
+func (db *reportDB) Rankings(params report.RankingParams) ([]report.Ranking, error) {
+	db.filters["ranking"] = params.Filters
+	return nil, nil
+}
+
+func (db *reportDB) ExpiryRisk(params report.ExpiryRiskParams) ([]report.ExpiryRisk, error) {
+	db.filters["expiry"] = params.Filters
+	return nil, nil
+}
+
+func (db *reportDB) FlashCandidates(
+	metricDB report.DBI,
+	params report.FlashCandidateParams,
+) ([]report.FlashCandidate, error) {
+	db.filters["flash_candidates"] = params.Filters
+	return nil, nil
+}
+
+func (db *reportDB) Markdown(
+	flashDB report.DBI,
+	params report.MarkdownParams,
+) ([]report.Markdown, error) {
+	db.filters["markdown"] = params.Filters
+	return nil, nil
+}
+
+func (db *reportDB) OriginPerformance(
+	params report.OriginPerformanceParams,
+) ([]report.OriginPerformance, error) {
+	db.filters["origin"] = params.Filters
+	return nil, nil
+}
+
+func (db *reportDB) DaysToSell(
+	params report.DaysToSellParams,
+) ([]report.DaysToSellDistribution, error) {
+	db.filters["days_to_sell"] = params.Filters
+	return nil, nil
+}
+
+func (db *reportDB) Forecast(params report.ForecastParams) ([]report.Forecast, error) {
+	db.filters["forecast"] = params.Filters
+	return nil, nil
+}
+
+func (db *reportDB) Anomalies(
+	metricDB report.DBI,
+	params report.AnomalyParams,
+) ([]report.Anomaly, error) {
+	db.filters["anomalies"] = params.Filters
+	return nil, nil
+}
+
+var _ = Describe("HTTP-API", func() {
+	var (
+		db  *reportDB
+		api *httpAPI
+	)
+
+	tenantFilter := func(tenant string) report.SearchParam {
+		return report.SearchParam{Field: tenantField, Type: "string", Equal: tenant}
+	}
+	skuFilter := report.SearchParam{Field: "sku", Type: "int", Equal: "1"}
+
+	BeforeEach(func() {
+		db = &reportDB{
+			filters: map[string][]report.SearchParam{},
+		}
+		api = &httpAPI{
+			env: &Env{Inventorydb: db},
+			tokens: map[string]string{
+				"token-a":   "tenant-a",
+				"token-all": apiTenantAll,
+			},
+		}
+	})
+
+	// serve serves the request with the API-token, and returns the recorded
+	// response.
+	serve := func(method string, target string, token string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		return w
+	}
+
+	Describe("authentication", func() {
+		It("should return the tenant of valid tokens", func() {
+			req := httptest.NewRequest(http.MethodGet, "/reports", nil)
+			req.Header.Set("Authorization", "Bearer token-a")
+			tenant, authenticated := api.authenticate(req)
+			Expect(authenticated).To(BeTrue())
+			Expect(tenant).To(Equal("tenant-a"))
+		})
+
+		It("should reject missing, malformed and unknown tokens", func() {
+			for _, auth := range []string{"", "token-a", "Basic token-a", "Bearer token-b", "Bearer "} {
+				req := httptest.NewRequest(http.MethodGet, "/reports", nil)
+				req.Header.Set("Authorization", auth)
+				_, authenticated := api.authenticate(req)
+				Expect(authenticated).To(BeFalse(), auth)
+			}
+
+			w := serve(http.MethodPost, "/reports/ranking", "", "{}")
+			Expect(w.Code).To(Equal(http.StatusUnauthorized))
+			Expect(w.Header().Get("WWW-Authenticate")).To(Equal("Bearer"))
+			w = serve(http.MethodPost, "/reports/ranking", "token-b", "{}")
+			Expect(w.Code).To(Equal(http.StatusUnauthorized))
+			Expect(db.filters).To(BeEmpty())
+		})
+	})
+
+	Describe("tenants", func() {
+		It("should scope tokens to their tenant", func() {
+			req := httptest.NewRequest(http.MethodGet, "/reports?tenant=tenant-a", nil)
+			tenant, ok := requestTenant(httptest.NewRecorder(), req, "tenant-a")
+			Expect(ok).To(BeTrue())
+			Expect(tenant).To(Equal("tenant-a"))
+
+			req = httptest.NewRequest(http.MethodGet, "/reports", nil)
+			tenant, ok = requestTenant(httptest.NewRecorder(), req, "tenant-a")
+			Expect(ok).To(BeTrue())
+			Expect(tenant).To(Equal("tenant-a"))
+		})
+
+		It("should forbid tokens to query other tenants", func() {
+			req := httptest.NewRequest(http.MethodGet, "/reports?tenant=tenant-b", nil)
+			w := httptest.NewRecorder()
+			_, ok := requestTenant(w, req, "tenant-a")
+			Expect(ok).To(BeFalse())
+			Expect(w.Code).To(Equal(http.StatusForbidden))
+
+			w = serve(http.MethodPost, "/reports/ranking?tenant=tenant-b", "token-a", "{}")
+			Expect(w.Code).To(Equal(http.StatusForbidden))
+			Expect(db.filters).To(BeEmpty())
+		})
+
+		It("should let tokens of all tenants select the tenant", func() {
+			w := serve(http.MethodPost, "/reports/ranking?tenant=tenant-b", "token-all", "{}")
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(db.filters["ranking"]).To(Equal([]report.SearchParam{tenantFilter("tenant-b")}))
+
+			w = serve(http.MethodPost, "/reports/ranking", "token-all", "{}")
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(db.filters["ranking"]).To(BeEmpty())
+		})
+	})
+
+	It("should scope every report-type to the tenant", func() {
+		for reportType := range reportHandlers {
+			filters := `[
+				{"field":"sku","type":"int","equal":"1"},
+				{"field":"rs_customer_id","type":"string","equal":"tenant-b"}
+			]`
+			body := `{"filters":` + filters + `}`
+			if reportType == "inventory" {
+				body = filters
+			}
+
+			w := serve(http.MethodPost, "/reports/"+reportType, "token-a", body)
+			Expect(w.Code).To(Equal(http.StatusOK), reportType)
+			Expect(db.filters).To(HaveKey(reportType))
+			Expect(db.filters[reportType]).To(Equal([]report.SearchParam{
+				skuFilter,
+				tenantFilter("tenant-a"),
+			}), reportType)
+		}
+	})
+
+	It("should scope differently cased filters", func() {
+		body := `{
+			"Filters": [{"field":"rs_customer_id","type":"string","equal":"tenant-b"}],
+			"FILTERS": [{"field":"sku","type":"int","equal":"1"}]
+		}`
+		w := serve(http.MethodPost, "/reports/ranking", "token-a", body)
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(db.filters["ranking"]).To(ConsistOf(skuFilter, tenantFilter("tenant-a")))
+	})
+
+	It("should refuse reports which cannot be scoped to a tenant", func() {
+		reportHandlers["unscoped"] = rankings
+		defer delete(reportHandlers, "unscoped")
+
+		_, err := scopeToTenant("unscoped", json.RawMessage("{}"), "tenant-a")
+		Expect(err).To(HaveOccurred())
+
+		w := serve(http.MethodPost, "/reports/unscoped", "token-a", "{}")
+		Expect(w.Code).To(Equal(http.StatusForbidden))
+		Expect(db.filters).To(BeEmpty())
+
+		// Tokens of all tenants can still run them unscoped
+		w = serve(http.MethodPost, "/reports/unscoped", "token-all", "{}")
+		Expect(w.Code).To(Equal(http.StatusOK))
+	})
+
+	It("should refuse sensor-anomalies, whose metric-readings have no tenant", func() {
+		for _, body := range []string{`{"source":"sensors"}`, `{"Source":"sensors"}`} {
+			_, err := scopeToTenant("anomalies", json.RawMessage(body), "tenant-a")
+			Expect(errors.Cause(err)).To(Equal(errUnscopedReport), body)
+
+			w := serve(http.MethodPost, "/reports/anomalies", "token-a", body)
+			Expect(w.Code).To(Equal(http.StatusForbidden), body)
+		}
+		Expect(db.filters).To(BeEmpty())
+
+		w := serve(http.MethodPost, "/reports/anomalies", "token-a", `{"source":"sales"}`)
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(db.filters["anomalies"]).To(Equal([]report.SearchParam{tenantFilter("tenant-a")}))
+
+		w = serve(http.MethodPost, "/reports/anomalies", "token-all", `{"source":"sensors"}`)
+		Expect(w.Code).To(Equal(http.StatusOK))
+	})
+
+	It("should respond to searches without matches with empty results", func() {
+		w := serve(http.MethodGet, "/reports/inventory/search", "token-a", "")
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(Equal("[]"))
+		Expect(db.filters["inventory"]).To(Equal([]report.SearchParam{tenantFilter("tenant-a")}))
+
+		db.inventory = []report.Inventory{{SKU: 1, Name: "apple"}}
+		w = serve(http.MethodGet, "/reports/inventory/search", "token-a", "")
+		Expect(w.Code).To(Equal(http.StatusOK))
+		var results []KaRespData
+		err := json.Unmarshal(w.Body.Bytes(), &results)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(results).To(Equal([]KaRespData{{SKU: 1, Name: "apple"}}))
+	})
+
+	It("should respond to invalid report-parameters with their error", func() {
+		// The report-package validates the parameters before querying
+		api.env.Inventorydb = &report.DB{}
+		invalid := map[string]string{
+			"ranking":    `{"metric":"bogus"}`,
+			"comparison": `{}`,
+			"origin":     `{"group_by":"bogus"}`,
+		}
+		for reportType, body := range invalid {
+			w := serve(http.MethodPost, "/reports/"+reportType, "token-all", body)
+			Expect(w.Code).To(Equal(http.StatusBadRequest), reportType)
+
+			var resp map[string]string
+			err := json.Unmarshal(w.Body.Bytes(), &resp)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp["error"]).To(ContainSubstring(report.ErrInvalidParams.Error()), reportType)
+			Expect(resp["error"]).ToNot(Equal("Error running report"), reportType)
+		}
+	})
+
+	It("should respond to unknown report-types and methods", func() {
+		w := serve(http.MethodPost, "/reports/profit", "token-a", "{}")
+		Expect(w.Code).To(Equal(http.StatusNotFound))
+		w = serve(http.MethodGet, "/reports/ranking", "token-a", "")
+		Expect(w.Code).To(Equal(http.StatusMethodNotAllowed))
+		Expect(w.Header().Get("Allow")).To(Equal(http.MethodPost))
+	})
+})
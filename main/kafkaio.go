@@ -1,25 +1,186 @@
 package main
 
 import (
+	"encoding/json"
+	"log"
 	"os"
+	"strconv"
+	"time"
 
-	"github.com/TerrexTech/go-authserver-query/kafka"
+	"github.com/Shopify/sarama"
 	"github.com/TerrexTech/go-commonutils/commonutil"
+	"github.com/TerrexTech/go-eventspoll/poll"
+	esmodel "github.com/TerrexTech/go-eventstore-models/model"
+	"github.com/TerrexTech/go-report-productsold/chunk"
+	"github.com/TerrexTech/go-report-productsold/kafka"
+	"github.com/pkg/errors"
 )
 
-// initKafkaIOLogin creates a KafkaIO from KafkaAdapter based on set environment variables.
+// publisher produces a Response through the event-transport. Transports
+// without message-headers drop the Response's metadata.
+type publisher func(resp *kafka.Response)
+
+// initKafkaIOReport creates a KafkaIO from KafkaAdapter based on set environment variables.
 func initKafkaIOReport() (*kafka.IO, error) {
-	brokers := os.Getenv("KAFKA_BROKERS")
-	consumerGroupName := os.Getenv("KAFKA_CONSUMER_GROUP_REPORT")
-	consumerTopics := os.Getenv("KAFKA_CONSUMER_TOPIC_REPORT")
-	responseTopic := os.Getenv("KAFKA_PRODUCER_TOPIC_REPORT")
+	kafkaAdapter, err := kafkaAdapterFromEnv()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error configuring KafkaAdapter")
+	}
+	kafkaAdapter.ConsumerGroupName = os.Getenv("KAFKA_CONSUMER_GROUP_REPORT")
+	kafkaAdapter.ConsumerTopics = *commonutil.ParseHosts(
+		os.Getenv("KAFKA_CONSUMER_TOPIC_REPORT"),
+	)
+	kafkaAdapter.ProducerTopic = os.Getenv("KAFKA_PRODUCER_TOPIC_REPORT")
+	kafkaAdapter.KeyBy = os.Getenv("KAFKA_PRODUCER_KEY_BY")
+
+	return kafkaAdapter.InitIO()
+}
 
+// kafkaAdapterFromEnv creates a KafkaAdapter with the brokers, dead-letter
+// topic, and the consumer, producer and security settings from the
+// environment. Unset variables use the KafkaAdapter's defaults.
+func kafkaAdapterFromEnv() (*kafka.Adapter, error) {
 	kafkaAdapter := &kafka.Adapter{
-		Brokers:           *commonutil.ParseHosts(brokers),
-		ConsumerGroupName: consumerGroupName,
-		ConsumerTopics:    *commonutil.ParseHosts(consumerTopics),
-		ProducerTopic:     responseTopic,
+		Brokers:         *commonutil.ParseHosts(os.Getenv("KAFKA_BROKERS")),
+		DeadLetterTopic: os.Getenv("KAFKA_PRODUCER_DEADLETTER_TOPIC"),
+		Version:         os.Getenv("KAFKA_VERSION"),
+		Consumer: kafka.ConsumerConfig{
+			InitialOffset: os.Getenv("KAFKA_CONSUMER_INITIAL_OFFSET"),
+		},
+		Producer: kafka.ProducerConfig{
+			RequiredAcks: os.Getenv("KAFKA_PRODUCER_ACKS"),
+			Compression:  os.Getenv("KAFKA_PRODUCER_COMPRESSION"),
+		},
+		Security: kafka.SecurityConfig{
+			SASLUser:     os.Getenv("KAFKA_SASL_USERNAME"),
+			SASLPassword: os.Getenv("KAFKA_SASL_PASSWORD"),
+			TLSCAFile:    os.Getenv("KAFKA_TLS_CA_FILE"),
+			TLSCertFile:  os.Getenv("KAFKA_TLS_CERT_FILE"),
+			TLSKeyFile:   os.Getenv("KAFKA_TLS_KEY_FILE"),
+		},
 	}
 
-	return kafkaAdapter.InitIO()
+	durations := map[string]*time.Duration{
+		"KAFKA_CONSUMER_MAX_PROCESSING_TIME": &kafkaAdapter.Consumer.MaxProcessingTime,
+		"KAFKA_CONSUMER_SESSION_TIMEOUT":     &kafkaAdapter.Consumer.SessionTimeout,
+		"KAFKA_CONSUMER_HEARTBEAT_INTERVAL":  &kafkaAdapter.Consumer.HeartbeatInterval,
+	}
+	for key, d := range durations {
+		if value := os.Getenv(key); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Error parsing %s", key)
+			}
+			*d = parsed
+		}
+	}
+
+	bools := map[string]*bool{
+		"KAFKA_PRODUCER_COMPRESS_RESULTS": &kafkaAdapter.CompressResults,
+		"KAFKA_PRODUCER_IDEMPOTENT":       &kafkaAdapter.Producer.Idempotent,
+		"KAFKA_TLS_ENABLE":                &kafkaAdapter.Security.TLSEnable,
+		"KAFKA_TLS_INSECURE_SKIP_VERIFY":  &kafkaAdapter.Security.TLSInsecureSkipVerify,
+	}
+	for key, b := range bools {
+		if value := os.Getenv(key); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Error parsing %s", key)
+			}
+			*b = parsed
+		}
+	}
+
+	if value := os.Getenv("KAFKA_PRODUCER_MAX_MESSAGE_BYTES"); value != "" {
+		maxBytes, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error parsing KAFKA_PRODUCER_MAX_MESSAGE_BYTES")
+		}
+		kafkaAdapter.Producer.MaxMessageBytes = maxBytes
+	}
+
+	switch value := os.Getenv("KAFKA_PRODUCER_CHUNK_BYTES"); value {
+	case "":
+	case "auto":
+		// Chunks fit into the largest messages of the producer
+		maxBytes := kafkaAdapter.Producer.MaxMessageBytes
+		if maxBytes == 0 {
+			maxBytes = sarama.NewConfig().Producer.MaxMessageBytes
+		}
+		kafkaAdapter.ChunkBytes = chunk.PartSize(maxBytes)
+	default:
+		chunkBytes, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error parsing KAFKA_PRODUCER_CHUNK_BYTES")
+		}
+		kafkaAdapter.ChunkBytes = chunkBytes
+	}
+	return kafkaAdapter, nil
+}
+
+// serveKafkaIO consumes events from the KafkaIO until its consumer closes.
+// Each event is handled by its action, the response is produced, and the
+// event's offset is marked. Inventory-events are handled in order, and are
+// skipped unless enableEvents is set. Queries are handled concurrently, and
+// their offsets are committed once all earlier events are done.
+func serveKafkaIO(env *Env, kio *kafka.IO, enableEvents bool) {
+	produce := func(kafkaResp *esmodel.KafkaResponse) {
+		if kafkaResp != nil {
+			kio.ProducerInput() <- kafkaResp
+		}
+	}
+
+	for msg := range kio.ConsumerMessages() {
+		event := esmodel.Event{}
+		err := json.Unmarshal(msg.Value, &event)
+		if err != nil {
+			err = errors.Wrap(err, "Error unmarshalling event, dead-lettering")
+			log.Println(err)
+			kio.DeadLetters() <- kafka.NewDeadLetter(msg, err, 1)
+			kio.MarkOffset() <- msg
+			continue
+		}
+		eventResp := &poll.EventResponse{
+			Event: event,
+		}
+
+		switch event.Action {
+		case "query":
+			go func(msg *sarama.ConsumerMessage) {
+				kafkaResp := handleQuery(eventResp, env)
+				if kafkaResp != nil {
+					reportType, tenant := queryMetadata(eventResp.Event.Data)
+					resultType := ""
+					if kafkaResp.Error == "" {
+						resultType = queryResultType(eventResp.Event.Data)
+					}
+					kio.Responses() <- &kafka.Response{
+						KafkaResponse: kafkaResp,
+						ReportType:    reportType,
+						Tenant:        tenant,
+						ResultType:    resultType,
+					}
+				}
+				kio.MarkOffset() <- msg
+			}(msg)
+			continue
+
+		case "insert":
+			if enableEvents {
+				produce(handleInsert(eventResp, env))
+			}
+		case "update":
+			if enableEvents {
+				produce(handleUpdate(eventResp, env))
+			}
+		case "delete":
+			if enableEvents {
+				produce(handleDelete(eventResp, env))
+			}
+		default:
+			log.Printf("Unknown event-action: %s, skipping", event.Action)
+		}
+		kio.MarkOffset() <- msg
+	}
+	log.Println("Consumer-channel closed, exiting")
 }
@@ -2,13 +2,17 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"log"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/TerrexTech/go-commonutils/commonutil"
 	"github.com/TerrexTech/go-eventspoll/poll"
 	esmodel "github.com/TerrexTech/go-eventstore-models/model"
+	"github.com/TerrexTech/go-report-productsold/codec"
+	"github.com/TerrexTech/go-report-productsold/kafka"
 	"github.com/TerrexTech/go-report-productsold/report"
 	"github.com/joho/godotenv"
 	"github.com/pkg/errors"
@@ -18,17 +22,64 @@ type Env struct {
 	Flashdb     report.DBI
 	Metricdb    report.DBI
 	Inventorydb report.DBI
+	Rollupdb    report.DBI
+	// Alertdb records published anomaly-alerts, and is nil if they are
+	// disabled
+	Alertdb report.DBI
+
+	// QueryDeadLetters is nil if dead-lettering is disabled
+	QueryDeadLetters *queryDeadLetters
 }
 
 type KaRespData struct {
-	SKU         int64
-	Name        string
-	TotalWeight float64
-	SoldWeight  float64
-	Price       float64
+	SKU         int64   `proto:"1"`
+	Name        string  `proto:"2"`
+	TotalWeight float64 `proto:"3"`
+	SoldWeight  float64 `proto:"4"`
+	Price       float64 `proto:"5"`
 }
 
 func main() {
+	rebuildRollup := flag.Bool(
+		"rebuild-rollup", false,
+		"Rebuild the daily sales-rollup from the inventory, and exit",
+	)
+	replay := flag.Bool(
+		"replay", false,
+		"Rebuild the projections by replaying all events from the event-store, and exit",
+	)
+	replayDeadLetters := flag.Bool(
+		"replay-deadletters", false,
+		"Re-produce the dead-lettered events to the topics they were consumed from, and exit",
+	)
+	protoSchema := flag.Bool(
+		"proto-schema", false,
+		"Print the Protobuf schema of protobuf-encoded report-results, and exit",
+	)
+
+	// The export-subcommand exports a report to a file, and exits
+	var exportCfg *exportConfig
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		cfg, err := parseExport(os.Args[2:])
+		if err != nil {
+			err = errors.Wrap(err, "Error parsing export-arguments")
+			log.Fatalln(err)
+		}
+		exportCfg = cfg
+	} else {
+		flag.Parse()
+	}
+
+	if *protoSchema {
+		schema, err := codec.ProtoSchema("report", reportResults)
+		if err != nil {
+			err = errors.Wrap(err, "Error generating Protobuf schema")
+			log.Fatalln(err)
+		}
+		os.Stdout.Write(schema)
+		return
+	}
+
 	// Load environment-file.
 	// Env vars will be read directly from environment if this file fails loading
 	err := godotenv.Load()
@@ -39,22 +90,27 @@ func main() {
 		log.Println(err)
 	}
 
-	missingVar, err := commonutil.ValidateEnv(
-		"KAFKA_BROKERS",
-		"KAFKA_CONSUMER_EVENT_GROUP",
-		"KAFKA_CONSUMER_EVENT_TOPIC",
-		"KAFKA_CONSUMER_EVENT_QUERY_GROUP",
-		"KAFKA_CONSUMER_EVENT_QUERY_TOPIC",
-		"KAFKA_PRODUCER_EVENT_QUERY_TOPIC",
-		"KAFKA_PRODUCER_RESPONSE_TOPIC",
-
+	requiredVars := []string{
 		"MONGO_HOSTS",
 		"MONGO_USERNAME",
 		"MONGO_PASSWORD",
 		"MONGO_DATABASE",
 		// "MONGO_CONNECTION_TIMEOUT_MS",
 		// "MONGO_RESOURCE_TIMEOUT_MS",
-	)
+	}
+	// Exports only read from Mongo, so they run without a Kafka-config
+	if exportCfg == nil {
+		requiredVars = append(requiredVars,
+			"KAFKA_BROKERS",
+			"KAFKA_CONSUMER_EVENT_GROUP",
+			"KAFKA_CONSUMER_EVENT_TOPIC",
+			"KAFKA_CONSUMER_EVENT_QUERY_GROUP",
+			"KAFKA_CONSUMER_EVENT_QUERY_TOPIC",
+			"KAFKA_PRODUCER_EVENT_QUERY_TOPIC",
+			"KAFKA_PRODUCER_RESPONSE_TOPIC",
+		)
+	}
+	missingVar, err := commonutil.ValidateEnv(requiredVars...)
 	if err != nil {
 		log.Fatalf(
 			"Error: Environment variable %s is required but was not found", missingVar,
@@ -68,6 +124,10 @@ func main() {
 	collectionFlash := os.Getenv("MONGO_FLASH_COLLECTION")
 	collectionInv := os.Getenv("MONGO_INV_COLLECTION")
 	collectionMet := os.Getenv("MONGO_METRIC_COLLECTION")
+	collectionRollup := os.Getenv("MONGO_ROLLUP_COLLECTION")
+	if collectionRollup == "" {
+		collectionRollup = report.RollupCollection
+	}
 
 	consumerEventgroup := os.Getenv("KAFKA_CONSUMER_EVENT_GROUP")
 	consumerEventQueryGroup := os.Getenv("KAFKA_CONSUMER_EVENT_QUERY_GROUP")
@@ -114,6 +174,16 @@ func main() {
 		Collection:          collectionInv,
 	}
 
+	configRollup := report.DBIConfig{
+		Hosts:               *commonutil.ParseHosts(hosts),
+		Username:            username,
+		Password:            password,
+		TimeoutMilliseconds: timeoutMilli,
+		Database:            database,
+		Collection:          collectionRollup,
+		Indexes:             report.RollupIndexes,
+	}
+
 	dbFlash, err := report.GenerateDB(configFlash, &report.Flash{})
 	if err != nil {
 		err = errors.Wrap(err, "Error connecting to Inventory DB")
@@ -137,52 +207,295 @@ func main() {
 		return
 	}
 
+	dbRollup, err := report.GenerateDB(configRollup, &report.DailySold{})
+	if err != nil {
+		err = errors.Wrap(err, "Error connecting to Rollup DB")
+		log.Println(err)
+		return
+	}
+	dbInventory.UseRollup(dbRollup)
+
+	if *rebuildRollup {
+		log.Println("Rebuilding daily sales-rollup")
+		err = dbInventory.RebuildRollup()
+		if err != nil {
+			err = errors.Wrap(err, "Error rebuilding rollup")
+			log.Fatalln(err)
+		}
+		log.Println("Rebuilt daily sales-rollup")
+		return
+	}
+
+	if *replay {
+		log.Println("Replaying events into projections")
+		err = runReplay(configInv, configRollup, consumerEventQueryGroup)
+		if err != nil {
+			err = errors.Wrap(err, "Error replaying events")
+			log.Fatalln(err)
+		}
+		return
+	}
+
+	if *replayDeadLetters {
+		log.Println("Replaying dead-lettered events")
+		err = runDeadLetterReplay()
+		if err != nil {
+			err = errors.Wrap(err, "Error replaying dead-lettered events")
+			log.Fatalln(err)
+		}
+		return
+	}
+
 	// This Env is in file route_handlers.go
 	env := &Env{
 		Flashdb:     dbFlash,
 		Metricdb:    dbMetric,
 		Inventorydb: dbInventory,
+		Rollupdb:    dbRollup,
+	}
+
+	if exportCfg != nil {
+		err = runExport(env, exportCfg)
+		if err != nil {
+			err = errors.Wrap(err, "Error exporting report")
+			log.Fatalln(err)
+		}
+		return
 	}
 
-	kc := poll.KafkaConfig{
-		Brokers: []string{"kafka:9092"},
+	// Inventory-events keep the projections current without relying on
+	// other services, and are disabled unless enabled.
+	enableEvents := os.Getenv("ENABLE_INVENTORY_EVENTS") == "true"
+
+	// The transport consumes events and produces their responses
+	var publish publisher
+	var serve func()
+	transport := os.Getenv("EVENT_TRANSPORT")
+	switch transport {
+	case "", "eventspoll":
+		kc := poll.KafkaConfig{
+			Brokers: []string{"kafka:9092"},
+
+			ConsumerEventGroup:      consumerEventgroup,
+			ConsumerEventQueryGroup: consumerEventQueryGroup,
+
+			ConsumerEventTopic:      consumerEventTopic,
+			ConsumerEventQueryTopic: consumerEventQueryTopic,
+			ProducerEventQueryTopic: producerEventQueryTopic,
+			ProducerResponseTopic:   producerResponseTopic,
+		}
+
+		ioConfig := poll.IOConfig{
+			AggregateID: 4,
+			// Choose what type of events we need process
+			// Remember, adding a type here and not processing/listening to it will cause deadlocks!
+			ReadConfig: poll.ReadConfig{
+				EnableDelete: enableEvents,
+				EnableInsert: enableEvents,
+				EnableQuery:  true,
+				EnableUpdate: enableEvents,
+			},
+			KafkaConfig:     kc,
+			MongoCollection: dbInventory.Collection(),
+			// The number of times we allow failure to get max aggregate-version from DB.
+			// Check docs for more info.
+			MongoFailThreshold: 300,
+		}
+
+		// The Kafka-settings also configure chunking and dead-letters
+		adapter, err := kafkaAdapterFromEnv()
+		if err != nil {
+			err = errors.Wrap(err, "Error configuring KafkaAdapter")
+			log.Fatalln(err)
+		}
+
+		eventPoll, err := poll.Init(ioConfig)
+		if err != nil {
+			err = errors.Wrap(err, "Error creating EventPoll service")
+			log.Fatalln(err)
+		}
+		produce := func(kafkaResp *esmodel.KafkaResponse) {
+			parts, err := adapter.SplitResponse(kafkaResp)
+			if err != nil {
+				err = errors.Wrapf(
+					err, "Error chunking response for CorrelationID %s", kafkaResp.CorrelationID,
+				)
+				log.Println(err)
+				return
+			}
+			for _, part := range parts {
+				eventPoll.ProduceResult() <- part
+			}
+		}
+		// EventPoll produces no message-headers, so metadata is dropped
+		publish = func(resp *kafka.Response) {
+			produce(resp.KafkaResponse)
+		}
+		serve = func() {
+			serveEventPoll(env, eventPoll, enableEvents, produce)
+		}
+
+		if adapter.DeadLetterTopic != "" {
+			letters, err := adapter.InitDeadLetters()
+			if err != nil {
+				err = errors.Wrap(err, "Error creating DeadLetter producer")
+				log.Fatalln(err)
+			}
+			env.QueryDeadLetters = newQueryDeadLetters(consumerEventTopic, letters)
+		}
+
+	case "kafka":
+		missingVar, err := commonutil.ValidateEnv(
+			"KAFKA_CONSUMER_GROUP_REPORT",
+			"KAFKA_CONSUMER_TOPIC_REPORT",
+			"KAFKA_PRODUCER_TOPIC_REPORT",
+		)
+		if err != nil {
+			log.Fatalf(
+				"Error: Environment variable %s is required but was not found", missingVar,
+			)
+		}
 
-		ConsumerEventGroup:      consumerEventgroup,
-		ConsumerEventQueryGroup: consumerEventQueryGroup,
+		kio, err := initKafkaIOReport()
+		if err != nil {
+			err = errors.Wrap(err, "Error creating KafkaIO")
+			log.Fatalln(err)
+		}
+		publish = func(resp *kafka.Response) {
+			kio.Responses() <- resp
+		}
+		// Replayed DeadLetters are re-produced to the first consumer-topic
+		consumerTopics := *commonutil.ParseHosts(os.Getenv("KAFKA_CONSUMER_TOPIC_REPORT"))
+		env.QueryDeadLetters = newQueryDeadLetters(consumerTopics[0], kio.DeadLetters())
+		serve = func() {
+			serveKafkaIO(env, kio, enableEvents)
+		}
 
-		ConsumerEventTopic:      consumerEventTopic,
-		ConsumerEventQueryTopic: consumerEventQueryTopic,
-		ProducerEventQueryTopic: producerEventQueryTopic,
-		ProducerResponseTopic:   producerResponseTopic,
+	default:
+		log.Fatalf("Error: Unknown EVENT_TRANSPORT: %s", transport)
 	}
-	ioConfig := poll.IOConfig{
-		AggregateID: 4,
-		// Choose what type of events we need process
-		// Remember, adding a type here and not processing/listening to it will cause deadlocks!
-		ReadConfig: poll.ReadConfig{
-			EnableQuery: true,
-		},
-		KafkaConfig:     kc,
-		MongoCollection: dbInventory.Collection(),
-		// The number of times we allow failure to get max aggregate-version from DB.
-		// Check docs for more info.
-		MongoFailThreshold: 300,
+
+	// Anomaly-alerts are disabled unless an interval is set
+	alertInterval := os.Getenv("ANOMALY_ALERT_INTERVAL")
+	if alertInterval != "" {
+		interval, err := time.ParseDuration(alertInterval)
+		if err != nil {
+			err = errors.Wrap(err, "Error parsing ANOMALY_ALERT_INTERVAL")
+			log.Fatalln(err)
+		}
+		alertTopic := os.Getenv("KAFKA_PRODUCER_ALERT_TOPIC")
+		if alertTopic == "" {
+			log.Fatalln("KAFKA_PRODUCER_ALERT_TOPIC is required for anomaly-alerts")
+		}
+		collectionAlert := os.Getenv("MONGO_ALERT_COLLECTION")
+		if collectionAlert == "" {
+			collectionAlert = report.AlertCollection
+		}
+		configAlert := configInv
+		configAlert.Collection = collectionAlert
+		configAlert.Indexes = report.AlertIndexes
+		dbAlert, err := report.GenerateDB(configAlert, &report.PublishedAlert{})
+		if err != nil {
+			err = errors.Wrap(err, "Error connecting to Alert DB")
+			log.Fatalln(err)
+		}
+		err = dbAlert.ExpireAlerts()
+		if err != nil {
+			err = errors.Wrap(err, "Error creating alert-expiry")
+			log.Fatalln(err)
+		}
+		env.Alertdb = dbAlert
+		go runAnomalyAlerts(env, interval, alertTopic, publish)
 	}
 
-	eventPoll, err := poll.Init(ioConfig)
-	if err != nil {
-		err = errors.Wrap(err, "Error creating EventPoll service")
-		log.Fatalln(err)
+	// Scheduled reports are disabled unless a schedule-file is set
+	scheduleFile := os.Getenv("REPORT_SCHEDULE_FILE")
+	if scheduleFile != "" {
+		schedules, err := loadSchedules(scheduleFile)
+		if err != nil {
+			err = errors.Wrap(err, "Error loading report-schedules")
+			log.Fatalln(err)
+		}
+		scheduleTopic := os.Getenv("KAFKA_PRODUCER_SCHEDULE_TOPIC")
+		if scheduleTopic == "" {
+			log.Fatalln("KAFKA_PRODUCER_SCHEDULE_TOPIC is required for scheduled reports")
+		}
+		runSchedules(env, schedules, scheduleTopic, publish)
+	}
+
+	// The HTTP-API is disabled unless its address is set
+	apiAddr := os.Getenv("HTTP_API_ADDR")
+	if apiAddr != "" {
+		api, err := newHTTPAPI(env, os.Getenv("HTTP_API_TOKENS"))
+		if err != nil {
+			err = errors.Wrap(err, "Error configuring HTTP-API")
+			log.Fatalln(err)
+		}
+		go serveHTTPAPI(api, apiAddr)
+	}
+
+	serve()
+}
+
+// serveEventPoll handles the events from the EventPoll until its
+// query-channel closes, and produces the responses with produceResult.
+// Inventory-events are only read if enableEvents is set, matching the
+// EventPoll's ReadConfig.
+func serveEventPoll(
+	env *Env,
+	eventPoll poll.EventPoll,
+	enableEvents bool,
+	produceResult func(*esmodel.KafkaResponse),
+) {
+	// Channels of disabled event-types are nil, which never receive
+	var insertChan, updateChan, deleteChan <-chan *poll.EventResponse
+	if enableEvents {
+		insertChan = eventPoll.Insert()
+		updateChan = eventPoll.Update()
+		deleteChan = eventPoll.Delete()
+	}
+	queryChan := eventPoll.Query()
+
+	produce := func(kafkaResp *esmodel.KafkaResponse) {
+		if kafkaResp != nil {
+			produceResult(kafkaResp)
+		}
 	}
 
-	// Handle Insert events
-	for eventResp := range eventPoll.Query() {
-		go func() {
-			kafkaResp := handleQuery(eventResp, env)
-			if kafkaResp != nil {
-				eventPoll.ProduceResult() <- kafkaResp
+	for {
+		select {
+		// Inventory-events are applied in order, since later versions
+		// depend on earlier ones.
+		case eventResp, ok := <-insertChan:
+			if !ok {
+				insertChan = nil
+				continue
+			}
+			produce(handleInsert(eventResp, env))
+
+		case eventResp, ok := <-updateChan:
+			if !ok {
+				updateChan = nil
+				continue
 			}
-		}()
+			produce(handleUpdate(eventResp, env))
+
+		case eventResp, ok := <-deleteChan:
+			if !ok {
+				deleteChan = nil
+				continue
+			}
+			produce(handleDelete(eventResp, env))
+
+		case eventResp, ok := <-queryChan:
+			if !ok {
+				log.Println("Query-channel closed, exiting")
+				return
+			}
+			go func(eventResp *poll.EventResponse) {
+				produce(handleQuery(eventResp, env))
+			}(eventResp)
+		}
 	}
 }
 
@@ -195,40 +508,20 @@ func handleQuery(eventResp *poll.EventResponse, env *Env) *esmodel.KafkaResponse
 		return nil
 	}
 
-	var sParam map[string][]report.SearchParam
+	var query map[string]json.RawMessage
 	event := eventResp.Event
 	data := event.Data
-	err = json.Unmarshal(data, &sParam)
-	if err != nil {
-		err = errors.Wrap(err, "Some error occurred")
-		log.Println(err)
-		return nil
-	}
-
-	searchResults, err := env.Inventorydb.InvAdvSearch(sParam)
+	err = json.Unmarshal(data, &query)
 	if err != nil {
-		err = errors.Wrap(err, "Unable to search inventory using search parameters")
+		err = errors.Wrap(err, "Error unmarshalling query")
 		log.Println(err)
-		return nil
+		return poisonResponse(env, event, err)
 	}
 
-	var kaResp []KaRespData
-
-	for _, v := range searchResults {
-		kaResp = append(kaResp, KaRespData{
-			SKU:         v.SKU,
-			Name:        v.Name,
-			TotalWeight: v.TotalWeight,
-			SoldWeight:  v.SoldWeight,
-			Price:       v.Price,
-		})
-	}
-
-	kaRespByte, err := json.Marshal(&kaResp)
+	kaRespByte, _, err := runQuery(env, query)
 	if err != nil {
-		err = errors.Wrap(err, "Did not marshal KaRespData")
 		log.Println(err)
-		return nil
+		return poisonResponse(env, event, err)
 	}
 
 	return &esmodel.KafkaResponse{
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/TerrexTech/go-commonutils/commonutil"
+	esmodel "github.com/TerrexTech/go-eventstore-models/model"
+	"github.com/TerrexTech/go-kafkautils/consumer"
+	"github.com/TerrexTech/go-kafkautils/producer"
+	"github.com/TerrexTech/go-report-productsold/report"
+	"github.com/TerrexTech/uuuid"
+	cluster "github.com/bsm/sarama-cluster"
+	"github.com/pkg/errors"
+)
+
+// ReaderConfig configures the eventStoreReader.
+type ReaderConfig struct {
+	Brokers     []string
+	AggregateID int8
+	YearBucket  int16
+	// ConsumerGroup is suffixed with a unique ID, so the reader only
+	// receives responses to its own queries.
+	ConsumerGroup string
+	// QueryTopic is where event-store queries are produced.
+	QueryTopic string
+	// ResponseTopic is where the event-store responds with events.
+	ResponseTopic string
+	// Timeout is how long to wait for each event-store response.
+	Timeout time.Duration
+}
+
+// eventStoreReader queries the event-store for the events of an aggregate.
+type eventStoreReader struct {
+	config   ReaderConfig
+	consumer *consumer.Consumer
+	producer *producer.Producer
+	input    chan<- *sarama.ProducerMessage
+}
+
+// newEventStoreReader connects to Kafka, and waits for the response-consumer
+// to be assigned its partitions, so no responses are missed.
+func newEventStoreReader(config ReaderConfig) (*eventStoreReader, error) {
+	groupID, err := uuuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating consumer-group ID")
+	}
+
+	saramaCfg := cluster.NewConfig()
+	saramaCfg.Consumer.Offsets.Initial = sarama.OffsetNewest
+	saramaCfg.Consumer.Return.Errors = true
+	saramaCfg.Group.Return.Notifications = true
+
+	respConsumer, err := consumer.New(&consumer.Config{
+		ConsumerGroup: config.ConsumerGroup + ".replay." + groupID.String(),
+		KafkaBrokers:  config.Brokers,
+		SaramaConfig:  saramaCfg,
+		Topics:        []string{config.ResponseTopic},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating response-consumer")
+	}
+
+	notifications := respConsumer.SaramaConsumerGroup().Notifications()
+	select {
+	case <-notifications:
+	case <-time.After(config.Timeout):
+		respConsumer.Close()
+		return nil, errors.New("Timed out waiting for response-consumer partitions")
+	}
+	// Later rebalances are of no interest, but must be drained
+	go func() {
+		for range notifications {
+		}
+	}()
+
+	queryProducer, err := producer.New(&producer.Config{
+		KafkaBrokers: config.Brokers,
+	})
+	if err != nil {
+		respConsumer.Close()
+		return nil, errors.Wrap(err, "Error creating query-producer")
+	}
+	input, err := queryProducer.Input()
+	if err != nil {
+		respConsumer.Close()
+		queryProducer.Close()
+		return nil, errors.Wrap(err, "Error getting query-producer input")
+	}
+
+	return &eventStoreReader{
+		config:   config,
+		consumer: respConsumer,
+		producer: queryProducer,
+		input:    input,
+	}, nil
+}
+
+// events queries the event-store for the events after the aggregate-version,
+// sorted by version.
+func (r *eventStoreReader) events(since int64) ([]esmodel.Event, error) {
+	correlationID, err := uuuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating CorrelationID")
+	}
+	query, err := json.Marshal(esmodel.EventStoreQuery{
+		AggregateID:      r.config.AggregateID,
+		AggregateVersion: since,
+		CorrelationID:    correlationID,
+		YearBucket:       r.config.YearBucket,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Error marshalling EventStoreQuery")
+	}
+	r.input <- producer.CreateMessage(r.config.QueryTopic, query)
+
+	timeout := time.After(r.config.Timeout)
+	for {
+		select {
+		case msg := <-r.consumer.Messages():
+			var resp esmodel.KafkaResponse
+			err := json.Unmarshal(msg.Value, &resp)
+			if err != nil {
+				err = errors.Wrap(err, "Error unmarshalling event-store response")
+				log.Println(err)
+				continue
+			}
+			if resp.CorrelationID.String() != correlationID.String() {
+				continue
+			}
+			if resp.Error != "" {
+				return nil, errors.Errorf("Event-store responded with error: %s", resp.Error)
+			}
+
+			var events []esmodel.Event
+			err = json.Unmarshal(resp.Result, &events)
+			if err != nil {
+				return nil, errors.Wrap(err, "Error unmarshalling events")
+			}
+			newer := []esmodel.Event{}
+			for _, e := range events {
+				if e.Version > since {
+					newer = append(newer, e)
+				}
+			}
+			sort.SliceStable(newer, func(i, j int) bool {
+				return newer[i].Version < newer[j].Version
+			})
+			return newer, nil
+
+		case err := <-r.consumer.Errors():
+			return nil, errors.Wrap(err, "Error consuming event-store response")
+
+		case err := <-r.producer.Errors():
+			return nil, errors.Wrap(err, "Error producing EventStoreQuery")
+
+		case <-timeout:
+			return nil, errors.Errorf(
+				"Timed out waiting for events after version %d", since,
+			)
+		}
+	}
+}
+
+func (r *eventStoreReader) close() {
+	r.consumer.Close()
+	r.producer.Close()
+}
+
+// runReplay replays the events from the event-store into shadow-collections
+// of the inventory and rollup configs, and swaps them in.
+func runReplay(configInv, configRollup report.DBIConfig, consumerGroup string) error {
+	yearBucket := time.Now().Year()
+	if bucket := os.Getenv("EVENT_YEAR_BUCKET"); bucket != "" {
+		var err error
+		yearBucket, err = strconv.Atoi(bucket)
+		if err != nil {
+			return errors.Wrap(err, "Error parsing EVENT_YEAR_BUCKET")
+		}
+	}
+	timeout := 30 * time.Second
+	if t := os.Getenv("REPLAY_RESPONSE_TIMEOUT"); t != "" {
+		var err error
+		timeout, err = time.ParseDuration(t)
+		if err != nil {
+			return errors.Wrap(err, "Error parsing REPLAY_RESPONSE_TIMEOUT")
+		}
+	}
+
+	shadowInvConfig := configInv
+	shadowInvConfig.Collection += report.ShadowSuffix
+	shadowInv, err := report.GenerateDB(shadowInvConfig, &report.Inventory{})
+	if err != nil {
+		return errors.Wrap(err, "Error connecting to shadow-inventory")
+	}
+	shadowRollupConfig := configRollup
+	shadowRollupConfig.Collection += report.ShadowSuffix
+	shadowRollup, err := report.GenerateDB(shadowRollupConfig, &report.DailySold{})
+	if err != nil {
+		return errors.Wrap(err, "Error connecting to shadow-rollup")
+	}
+
+	reader, err := newEventStoreReader(ReaderConfig{
+		Brokers:       *commonutil.ParseHosts(os.Getenv("KAFKA_BROKERS")),
+		AggregateID:   4,
+		YearBucket:    int16(yearBucket),
+		ConsumerGroup: consumerGroup,
+		QueryTopic:    os.Getenv("KAFKA_PRODUCER_EVENT_QUERY_TOPIC"),
+		ResponseTopic: os.Getenv("KAFKA_CONSUMER_EVENT_QUERY_TOPIC"),
+		Timeout:       timeout,
+	})
+	if err != nil {
+		return errors.Wrap(err, "Error creating event-store reader")
+	}
+	defer reader.close()
+
+	return replayProjections(
+		reader, shadowInv, shadowRollup, configInv.Collection, configRollup.Collection,
+	)
+}
+
+// replayProjections rebuilds the inventory and rollup projections by
+// replaying all events of the aggregate into shadow-collections, which are
+// then swapped in for the live collections. Each swap is atomic, but events
+// applied to the live collections during the replay are lost, so the
+// service should not be consuming events while replaying.
+func replayProjections(
+	reader *eventStoreReader,
+	shadowInv *report.DB,
+	shadowRollup *report.DB,
+	liveInv string,
+	liveRollup string,
+) error {
+	err := shadowInv.Drop()
+	if err != nil {
+		return errors.Wrap(err, "Error clearing shadow-inventory")
+	}
+
+	var version int64
+	var applied int
+	for {
+		events, err := reader.events(version)
+		if err != nil {
+			return errors.Wrap(err, "Error fetching events")
+		}
+		if len(events) == 0 {
+			break
+		}
+
+		for _, event := range events {
+			if event.Action == "query" {
+				continue
+			}
+			_, err = applyEvent(shadowInv, event)
+			if err != nil {
+				return errors.Wrapf(
+					err, "Error applying event %s of version %d", event.UUID, event.Version,
+				)
+			}
+			applied++
+		}
+		version = events[len(events)-1].Version
+		log.Printf("Replayed %d events, up to version %d", applied, version)
+	}
+
+	// Swapping in empty projections is more likely a misconfiguration,
+	// such as the wrong year-bucket, than intended.
+	if applied == 0 {
+		return errors.New("No events replayed, keeping the live projections")
+	}
+
+	shadowInv.UseRollup(shadowRollup)
+	err = shadowInv.RebuildRollup()
+	if err != nil {
+		return errors.Wrap(err, "Error rebuilding shadow-rollup")
+	}
+
+	err = shadowInv.SwapInto(liveInv)
+	if err != nil {
+		return errors.Wrap(err, "Error swapping in inventory")
+	}
+	err = shadowRollup.SwapInto(liveRollup)
+	if err != nil {
+		return errors.Wrap(err, "Error swapping in rollup")
+	}
+	log.Printf("Swapped in projections replayed up to version %d", version)
+	return nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/TerrexTech/go-report-productsold/codec"
+	"github.com/TerrexTech/go-report-productsold/report"
+	"github.com/pkg/errors"
+)
+
+// reportHandler runs a report from its JSON-encoded parameters.
+type reportHandler func(env *Env, params json.RawMessage) (interface{}, error)
+
+// reportHandlers maps the report-types to their handlers. The report-type
+// is the key of the query-event data, so {"comparison": {...}} runs the
+// comparison-report.
+var reportHandlers = map[string]reportHandler{
+	"inventory":        inventorySearch,
+	"comparison":       soldComparison,
+	"ranking":          rankings,
+	"expiry":           expiryRisk,
+	"flash_candidates": flashCandidates,
+	"markdown":         markdown,
+	"origin":           originPerformance,
+	"days_to_sell":     daysToSell,
+	"forecast":         forecast,
+	"anomalies":        anomalies,
+}
+
+// reportResults are values of the result-types of the report-types, from
+// which the Protobuf schema of results is generated.
+var reportResults = map[string]interface{}{
+	"inventory":        []KaRespData{},
+	"comparison":       &report.ComparisonReport{},
+	"ranking":          []report.Ranking{},
+	"expiry":           []report.ExpiryRisk{},
+	"flash_candidates": []report.FlashCandidate{},
+	"markdown":         []report.Markdown{},
+	"origin":           []report.OriginPerformance{},
+	"days_to_sell":     []report.DaysToSellDistribution{},
+	"forecast":         []report.Forecast{},
+	"anomalies":        []report.Anomaly{},
+}
+
+// runReport runs the single report requested in query.
+func runReport(env *Env, query map[string]json.RawMessage) (interface{}, error) {
+	if len(query) != 1 {
+		return nil, errors.Wrap(errInvalidQuery, "Query must contain exactly one report-type")
+	}
+
+	for reportType, params := range query {
+		handler, exists := reportHandlers[reportType]
+		if !exists {
+			return nil, errors.Wrapf(errInvalidQuery, "Unknown report-type: %s", reportType)
+		}
+		return handler(env, params)
+	}
+	return nil, nil
+}
+
+// runQuery runs the report of the query, and encodes its result with the
+// encoder the query selects.
+func runQuery(env *Env, query map[string]json.RawMessage) ([]byte, codec.Encoder, error) {
+	encoder, err := queryEncoder(query)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Error selecting encoding")
+	}
+	result, err := runReport(env, query)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Error running report")
+	}
+	encoded, err := encoder.Encode(result)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Error encoding report-result")
+	}
+	return encoded, encoder, nil
+}
+
+func inventorySearch(env *Env, params json.RawMessage) (interface{}, error) {
+	var sParam []report.SearchParam
+	err := json.Unmarshal(params, &sParam)
+	if err != nil {
+		err = errors.Wrap(err, "Error unmarshalling SearchParams")
+		return nil, err
+	}
+
+	searchResults, err := env.Inventorydb.InvAdvSearch(
+		map[string][]report.SearchParam{
+			"inventory": sParam,
+		},
+	)
+	if err != nil {
+		err = errors.Wrap(err, "Unable to search inventory using search parameters")
+		return nil, err
+	}
+
+	var kaResp []KaRespData
+	for _, v := range searchResults {
+		kaResp = append(kaResp, KaRespData{
+			SKU:         v.SKU,
+			Name:        v.Name,
+			TotalWeight: v.TotalWeight,
+			SoldWeight:  v.SoldWeight,
+			Price:       v.Price,
+		})
+	}
+	return kaResp, nil
+}
+
+func soldComparison(env *Env, params json.RawMessage) (interface{}, error) {
+	var cParams report.ComparisonParams
+	err := json.Unmarshal(params, &cParams)
+	if err != nil {
+		err = errors.Wrap(err, "Error unmarshalling ComparisonParams")
+		return nil, err
+	}
+
+	return env.Inventorydb.SoldComparison(cParams)
+}
+
+func rankings(env *Env, params json.RawMessage) (interface{}, error) {
+	var rParams report.RankingParams
+	err := json.Unmarshal(params, &rParams)
+	if err != nil {
+		err = errors.Wrap(err, "Error unmarshalling RankingParams")
+		return nil, err
+	}
+
+	return env.Inventorydb.Rankings(rParams)
+}
+
+func expiryRisk(env *Env, params json.RawMessage) (interface{}, error) {
+	var eParams report.ExpiryRiskParams
+	err := json.Unmarshal(params, &eParams)
+	if err != nil {
+		err = errors.Wrap(err, "Error unmarshalling ExpiryRiskParams")
+		return nil, err
+	}
+
+	return env.Inventorydb.ExpiryRisk(eParams)
+}
+
+func flashCandidates(env *Env, params json.RawMessage) (interface{}, error) {
+	var fParams report.FlashCandidateParams
+	err := json.Unmarshal(params, &fParams)
+	if err != nil {
+		err = errors.Wrap(err, "Error unmarshalling FlashCandidateParams")
+		return nil, err
+	}
+
+	return env.Inventorydb.FlashCandidates(env.Metricdb, fParams)
+}
+
+func markdown(env *Env, params json.RawMessage) (interface{}, error) {
+	var mParams report.MarkdownParams
+	err := json.Unmarshal(params, &mParams)
+	if err != nil {
+		err = errors.Wrap(err, "Error unmarshalling MarkdownParams")
+		return nil, err
+	}
+
+	return env.Inventorydb.Markdown(env.Flashdb, mParams)
+}
+
+func originPerformance(env *Env, params json.RawMessage) (interface{}, error) {
+	var oParams report.OriginPerformanceParams
+	err := json.Unmarshal(params, &oParams)
+	if err != nil {
+		err = errors.Wrap(err, "Error unmarshalling OriginPerformanceParams")
+		return nil, err
+	}
+
+	return env.Inventorydb.OriginPerformance(oParams)
+}
+
+func daysToSell(env *Env, params json.RawMessage) (interface{}, error) {
+	var dParams report.DaysToSellParams
+	err := json.Unmarshal(params, &dParams)
+	if err != nil {
+		err = errors.Wrap(err, "Error unmarshalling DaysToSellParams")
+		return nil, err
+	}
+
+	return env.Inventorydb.DaysToSell(dParams)
+}
+
+func forecast(env *Env, params json.RawMessage) (interface{}, error) {
+	var fParams report.ForecastParams
+	err := json.Unmarshal(params, &fParams)
+	if err != nil {
+		err = errors.Wrap(err, "Error unmarshalling ForecastParams")
+		return nil, err
+	}
+
+	return env.Inventorydb.Forecast(fParams)
+}
+
+func anomalies(env *Env, params json.RawMessage) (interface{}, error) {
+	var aParams report.AnomalyParams
+	err := json.Unmarshal(params, &aParams)
+	if err != nil {
+		err = errors.Wrap(err, "Error unmarshalling AnomalyParams")
+		return nil, err
+	}
+
+	return env.Inventorydb.Anomalies(env.Metricdb, aParams)
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"io/ioutil"
+
+	"github.com/TerrexTech/go-report-productsold/codec"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Report results", func() {
+	// Clients generate their decoders from the published schema, so changing
+	// the field-numbers of the results breaks them.
+	It("should match the published Protobuf schema", func() {
+		published, err := ioutil.ReadFile("../proto/report.proto")
+		Expect(err).ToNot(HaveOccurred())
+
+		schema, err := codec.ProtoSchema("report", reportResults)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(schema)).To(Equal(string(published)))
+	})
+})
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"time"
+
+	esmodel "github.com/TerrexTech/go-eventstore-models/model"
+	"github.com/TerrexTech/go-report-productsold/codec"
+	"github.com/TerrexTech/go-report-productsold/kafka"
+	"github.com/TerrexTech/go-report-productsold/schedule"
+	"github.com/pkg/errors"
+)
+
+// ScheduleConfig is a report run on a cron-schedule for a tenant.
+type ScheduleConfig struct {
+	// Name identifies the schedule in logs and published results.
+	Name string `json:"name"`
+	// Cron is a 5-field cron-expression, such as "0 6 * * *" for 6 AM daily.
+	Cron string `json:"cron"`
+	// Timezone is the IANA location the Cron is evaluated in.
+	// Defaults to UTC.
+	Timezone string `json:"timezone,omitempty"`
+	// Tenant is the rs_customer_id the report is restricted to.
+	// An empty Tenant runs the report across all tenants.
+	Tenant string `json:"tenant,omitempty"`
+	// Report is the report-type, as in query-events.
+	Report string          `json:"report"`
+	Params json.RawMessage `json:"params,omitempty"`
+	// Encoding is the encoding of the result, as in query-events.
+	// Defaults to JSON.
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// ScheduledResult is the message published for each scheduled run.
+type ScheduledResult struct {
+	Schedule string `json:"schedule"`
+	Report   string `json:"report"`
+	Tenant   string `json:"tenant,omitempty"`
+	// GeneratedAt is the Unix timestamp of the scheduled activation.
+	GeneratedAt int64 `json:"generated_at"`
+	// Result is the JSON-encoded result, if the schedule's Encoding is JSON.
+	Result json.RawMessage `json:"result,omitempty"`
+	// Encoding and Encoded are the result in other encodings.
+	Encoding string `json:"encoding,omitempty"`
+	Encoded  []byte `json:"encoded,omitempty"`
+}
+
+// scheduledReport is a validated ScheduleConfig.
+type scheduledReport struct {
+	config   ScheduleConfig
+	cron     *schedule.Cron
+	location *time.Location
+	encoder  codec.Encoder
+}
+
+// loadSchedules reads and validates the JSON array of ScheduleConfigs
+// from the file at path.
+func loadSchedules(path string) ([]scheduledReport, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading schedule-file")
+	}
+	var configs []ScheduleConfig
+	err = json.Unmarshal(data, &configs)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error unmarshalling schedule-file")
+	}
+
+	schedules := make([]scheduledReport, len(configs))
+	for i, config := range configs {
+		if _, exists := reportHandlers[config.Report]; !exists {
+			return nil, errors.Errorf(
+				"Unknown report-type %s in schedule %s", config.Report, config.Name,
+			)
+		}
+		cron, err := schedule.Parse(config.Cron)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid cron in schedule %s", config.Name)
+		}
+		location, err := time.LoadLocation(config.Timezone)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid timezone in schedule %s", config.Name)
+		}
+		encoder, err := codec.Lookup(config.Encoding)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid encoding in schedule %s", config.Name)
+		}
+
+		if config.Tenant != "" {
+			config.Params, err = scopeToTenant(config.Report, config.Params, config.Tenant)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Error scoping schedule %s to tenant", config.Name)
+			}
+		}
+		schedules[i] = scheduledReport{
+			config:   config,
+			cron:     cron,
+			location: location,
+			encoder:  encoder,
+		}
+	}
+	return schedules, nil
+}
+
+// runSchedules runs each scheduled report on its schedule, producing the
+// results to topic, until the process exits.
+func runSchedules(
+	env *Env,
+	schedules []scheduledReport,
+	topic string,
+	publish publisher,
+) {
+	for _, s := range schedules {
+		go runSchedule(env, s, topic, publish)
+	}
+}
+
+func runSchedule(
+	env *Env,
+	s scheduledReport,
+	topic string,
+	publish publisher,
+) {
+	for {
+		next := s.cron.Next(time.Now().In(s.location))
+		if next.IsZero() {
+			log.Printf("Schedule %s never activates, stopping it", s.config.Name)
+			return
+		}
+		time.Sleep(time.Until(next))
+
+		kafkaResp, err := runScheduled(env, s, next)
+		if err != nil {
+			err = errors.Wrapf(err, "Error running schedule %s", s.config.Name)
+			log.Println(err)
+			continue
+		}
+		kafkaResp.Topic = topic
+		publish(&kafka.Response{
+			KafkaResponse: kafkaResp,
+			ReportType:    s.config.Report,
+			Tenant:        s.config.Tenant,
+			// The Result is the JSON-encoded ScheduledResult
+			ResultType: codec.JSON{}.ContentType(),
+		})
+	}
+}
+
+// runScheduled runs the scheduled report for its activation at.
+func runScheduled(env *Env, s scheduledReport, at time.Time) (*esmodel.KafkaResponse, error) {
+	params := s.config.Params
+	if len(params) == 0 {
+		params = json.RawMessage("{}")
+		if s.config.Report == "inventory" {
+			params = json.RawMessage("[]")
+		}
+	}
+	result, err := runReport(env, map[string]json.RawMessage{
+		s.config.Report: params,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Error running report")
+	}
+
+	encoded, err := s.encoder.Encode(result)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error encoding report-result")
+	}
+	scheduled := ScheduledResult{
+		Schedule:    s.config.Name,
+		Report:      s.config.Report,
+		Tenant:      s.config.Tenant,
+		GeneratedAt: at.Unix(),
+	}
+	if _, isJSON := s.encoder.(codec.JSON); isJSON {
+		scheduled.Result = encoded
+	} else {
+		scheduled.Encoding = s.config.Encoding
+		scheduled.Encoded = encoded
+	}
+	msg, err := json.Marshal(scheduled)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error marshalling scheduled-result")
+	}
+
+	return &esmodel.KafkaResponse{
+		AggregateID: 4,
+		Result:      msg,
+	}, nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/TerrexTech/go-report-productsold/report"
+	"github.com/pkg/errors"
+)
+
+// tenantField is the inventory-field identifying the tenant (store).
+const tenantField = "rs_customer_id"
+
+// errUnscopedReport is returned when scoping a report-type to a tenant whose
+// filters do not restrict all the data it reports.
+var errUnscopedReport = errors.New("Report-type cannot be scoped to a tenant")
+
+// tenantScopedReports are the report-types whose filters restrict all the
+// data they report, including the metric-readings and flash-sales they
+// join, so they can be scoped to a tenant by a tenant-filter. Report-types
+// must be added here once their filters are applied throughout, and are
+// refused for single tenants otherwise. Anomalies are only scoped for the
+// sales-source, since metric-readings have no tenant-field.
+var tenantScopedReports = map[string]bool{
+	"inventory":        true,
+	"comparison":       true,
+	"ranking":          true,
+	"expiry":           true,
+	"flash_candidates": true,
+	"markdown":         true,
+	"origin":           true,
+	"days_to_sell":     true,
+	"forecast":         true,
+	"anomalies":        true,
+}
+
+// scopeToTenant restricts the report-params to the inventory of the tenant,
+// by adding a tenant-filter to them. The params of the "inventory" report
+// are the filters themselves, while other reports take their filters under
+// the "filters" key. Returns errUnscopedReport for report-types not in
+// tenantScopedReports, and for sensor-anomalies.
+func scopeToTenant(reportType string, params json.RawMessage, tenant string) (json.RawMessage, error) {
+	if !tenantScopedReports[reportType] {
+		return nil, errors.Wrapf(errUnscopedReport, "Report-type %s", reportType)
+	}
+	tenantFilter := report.SearchParam{
+		Field: tenantField,
+		Type:  "string",
+		Equal: tenant,
+	}
+
+	if reportType == "inventory" {
+		var filters []report.SearchParam
+		if len(params) > 0 && string(params) != "null" {
+			err := json.Unmarshal(params, &filters)
+			if err != nil {
+				return nil, errors.Wrap(err, "Error unmarshalling SearchParams")
+			}
+		}
+		return json.Marshal(append(withoutTenant(filters), tenantFilter))
+	}
+
+	fields := map[string]json.RawMessage{}
+	if len(params) > 0 && string(params) != "null" {
+		err := json.Unmarshal(params, &fields)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error unmarshalling report-params")
+		}
+	}
+	if reportType == "anomalies" && isSensorSource(fields) {
+		return nil, errors.Wrapf(errUnscopedReport, "Anomaly-source %s", report.SourceSensors)
+	}
+	var filters []report.SearchParam
+	for key, raw := range fields {
+		if !strings.EqualFold(key, "filters") {
+			continue
+		}
+		var keyFilters []report.SearchParam
+		err := json.Unmarshal(raw, &keyFilters)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error unmarshalling report-filters")
+		}
+		filters = append(filters, keyFilters...)
+	}
+
+	scoped, err := json.Marshal(append(withoutTenant(filters), tenantFilter))
+	if err != nil {
+		return nil, errors.Wrap(err, "Error marshalling report-filters")
+	}
+	// Params are unmarshalled case-insensitively, so differently cased keys
+	// would also set the filters
+	for key := range fields {
+		if strings.EqualFold(key, "filters") {
+			delete(fields, key)
+		}
+	}
+	fields["filters"] = scoped
+	return json.Marshal(fields)
+}
+
+// isSensorSource returns whether the anomaly-params select the
+// sensors-source. Params are unmarshalled case-insensitively, so any
+// differently cased source-key selecting it counts.
+func isSensorSource(fields map[string]json.RawMessage) bool {
+	for key, raw := range fields {
+		if !strings.EqualFold(key, "source") {
+			continue
+		}
+		var source string
+		json.Unmarshal(raw, &source)
+		if source == report.SourceSensors {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutTenant drops any existing tenant-filters, so they cannot widen
+// or override the tenant-scope.
+func withoutTenant(filters []report.SearchParam) []report.SearchParam {
+	scoped := []report.SearchParam{}
+	for _, f := range filters {
+		if f.Field != tenantField {
+			scoped = append(scoped, f)
+		}
+	}
+	return scoped
+}
+
+// queryMetadata returns the report-type of the query-event data, and the
+// tenant its params are restricted to. Both are empty if the data is not a
+// single report, and the tenant is empty if the report is not restricted to
+// exactly one tenant.
+func queryMetadata(data []byte) (string, string) {
+	var query map[string]json.RawMessage
+	err := json.Unmarshal(data, &query)
+	delete(query, encodingKey)
+	if err != nil || len(query) != 1 {
+		return "", ""
+	}
+
+	for reportType, params := range query {
+		// Metadata is best-effort, so malformed params just have no tenant
+		var filters []report.SearchParam
+		if reportType == "inventory" {
+			json.Unmarshal(params, &filters)
+		} else {
+			var fields struct {
+				Filters []report.SearchParam `json:"filters"`
+			}
+			json.Unmarshal(params, &fields)
+			filters = fields.Filters
+		}
+
+		tenant := ""
+		for _, f := range filters {
+			if f.Field != tenantField {
+				continue
+			}
+			if tenant != "" && tenant != f.Equal {
+				return reportType, ""
+			}
+			tenant = f.Equal
+		}
+		return reportType, tenant
+	}
+	return "", ""
+}
@@ -0,0 +1,95 @@
+package report
+
+import (
+	"strconv"
+
+	"github.com/TerrexTech/go-mongoutils/mongo"
+	"github.com/pkg/errors"
+)
+
+// effectivePriceExpr is the price an item was actually sold at:
+// the sale-price if one was set, else the list-price.
+var effectivePriceExpr = map[string]interface{}{
+	"$cond": []interface{}{
+		map[string]interface{}{
+			"$gt": []interface{}{"$sale_price", 0},
+		},
+		"$sale_price",
+		"$price",
+	},
+}
+
+// revenueExpr is the realized revenue of an inventory document.
+var revenueExpr = map[string]interface{}{
+	"$multiply": []interface{}{"$sold_weight", effectivePriceExpr},
+}
+
+// aggregate runs the aggregation-pipeline on the collection and returns
+// the resulting documents.
+func (db *DB) aggregate(pipeline []interface{}) ([]map[string]interface{}, error) {
+	return aggregateDocs(db.collection, pipeline)
+}
+
+// aggregateDocs runs the aggregation-pipeline on the provided collection.
+func aggregateDocs(
+	c *mongo.Collection,
+	pipeline []interface{},
+) ([]map[string]interface{}, error) {
+	aggResults, err := c.Aggregate(pipeline)
+	if err != nil {
+		err = errors.Wrap(err, "Error running aggregation")
+		return nil, err
+	}
+
+	docs := make([]map[string]interface{}, len(aggResults))
+	for i, r := range aggResults {
+		doc, ok := r.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("Unexpected aggregation-result type")
+		}
+		docs[i] = doc
+	}
+	return docs, nil
+}
+
+// toFloat64 converts a numeric value decoded from BSON into float64.
+func toFloat64(v interface{}) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case int:
+		return float64(n)
+	case string:
+		f, _ := strconv.ParseFloat(n, 64)
+		return f
+	}
+	return 0
+}
+
+// toInt64 converts a numeric value decoded from BSON into int64.
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case int32:
+		return int64(n)
+	case int:
+		return int64(n)
+	case float64:
+		return int64(n)
+	case string:
+		i, _ := strconv.ParseInt(n, 10, 64)
+		return i
+	}
+	return 0
+}
+
+// toString converts a value decoded from BSON into string.
+func toString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
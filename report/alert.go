@@ -0,0 +1,103 @@
+package report
+
+import (
+	"log"
+	"time"
+
+	"github.com/TerrexTech/go-mongoutils/mongo"
+	"github.com/mongodb/mongo-go-driver/bson"
+	mgo "github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/updateopt"
+	"github.com/pkg/errors"
+)
+
+// AlertCollection is the default collection of published alerts.
+const AlertCollection = "agg_productsold_alerts"
+
+// PublishedAlert records an alert as published until it expires, so it is
+// published once across restarts and instances.
+type PublishedAlert struct {
+	Key string `bson:"key" json:"key"`
+	// ExpiresAt is a BSON date, as TTL-indexes require.
+	ExpiresAt time.Time `bson:"expires_at" json:"expires_at"`
+}
+
+// AlertIndexes are the indexes of the alert-collection. The unique key keeps
+// concurrent checks from recording an alert twice. Use ExpireAlerts for
+// removing expired alerts.
+var AlertIndexes = []mongo.IndexConfig{
+	mongo.IndexConfig{
+		ColumnConfig: []mongo.IndexColumnConfig{
+			mongo.IndexColumnConfig{Name: "key"},
+		},
+		IsUnique: true,
+		Name:     "alert_key_index",
+	},
+}
+
+// ExpireAlerts creates the TTL-index which removes recorded alerts once
+// their ExpiresAt has passed.
+func (db *DB) ExpireAlerts() error {
+	ctx, cancel := db.timeoutContext()
+	defer cancel()
+
+	_, err := db.collection.Collection().Indexes().CreateOne(ctx, mgo.IndexModel{
+		Keys: bson.NewDocument(bson.EC.Int32("expires_at", 1)),
+		Options: mgo.NewIndexOptionsBuilder().
+			Name("alert_expiry_index").
+			ExpireAfterSeconds(0).
+			Build(),
+	})
+	if err != nil {
+		err = errors.Wrap(err, "Error creating alert-expiry index - ExpireAlerts")
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// RecordAlert records the alert with the key as published until expiresAt.
+// Returns false if the alert was already recorded, and is not to be
+// published again.
+func (db *DB) RecordAlert(key string, expiresAt time.Time) (bool, error) {
+	ctx, cancel := db.timeoutContext()
+	defer cancel()
+
+	result, err := db.collection.Collection().UpdateOne(
+		ctx,
+		map[string]interface{}{
+			"key": key,
+		},
+		bson.NewDocument(
+			bson.EC.SubDocument("$setOnInsert", bson.NewDocument(
+				bson.EC.String("key", key),
+				bson.EC.DateTime("expires_at", expiresAt.UnixNano()/int64(time.Millisecond)),
+			)),
+		),
+		updateopt.Upsert(true),
+	)
+	// A concurrent upsert of the key recorded it first
+	if isDuplicateKey(err) {
+		return false, nil
+	}
+	if err != nil {
+		err = errors.Wrap(err, "Error recording alert - RecordAlert")
+		log.Println(err)
+		return false, err
+	}
+	return result.UpsertedID != nil, nil
+}
+
+// isDuplicateKey returns whether the error is from a unique index.
+func isDuplicateKey(err error) bool {
+	writeErrs, isWriteErrs := err.(mgo.WriteErrors)
+	if !isWriteErrs {
+		return false
+	}
+	for _, writeErr := range writeErrs {
+		if writeErr.Code == 11000 {
+			return true
+		}
+	}
+	return false
+}
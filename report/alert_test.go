@@ -0,0 +1,46 @@
+package report
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Published alerts", func() {
+	var dbAlert *DB
+
+	testDatabase := "rns_report_alert_test"
+
+	BeforeEach(func() {
+		config := testDBConfig(testDatabase, AlertCollection)
+		config.Indexes = AlertIndexes
+		var err error
+		dbAlert, err = GenerateDB(config, &PublishedAlert{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dbAlert.ExpireAlerts()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		dropTestDB(testDatabase)
+	})
+
+	It("should record each alert once", func() {
+		expiresAt := time.Now().Add(time.Hour)
+		isNew, err := dbAlert.RecordAlert("sales/1//sold_weight/1539734400", expiresAt)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(isNew).To(BeTrue())
+
+		isNew, err = dbAlert.RecordAlert("sales/1//sold_weight/1539734400", expiresAt)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(isNew).To(BeFalse())
+
+		isNew, err = dbAlert.RecordAlert("sales/2//sold_weight/1539734400", expiresAt)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(isNew).To(BeTrue())
+	})
+
+	It("should keep the expiry-index when created again", func() {
+		Expect(dbAlert.ExpireAlerts()).To(Succeed())
+	})
+})
@@ -0,0 +1,321 @@
+package report
+
+import (
+	"log"
+	"math"
+	"sort"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/pkg/errors"
+)
+
+// Anomaly-sources.
+const (
+	SourceSales   = "sales"
+	SourceSensors = "sensors"
+)
+
+// Baselines against which anomalies are detected.
+const (
+	BaselineMeanStddev = "mean_stddev"
+	BaselineMedianMAD  = "median_mad"
+)
+
+// Anomaly-severities.
+const (
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// madScale makes the median-absolute-deviation comparable to the
+// standard-deviation of normally distributed data.
+const madScale = 1.4826
+
+// minScaleFraction floors the baseline-scale at a fraction of the baseline,
+// so perfectly flat baselines don't flag negligible changes.
+const minScaleFraction = 0.05
+
+// AnomalyParams configures the anomaly-detection report.
+type AnomalyParams struct {
+	// Source is either SourceSales (default), which checks the daily
+	// sold-weight per SKU, or SourceSensors, which checks the metric
+	// readings per device.
+	Source string `json:"source,omitempty"`
+	// Baseline is either BaselineMedianMAD (default) or BaselineMeanStddev.
+	Baseline string `json:"baseline,omitempty"`
+	// Window is the number of preceding days (sales) or readings (sensors)
+	// forming the rolling baseline. Defaults to 14.
+	Window int `json:"window,omitempty"`
+	// Threshold is the deviation, in baseline-scales, from which values are
+	// flagged as SeverityWarning. Values deviating twice as much are flagged
+	// as SeverityCritical. Defaults to 3.
+	Threshold float64 `json:"threshold,omitempty"`
+	// HistoryDays is the number of past days checked, in addition to the
+	// days needed for the baseline. Defaults to 7.
+	HistoryDays int `json:"history_days,omitempty"`
+	// Fields are the metric-fields checked for SourceSensors.
+	// Defaults to "ethylene" and "temp_in".
+	Fields []string `json:"fields,omitempty"`
+	// Filters restrict the inventory checked for SourceSales, such as by
+	// rs_customer_id, and the metric-readings checked for SourceSensors,
+	// such as by item_id or device_id.
+	Filters []SearchParam `json:"filters,omitempty"`
+}
+
+// Anomaly is an outlying daily sold-weight or sensor-reading.
+type Anomaly struct {
+	Source   string `json:"source" proto:"1"`
+	SKU      int64  `json:"sku,omitempty" proto:"2"`
+	Name     string `json:"name,omitempty" proto:"3"`
+	DeviceID string `json:"device_id,omitempty" proto:"4"`
+	ItemID   string `json:"item_id,omitempty" proto:"5"`
+	Field    string `json:"field" proto:"6"`
+	// Timestamp is the start of the day for sales, and the time of the
+	// reading for sensors.
+	Timestamp int64   `json:"timestamp" proto:"7"`
+	Value     float64 `json:"value" proto:"8"`
+	Baseline  float64 `json:"baseline" proto:"9"`
+	// Score is the deviation from the baseline in baseline-scales.
+	// It is negative for drops.
+	Score    float64 `json:"score" proto:"10"`
+	Severity string  `json:"severity" proto:"11"`
+}
+
+// metricFields are the numeric Metric fields that can be checked.
+var metricFields = map[string]bool{
+	"ethylene":  true,
+	"temp_in":   true,
+	"humidity":  true,
+	"carbon_di": true,
+}
+
+// outlier is an anomalous point in a series.
+type outlier struct {
+	index    int
+	baseline float64
+	score    float64
+	severity string
+}
+
+// Anomalies detects outlying values against a rolling baseline, either in the
+// daily sold-weight of each SKU, or in the readings from metricDB of each
+// device. Anomalies are sorted by time, most recent last.
+func (db *DB) Anomalies(metricDB DBI, params AnomalyParams) ([]Anomaly, error) {
+	if params.Source == "" {
+		params.Source = SourceSales
+	}
+	if params.Baseline == "" {
+		params.Baseline = BaselineMedianMAD
+	}
+	if params.Baseline != BaselineMedianMAD && params.Baseline != BaselineMeanStddev {
+		err := errors.Wrapf(ErrInvalidParams, "Unknown baseline: %s - Anomalies", params.Baseline)
+		log.Println(err)
+		return nil, err
+	}
+	if params.Window <= 0 {
+		params.Window = 14
+	}
+	if params.Threshold <= 0 {
+		params.Threshold = 3
+	}
+	if params.HistoryDays <= 0 {
+		params.HistoryDays = 7
+	}
+
+	var anomalies []Anomaly
+	var err error
+	switch params.Source {
+	case SourceSales:
+		anomalies, err = db.salesAnomalies(params)
+	case SourceSensors:
+		anomalies, err = db.sensorAnomalies(metricDB, params)
+	default:
+		err = errors.Wrapf(ErrInvalidParams, "Unknown source: %s", params.Source)
+	}
+	if err != nil {
+		err = errors.Wrap(err, "Anomalies")
+		log.Println(err)
+		return nil, err
+	}
+
+	sort.SliceStable(anomalies, func(i, j int) bool {
+		return anomalies[i].Timestamp < anomalies[j].Timestamp
+	})
+	return anomalies, nil
+}
+
+// salesAnomalies checks the daily sold-weight of each SKU over the
+// completed days of the history.
+func (db *DB) salesAnomalies(params AnomalyParams) ([]Anomaly, error) {
+	today := startOfDay(db.now().In(rollupZone))
+	period := Period{
+		Start: today.AddDate(0, 0, -(params.HistoryDays + params.Window)).Unix(),
+		End:   today.Unix(),
+	}
+	daily, err := db.dailySold(params.Filters, period)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error aggregating daily sales")
+	}
+
+	anomalies := []Anomaly{}
+	for sku, series := range daily {
+		days, values := denseSeries(series.sold, period)
+		for _, o := range detectOutliers(values, params) {
+			anomalies = append(anomalies, Anomaly{
+				Source:    SourceSales,
+				SKU:       sku,
+				Name:      series.name,
+				Field:     "sold_weight",
+				Timestamp: days[o.index].Unix(),
+				Value:     values[o.index],
+				Baseline:  o.baseline,
+				Score:     o.score,
+				Severity:  o.severity,
+			})
+		}
+	}
+	return anomalies, nil
+}
+
+// sensorAnomalies checks the metric-readings of each device. The baseline
+// of the earliest readings in history may include readings before it.
+func (db *DB) sensorAnomalies(metricDB DBI, params AnomalyParams) ([]Anomaly, error) {
+	fields := params.Fields
+	if len(fields) == 0 {
+		fields = []string{"ethylene", "temp_in"}
+	}
+	for _, field := range fields {
+		if !metricFields[field] {
+			return nil, errors.Wrapf(ErrInvalidParams, "Unsupported metric-field: %s", field)
+		}
+	}
+
+	filter, err := db.searchFilter(params.Filters)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error building search-filter")
+	}
+
+	since := db.now().AddDate(0, 0, -params.HistoryDays).Unix()
+	docs, err := aggregateDocs(metricDB.Collection(), []interface{}{
+		map[string]interface{}{
+			"$match": map[string]interface{}{
+				"$and": []interface{}{
+					filter,
+					map[string]interface{}{
+						// Allows enough readings for the baseline of the
+						// earliest checked readings, assuming at most hourly
+						// readings.
+						"timestamp": map[string]int64{
+							"$gte": since - int64(params.Window)*3600,
+						},
+					},
+				},
+			},
+		},
+		map[string]interface{}{
+			"$sort": bson.NewDocument(
+				bson.EC.Int32("device_id", 1),
+				bson.EC.Int32("timestamp", 1),
+			),
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Error fetching metrics")
+	}
+
+	// Readings per device, in time-order
+	devices := map[string][]map[string]interface{}{}
+	deviceIDs := []string{}
+	for _, doc := range docs {
+		deviceID := toString(doc["device_id"])
+		if _, exists := devices[deviceID]; !exists {
+			deviceIDs = append(deviceIDs, deviceID)
+		}
+		devices[deviceID] = append(devices[deviceID], doc)
+	}
+
+	anomalies := []Anomaly{}
+	for _, deviceID := range deviceIDs {
+		readings := devices[deviceID]
+		for _, field := range fields {
+			values := make([]float64, len(readings))
+			for i, r := range readings {
+				values[i] = toFloat64(r[field])
+			}
+
+			for _, o := range detectOutliers(values, params) {
+				reading := readings[o.index]
+				timestamp := toInt64(reading["timestamp"])
+				if timestamp < since {
+					continue
+				}
+				anomalies = append(anomalies, Anomaly{
+					Source:    SourceSensors,
+					DeviceID:  deviceID,
+					ItemID:    toString(reading["item_id"]),
+					Field:     field,
+					Timestamp: timestamp,
+					Value:     values[o.index],
+					Baseline:  o.baseline,
+					Score:     o.score,
+					Severity:  o.severity,
+				})
+			}
+		}
+	}
+	return anomalies, nil
+}
+
+// detectOutliers flags the values deviating from the baseline of the
+// params.Window values preceding them by at least params.Threshold scales.
+func detectOutliers(values []float64, params AnomalyParams) []outlier {
+	outliers := []outlier{}
+	for i := params.Window; i < len(values); i++ {
+		window := values[i-params.Window : i]
+
+		var center, scale float64
+		if params.Baseline == BaselineMeanStddev {
+			center = mean(window)
+			scale = stddev(window)
+		} else {
+			center = median(window)
+			deviations := make([]float64, len(window))
+			for j, v := range window {
+				deviations[j] = math.Abs(v - center)
+			}
+			scale = madScale * median(deviations)
+		}
+
+		scale = math.Max(scale, minScaleFraction*math.Abs(center))
+		if scale == 0 {
+			// A baseline of only zeros, so deviations are in absolute units
+			scale = 1
+		}
+
+		score := (values[i] - center) / scale
+		severity := ""
+		switch {
+		case math.Abs(score) >= 2*params.Threshold:
+			severity = SeverityCritical
+		case math.Abs(score) >= params.Threshold:
+			severity = SeverityWarning
+		default:
+			continue
+		}
+
+		outliers = append(outliers, outlier{
+			index:    i,
+			baseline: center,
+			score:    score,
+			severity: severity,
+		})
+	}
+	return outliers
+}
+
+func median(values []float64) float64 {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	return percentile(sorted, 50)
+}
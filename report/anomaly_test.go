@@ -0,0 +1,130 @@
+package report
+
+import (
+	"time"
+
+	"github.com/TerrexTech/uuuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Anomaly detection", func() {
+	var params AnomalyParams
+
+	BeforeEach(func() {
+		params = AnomalyParams{
+			Baseline:  BaselineMedianMAD,
+			Window:    5,
+			Threshold: 3,
+		}
+	})
+
+	It("should not flag values within the baseline", func() {
+		values := []float64{10, 11, 9, 10, 11, 10, 9, 11}
+		for _, baseline := range []string{BaselineMedianMAD, BaselineMeanStddev} {
+			params.Baseline = baseline
+			Expect(detectOutliers(values, params)).To(BeEmpty())
+		}
+	})
+
+	It("should flag spikes and drops with their severity", func() {
+		// MAD-scale of the window is 1.4826
+		values := []float64{10, 11, 9, 10, 11, 15, 10, 11, 9, 10, 11, 0}
+		outliers := detectOutliers(values, params)
+		Expect(outliers).To(HaveLen(2))
+
+		Expect(outliers[0].index).To(Equal(5))
+		Expect(outliers[0].baseline).To(Equal(10.0))
+		Expect(outliers[0].score).To(BeNumerically(">", 3))
+		Expect(outliers[0].severity).To(Equal(SeverityWarning))
+
+		Expect(outliers[1].index).To(Equal(11))
+		Expect(outliers[1].score).To(BeNumerically("<", -6))
+		Expect(outliers[1].severity).To(Equal(SeverityCritical))
+	})
+
+	It("should not flag negligible changes to a flat baseline", func() {
+		values := []float64{20, 20, 20, 20, 20, 20.5}
+		Expect(detectOutliers(values, params)).To(BeEmpty())
+	})
+
+	It("should flag sales on a baseline without sales", func() {
+		values := []float64{0, 0, 0, 0, 0, 8}
+		outliers := detectOutliers(values, params)
+		Expect(outliers).To(HaveLen(1))
+		Expect(outliers[0].score).To(Equal(8.0))
+	})
+
+	It("should ignore the values without a full window", func() {
+		Expect(detectOutliers([]float64{1, 100, 1}, params)).To(BeEmpty())
+	})
+
+	Describe("of sensors in Mongo", func() {
+		var (
+			dbInventory *DB
+			dbMetric    *DB
+		)
+
+		testDatabase := "rns_report_anomaly_test"
+		now := time.Date(2018, 10, 17, 12, 0, 0, 0, time.UTC)
+
+		// insertReadings inserts hourly ethylene-readings of a new device of
+		// the tenant, ending with a spike, and returns the device's ID.
+		insertReadings := func(tenant string) string {
+			deviceID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			for i, ethylene := range []float64{10, 10, 10, 10, 100} {
+				_, err = dbMetric.collection.InsertOne(map[string]interface{}{
+					"rs_customer_id": tenant,
+					"device_id":      deviceID.String(),
+					"timestamp":      now.Add(time.Duration(i-5) * time.Hour).Unix(),
+					"ethylene":       ethylene,
+				})
+				Expect(err).ToNot(HaveOccurred())
+			}
+			return deviceID.String()
+		}
+
+		BeforeEach(func() {
+			config := testDBConfig(testDatabase, "agg_inventory")
+			config.Clock = func() time.Time {
+				return now
+			}
+			var err error
+			dbInventory, err = GenerateDB(config, &Inventory{})
+			Expect(err).ToNot(HaveOccurred())
+			dbMetric, err = GenerateDB(
+				testDBConfig(testDatabase, "agg_metric"), &Metric{},
+			)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			dropTestDB(testDatabase)
+		})
+
+		It("should only check the readings matching the filters", func() {
+			deviceID := insertReadings("tenant-a")
+			insertReadings("tenant-b")
+
+			params.Source = SourceSensors
+			params.Window = 3
+			params.Fields = []string{"ethylene"}
+			params.Filters = []SearchParam{
+				{Field: "rs_customer_id", Type: "string", Equal: "tenant-a"},
+			}
+			anomalies, err := dbInventory.Anomalies(dbMetric, params)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(anomalies).To(HaveLen(1))
+			Expect(anomalies[0].DeviceID).To(Equal(deviceID))
+			Expect(anomalies[0].Value).To(Equal(float64(100)))
+			Expect(anomalies[0].Severity).To(Equal(SeverityCritical))
+
+			// Unfiltered, the readings of both tenants are checked
+			params.Filters = nil
+			anomalies, err = dbInventory.Anomalies(dbMetric, params)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(anomalies).To(HaveLen(2))
+		})
+	})
+})
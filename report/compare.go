@@ -0,0 +1,316 @@
+package report
+
+import (
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Comparison-periods supported by SoldComparison.
+const (
+	PreviousPeriod     = "previous_period"
+	SamePeriodLastYear = "same_period_last_year"
+)
+
+// ComparisonParams configures the period-over-period comparison report.
+type ComparisonParams struct {
+	// Range, From and To select the reported period of date_sold,
+	// using the same expressions as SearchParam.
+	Range string `json:"range,omitempty"`
+	From  string `json:"from,omitempty"`
+	To    string `json:"to,omitempty"`
+	// Comparison is the period being compared against.
+	// Defaults to PreviousPeriod.
+	Comparison string `json:"comparison,omitempty"`
+	// Filters are additional inventory filters applied to both periods.
+	Filters []SearchParam `json:"filters,omitempty"`
+	// Limit caps the number of SKUs returned. Zero returns all.
+	Limit int `json:"limit,omitempty"`
+}
+
+// Period is a time-range as Unix timestamps, inclusive of Start and
+// exclusive of End.
+type Period struct {
+	Start int64 `json:"start" proto:"1"`
+	End   int64 `json:"end" proto:"2"`
+}
+
+// SoldComparison is the sales of a SKU in two periods.
+// The percentage-deltas are nil when the compared value is zero.
+type SoldComparison struct {
+	SKU  int64  `json:"sku" proto:"1"`
+	Name string `json:"name,omitempty" proto:"2"`
+
+	SoldWeight         float64  `json:"sold_weight" proto:"3"`
+	PrevSoldWeight     float64  `json:"prev_sold_weight" proto:"4"`
+	SoldWeightDelta    float64  `json:"sold_weight_delta" proto:"5"`
+	SoldWeightDeltaPct *float64 `json:"sold_weight_delta_pct,omitempty" proto:"6"`
+
+	Revenue         float64  `json:"revenue" proto:"7"`
+	PrevRevenue     float64  `json:"prev_revenue" proto:"8"`
+	RevenueDelta    float64  `json:"revenue_delta" proto:"9"`
+	RevenueDeltaPct *float64 `json:"revenue_delta_pct,omitempty" proto:"10"`
+}
+
+// ComparisonReport is the result of SoldComparison.
+type ComparisonReport struct {
+	Period           Period           `json:"period" proto:"1"`
+	ComparisonPeriod Period           `json:"comparison_period" proto:"2"`
+	Items            []SoldComparison `json:"items" proto:"3"`
+}
+
+// ComparisonRow is a SoldComparison with the compared periods, as a row of
+// tabular encodings such as CSV.
+type ComparisonRow struct {
+	Period           Period `json:"period"`
+	ComparisonPeriod Period `json:"comparison_period"`
+	SoldComparison
+}
+
+// Rows returns the Items with the compared periods.
+func (r *ComparisonReport) Rows() interface{} {
+	rows := []ComparisonRow{}
+	if r == nil {
+		return rows
+	}
+	for _, item := range r.Items {
+		rows = append(rows, ComparisonRow{
+			Period:           r.Period,
+			ComparisonPeriod: r.ComparisonPeriod,
+			SoldComparison:   item,
+		})
+	}
+	return rows
+}
+
+// soldTotals is the sold-weight and revenue of a SKU in some period.
+type soldTotals struct {
+	name       string
+	soldWeight float64
+	revenue    float64
+}
+
+// SoldComparison compares the sold-weight and revenue of each SKU between
+// the requested period and its comparison-period. Items are ranked by the
+// biggest absolute change in revenue.
+func (db *DB) SoldComparison(params ComparisonParams) (*ComparisonReport, error) {
+	period, err := db.reportPeriod(params.Range, params.From, params.To)
+	if err != nil {
+		err = errors.Wrap(err, "Error resolving period - SoldComparison")
+		log.Println(err)
+		return nil, err
+	}
+
+	var compPeriod Period
+	switch params.Comparison {
+	case "", PreviousPeriod:
+		compPeriod = previousPeriod(period, rollupZone)
+	case SamePeriodLastYear:
+		compPeriod = Period{
+			Start: time.Unix(period.Start, 0).In(rollupZone).AddDate(-1, 0, 0).Unix(),
+			End:   time.Unix(period.End, 0).In(rollupZone).AddDate(-1, 0, 0).Unix(),
+		}
+	default:
+		err = errors.Wrapf(
+			ErrInvalidParams, "Unknown comparison: %s - SoldComparison", params.Comparison,
+		)
+		log.Println(err)
+		return nil, err
+	}
+
+	current, err := db.soldBySKU(params.Filters, period)
+	if err != nil {
+		err = errors.Wrap(err, "Error aggregating period - SoldComparison")
+		log.Println(err)
+		return nil, err
+	}
+	previous, err := db.soldBySKU(params.Filters, compPeriod)
+	if err != nil {
+		err = errors.Wrap(err, "Error aggregating comparison-period - SoldComparison")
+		log.Println(err)
+		return nil, err
+	}
+
+	items := compareSold(current, previous)
+	if params.Limit > 0 && len(items) > params.Limit {
+		items = items[:params.Limit]
+	}
+
+	return &ComparisonReport{
+		Period:           period,
+		ComparisonPeriod: compPeriod,
+		Items:            items,
+	}, nil
+}
+
+// reportPeriod resolves the date-expressions into a bounded Period, in the
+// rollupZone. The period ends now if no upper-bound is given.
+func (db *DB) reportPeriod(rangeExpr, from, to string) (Period, error) {
+	now := db.now().In(rollupZone)
+	lower, upper, err := resolveDateRange(SearchParam{
+		Field: "date_sold",
+		Range: rangeExpr,
+		From:  from,
+		To:    to,
+	}, now)
+	if err != nil {
+		return Period{}, errors.Wrap(ErrInvalidParams, err.Error())
+	}
+	if lower == 0 {
+		return Period{}, errors.Wrap(ErrInvalidParams, "Period requires a Range or From")
+	}
+	if upper == 0 {
+		upper = now.Unix()
+	}
+	return Period{
+		Start: lower,
+		End:   upper,
+	}, nil
+}
+
+// previousPeriod returns the period of equal length immediately preceding p.
+// Periods spanning whole calendar-months are shifted by months, so that
+// "this_month" is compared against the entire previous month.
+func previousPeriod(p Period, loc *time.Location) Period {
+	start := time.Unix(p.Start, 0).In(loc)
+	end := time.Unix(p.End, 0).In(loc)
+
+	if start.Equal(startOfMonth(start)) && end.Equal(startOfMonth(end)) {
+		months := (end.Year()-start.Year())*12 + int(end.Month()-start.Month())
+		return Period{
+			Start: start.AddDate(0, -months, 0).Unix(),
+			End:   p.Start,
+		}
+	}
+
+	length := p.End - p.Start
+	return Period{
+		Start: p.Start - length,
+		End:   p.Start,
+	}
+}
+
+// soldBySKU aggregates the sold-weight and revenue per SKU in the period.
+// The rollup is used if it serves the filters.
+func (db *DB) soldBySKU(filters []SearchParam, p Period) (map[int64]soldTotals, error) {
+	if db.rollupServes(filters, p) {
+		match, err := db.rollupMatch(filters, p)
+		if err != nil {
+			return nil, err
+		}
+		return db.rollup.soldTotals(match, "$revenue")
+	}
+
+	match, err := db.searchFilter(filters)
+	if err != nil {
+		return nil, err
+	}
+	match["date_sold"] = map[string]int64{
+		"$gte": p.Start,
+		"$lt":  p.End,
+	}
+	return db.soldTotals(match, revenueExpr)
+}
+
+// soldTotals aggregates the sold-weight and revenue per SKU of the
+// documents matching match.
+func (db *DB) soldTotals(match map[string]interface{}, revenue interface{}) (map[int64]soldTotals, error) {
+	pipeline := []interface{}{
+		map[string]interface{}{
+			"$match": match,
+		},
+		map[string]interface{}{
+			"$group": map[string]interface{}{
+				"_id": "$sku",
+				"name": map[string]interface{}{
+					"$first": "$name",
+				},
+				"sold_weight": map[string]interface{}{
+					"$sum": "$sold_weight",
+				},
+				"revenue": map[string]interface{}{
+					"$sum": revenue,
+				},
+			},
+		},
+	}
+
+	docs, err := db.aggregate(pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	totals := map[int64]soldTotals{}
+	for _, doc := range docs {
+		totals[toInt64(doc["_id"])] = soldTotals{
+			name:       toString(doc["name"]),
+			soldWeight: toFloat64(doc["sold_weight"]),
+			revenue:    toFloat64(doc["revenue"]),
+		}
+	}
+	return totals, nil
+}
+
+// compareSold merges the per-SKU totals of two periods, and ranks them by
+// the biggest absolute change in revenue, and then in sold-weight.
+func compareSold(current, previous map[int64]soldTotals) []SoldComparison {
+	items := []SoldComparison{}
+
+	addItem := func(sku int64) {
+		cur := current[sku]
+		prev := previous[sku]
+		name := cur.name
+		if name == "" {
+			name = prev.name
+		}
+		items = append(items, SoldComparison{
+			SKU:                sku,
+			Name:               name,
+			SoldWeight:         cur.soldWeight,
+			PrevSoldWeight:     prev.soldWeight,
+			SoldWeightDelta:    cur.soldWeight - prev.soldWeight,
+			SoldWeightDeltaPct: deltaPct(cur.soldWeight, prev.soldWeight),
+			Revenue:            cur.revenue,
+			PrevRevenue:        prev.revenue,
+			RevenueDelta:       cur.revenue - prev.revenue,
+			RevenueDeltaPct:    deltaPct(cur.revenue, prev.revenue),
+		})
+	}
+
+	for sku := range current {
+		addItem(sku)
+	}
+	for sku := range previous {
+		if _, exists := current[sku]; !exists {
+			addItem(sku)
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		ri := math.Abs(items[i].RevenueDelta)
+		rj := math.Abs(items[j].RevenueDelta)
+		if ri != rj {
+			return ri > rj
+		}
+		wi := math.Abs(items[i].SoldWeightDelta)
+		wj := math.Abs(items[j].SoldWeightDelta)
+		if wi != wj {
+			return wi > wj
+		}
+		return items[i].SKU < items[j].SKU
+	})
+	return items
+}
+
+// deltaPct returns the percentage change from prev to cur,
+// or nil if prev is zero.
+func deltaPct(cur, prev float64) *float64 {
+	if prev == 0 {
+		return nil
+	}
+	pct := (cur - prev) / prev * 100
+	return &pct
+}
@@ -0,0 +1,79 @@
+package report
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+var _ = Describe("Period comparison", func() {
+	It("should reject missing periods and unknown comparisons", func() {
+		db := &DB{}
+		_, err := db.SoldComparison(ComparisonParams{})
+		Expect(errors.Cause(err)).To(Equal(ErrInvalidParams))
+		_, err = db.SoldComparison(ComparisonParams{Range: "fortnight"})
+		Expect(errors.Cause(err)).To(Equal(ErrInvalidParams))
+		_, err = db.SoldComparison(ComparisonParams{
+			Range:      "last_7_days",
+			Comparison: "last_decade",
+		})
+		Expect(errors.Cause(err)).To(Equal(ErrInvalidParams))
+	})
+
+	It("should compare calendar-months against the whole previous month", func() {
+		p := Period{
+			Start: time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC).Unix(),
+			End:   time.Date(2018, 4, 1, 0, 0, 0, 0, time.UTC).Unix(),
+		}
+		prev := previousPeriod(p, time.UTC)
+		Expect(prev.Start).To(Equal(time.Date(2018, 2, 1, 0, 0, 0, 0, time.UTC).Unix()))
+		Expect(prev.End).To(Equal(p.Start))
+	})
+
+	It("should compare other periods against one of equal length", func() {
+		p := Period{
+			Start: 1000,
+			End:   1600,
+		}
+		Expect(previousPeriod(p, time.UTC)).To(Equal(Period{
+			Start: 400,
+			End:   1000,
+		}))
+	})
+
+	It("should rank SKUs by the biggest change in revenue", func() {
+		current := map[int64]soldTotals{
+			1: soldTotals{name: "apple", soldWeight: 10, revenue: 100},
+			2: soldTotals{name: "pear", soldWeight: 5, revenue: 20},
+		}
+		previous := map[int64]soldTotals{
+			1: soldTotals{name: "apple", soldWeight: 8, revenue: 90},
+			3: soldTotals{name: "plum", soldWeight: 6, revenue: 60},
+		}
+
+		items := compareSold(current, previous)
+		Expect(items).To(HaveLen(3))
+		Expect(items[0].SKU).To(Equal(int64(3)))
+		Expect(items[0].RevenueDelta).To(Equal(float64(-60)))
+		Expect(*items[0].RevenueDeltaPct).To(Equal(float64(-100)))
+		Expect(items[1].SKU).To(Equal(int64(2)))
+		Expect(items[1].RevenueDeltaPct).To(BeNil())
+		Expect(items[2].SKU).To(Equal(int64(1)))
+		Expect(items[2].SoldWeightDelta).To(Equal(float64(2)))
+	})
+
+	It("should return the items with their periods as rows", func() {
+		r := &ComparisonReport{
+			Period:           Period{Start: 10, End: 20},
+			ComparisonPeriod: Period{Start: 0, End: 10},
+			Items:            []SoldComparison{{SKU: 1}, {SKU: 2}},
+		}
+		rows := r.Rows().([]ComparisonRow)
+		Expect(rows).To(HaveLen(2))
+		Expect(rows[1].SKU).To(Equal(int64(2)))
+		Expect(rows[1].Period).To(Equal(r.Period))
+		Expect(rows[1].ComparisonPeriod).To(Equal(r.ComparisonPeriod))
+	})
+})
@@ -0,0 +1,232 @@
+package report
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Clock returns the current time. Relative date-expressions such as
+// "last_7_days" or "now-30d" are resolved against it.
+type Clock func() time.Time
+
+// timeFields are the Inventory fields that store Unix timestamps (seconds),
+// and hence accept date-expressions in SearchParam.
+var timeFields = map[string]bool{
+	"date_arrived": true,
+	"date_sold":    true,
+	"expiry_date":  true,
+	"timestamp":    true,
+}
+
+var (
+	lastNRegex   = regexp.MustCompile(`^last_(\d+)_(hours|days|weeks|months)$`)
+	relTimeRegex = regexp.MustCompile(`^now(?:([+-])(\d+)([smhdwMy]))?$`)
+)
+
+// isoLayouts are the ISO-8601 layouts accepted for From and To.
+var isoLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// hasDateExpr returns true if any of the date-expressions are set on the
+// SearchParam.
+func (sp *SearchParam) hasDateExpr() bool {
+	return sp.Range != "" || sp.From != "" || sp.To != ""
+}
+
+// resolveDateRange converts the Range, From and To expressions of the
+// SearchParam into Unix timestamps. The returned range is inclusive of
+// lower and exclusive of upper. A zero value means that bound is not set.
+func resolveDateRange(sp SearchParam, now time.Time) (int64, int64, error) {
+	if !timeFields[sp.Field] {
+		return 0, 0, errors.Errorf(
+			"Date-expressions are not supported on field: %s", sp.Field,
+		)
+	}
+	if sp.Range != "" && (sp.From != "" || sp.To != "") {
+		return 0, 0, errors.New("Range cannot be combined with From or To")
+	}
+
+	if sp.Range != "" {
+		start, end, err := resolvePeriod(sp.Range, now)
+		if err != nil {
+			return 0, 0, err
+		}
+		return start.Unix(), end.Unix(), nil
+	}
+
+	var lower, upper int64
+	if sp.From != "" {
+		from, err := resolveInstant(sp.From, now)
+		if err != nil {
+			return 0, 0, errors.Wrap(err, "Error parsing From")
+		}
+		lower = from.Unix()
+	}
+	if sp.To != "" {
+		to, err := resolveInstant(sp.To, now)
+		if err != nil {
+			return 0, 0, errors.Wrap(err, "Error parsing To")
+		}
+		// A date-only To includes the whole of that day, so the exclusive
+		// upper-bound is the next midnight.
+		if isDateOnly(sp.To) {
+			to = to.AddDate(0, 0, 1)
+		}
+		upper = to.Unix()
+	}
+	if lower != 0 && upper != 0 && lower >= upper {
+		return 0, 0, errors.New("From must be before To")
+	}
+	return lower, upper, nil
+}
+
+// resolvePeriod resolves a named period, such as "yesterday" or
+// "last_7_days", to its start (inclusive) and end (exclusive).
+func resolvePeriod(expr string, now time.Time) (time.Time, time.Time, error) {
+	today := startOfDay(now)
+
+	switch expr {
+	case "today":
+		return today, today.AddDate(0, 0, 1), nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), today, nil
+	case "this_week":
+		start := startOfWeek(now)
+		return start, start.AddDate(0, 0, 7), nil
+	case "last_week":
+		start := startOfWeek(now)
+		return start.AddDate(0, 0, -7), start, nil
+	case "this_month":
+		start := startOfMonth(now)
+		return start, start.AddDate(0, 1, 0), nil
+	case "last_month":
+		start := startOfMonth(now)
+		return start.AddDate(0, -1, 0), start, nil
+	case "this_year":
+		start := time.Date(now.Year(), 1, 1, 0, 0, 0, 0, now.Location())
+		return start, start.AddDate(1, 0, 0), nil
+	case "last_year":
+		start := time.Date(now.Year(), 1, 1, 0, 0, 0, 0, now.Location())
+		return start.AddDate(-1, 0, 0), start, nil
+	}
+
+	// Rolling windows ending now, such as "last_7_days"
+	match := lastNRegex.FindStringSubmatch(expr)
+	if match == nil {
+		return time.Time{}, time.Time{}, errors.Errorf(
+			"Unknown date-range expression: %s", expr,
+		)
+	}
+	n, err := strconv.Atoi(match[1])
+	if err != nil || n <= 0 {
+		return time.Time{}, time.Time{}, errors.Errorf(
+			"Invalid count in date-range expression: %s", expr,
+		)
+	}
+
+	var start time.Time
+	switch match[2] {
+	case "hours":
+		start = now.Add(-time.Duration(n) * time.Hour)
+	case "days":
+		start = now.AddDate(0, 0, -n)
+	case "weeks":
+		start = now.AddDate(0, 0, -7*n)
+	case "months":
+		start = now.AddDate(0, -n, 0)
+	}
+	return start, now, nil
+}
+
+// resolveInstant resolves a single point in time. It accepts ISO-8601 dates,
+// Unix timestamps, and expressions relative to now, such as "now-30d".
+func resolveInstant(expr string, now time.Time) (time.Time, error) {
+	expr = strings.TrimSpace(expr)
+
+	switch expr {
+	case "today":
+		return startOfDay(now), nil
+	case "yesterday":
+		return startOfDay(now).AddDate(0, 0, -1), nil
+	}
+
+	if match := relTimeRegex.FindStringSubmatch(expr); match != nil {
+		if match[1] == "" {
+			return now, nil
+		}
+		n, err := strconv.Atoi(match[2])
+		if err != nil {
+			return time.Time{}, errors.Wrap(err, "Invalid offset")
+		}
+		if match[1] == "-" {
+			n = -n
+		}
+		return offsetTime(now, n, match[3]), nil
+	}
+
+	for _, layout := range isoLayouts {
+		t, err := time.ParseInLocation(layout, expr, now.Location())
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	// Plain Unix timestamps are accepted as strings too, which avoids the
+	// precision-loss of the float-based limits.
+	unix, err := strconv.ParseInt(expr, 10, 64)
+	if err == nil {
+		return time.Unix(unix, 0).In(now.Location()), nil
+	}
+
+	return time.Time{}, errors.Errorf("Unrecognized date-expression: %s", expr)
+}
+
+// isDateOnly returns true if expr is an ISO-8601 date without a time-part.
+func isDateOnly(expr string) bool {
+	_, err := time.Parse("2006-01-02", strings.TrimSpace(expr))
+	return err == nil
+}
+
+// offsetTime moves t by n units, where unit is one of s, m, h, d, w, M or y.
+func offsetTime(t time.Time, n int, unit string) time.Time {
+	switch unit {
+	case "s":
+		return t.Add(time.Duration(n) * time.Second)
+	case "m":
+		return t.Add(time.Duration(n) * time.Minute)
+	case "h":
+		return t.Add(time.Duration(n) * time.Hour)
+	case "d":
+		return t.AddDate(0, 0, n)
+	case "w":
+		return t.AddDate(0, 0, 7*n)
+	case "M":
+		return t.AddDate(0, n, 0)
+	case "y":
+		return t.AddDate(n, 0, 0)
+	}
+	return t
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// startOfWeek returns the start of the week containing t.
+// Weeks start on Monday.
+func startOfWeek(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	return startOfDay(t).AddDate(0, 0, -offset)
+}
+
+func startOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
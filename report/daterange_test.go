@@ -0,0 +1,114 @@
+package report
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Date-range expressions", func() {
+	var now time.Time
+
+	BeforeEach(func() {
+		// Wednesday
+		now = time.Date(2018, 10, 17, 15, 30, 0, 0, time.UTC)
+	})
+
+	It("should resolve named periods", func() {
+		lower, upper, err := resolveDateRange(SearchParam{
+			Field: "date_sold",
+			Range: "yesterday",
+		}, now)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(lower).To(Equal(time.Date(2018, 10, 16, 0, 0, 0, 0, time.UTC).Unix()))
+		Expect(upper).To(Equal(time.Date(2018, 10, 17, 0, 0, 0, 0, time.UTC).Unix()))
+
+		lower, upper, err = resolveDateRange(SearchParam{
+			Field: "date_sold",
+			Range: "this_month",
+		}, now)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(lower).To(Equal(time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC).Unix()))
+		Expect(upper).To(Equal(time.Date(2018, 11, 1, 0, 0, 0, 0, time.UTC).Unix()))
+
+		lower, _, err = resolveDateRange(SearchParam{
+			Field: "date_sold",
+			Range: "this_week",
+		}, now)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(lower).To(Equal(time.Date(2018, 10, 15, 0, 0, 0, 0, time.UTC).Unix()))
+	})
+
+	It("should resolve rolling windows", func() {
+		lower, upper, err := resolveDateRange(SearchParam{
+			Field: "timestamp",
+			Range: "last_7_days",
+		}, now)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(lower).To(Equal(now.AddDate(0, 0, -7).Unix()))
+		Expect(upper).To(Equal(now.Unix()))
+	})
+
+	It("should resolve ISO-8601 dates and relative instants", func() {
+		lower, upper, err := resolveDateRange(SearchParam{
+			Field: "expiry_date",
+			From:  "2018-10-01",
+			To:    "now-30d",
+		}, time.Date(2018, 12, 1, 0, 0, 0, 0, time.UTC))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(lower).To(Equal(time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC).Unix()))
+		Expect(upper).To(Equal(time.Date(2018, 11, 1, 0, 0, 0, 0, time.UTC).Unix()))
+	})
+
+	It("should include the whole day for a date-only To", func() {
+		lower, upper, err := resolveDateRange(SearchParam{
+			Field: "date_sold",
+			From:  "2018-10-01",
+			To:    "2018-10-31",
+		}, now)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(lower).To(Equal(time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC).Unix()))
+		Expect(upper).To(Equal(time.Date(2018, 11, 1, 0, 0, 0, 0, time.UTC).Unix()))
+
+		_, upper, err = resolveDateRange(SearchParam{
+			Field: "date_sold",
+			To:    "2018-10-31T12:00",
+		}, now)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(upper).To(Equal(time.Date(2018, 10, 31, 12, 0, 0, 0, time.UTC).Unix()))
+	})
+
+	It("should accept Unix timestamps in seconds", func() {
+		lower, upper, err := resolveDateRange(SearchParam{
+			Field: "date_arrived",
+			From:  "1539790201",
+			To:    "1539790259",
+		}, now)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(lower).To(Equal(int64(1539790201)))
+		Expect(upper).To(Equal(int64(1539790259)))
+	})
+
+	It("should reject date-expressions on non-time fields", func() {
+		_, _, err := resolveDateRange(SearchParam{
+			Field: "sku",
+			Range: "today",
+		}, now)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject unknown expressions", func() {
+		_, _, err := resolveDateRange(SearchParam{
+			Field: "date_sold",
+			Range: "last_fortnight",
+		}, now)
+		Expect(err).To(HaveOccurred())
+
+		_, _, err = resolveDateRange(SearchParam{
+			Field: "date_sold",
+			From:  "now-3q",
+		}, now)
+		Expect(err).To(HaveOccurred())
+	})
+})
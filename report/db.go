@@ -3,8 +3,10 @@ package report
 import (
 	"log"
 	"strconv"
+	"time"
 
 	"github.com/TerrexTech/go-mongoutils/mongo"
+	"github.com/TerrexTech/uuuid"
 	"github.com/pkg/errors"
 )
 
@@ -21,15 +23,44 @@ type DBIConfig struct {
 	TimeoutMilliseconds uint32
 	Database            string
 	Collection          string
+	// Clock is used to resolve relative date-expressions.
+	// Defaults to time.Now.
+	Clock Clock
+	// Indexes are created on the collection if they don't exist.
+	Indexes []mongo.IndexConfig
 }
 
 type DBI interface {
 	Collection() *mongo.Collection
 	InvAdvSearch(search map[string][]SearchParam) ([]Inventory, error)
+	SearchFlash(params []SearchParam, opts SearchOptions) ([]Flash, error)
+	SearchMetrics(params []SearchParam, opts SearchOptions) ([]Metric, error)
+	SoldComparison(params ComparisonParams) (*ComparisonReport, error)
+	Rankings(params RankingParams) ([]Ranking, error)
+	ExpiryRisk(params ExpiryRiskParams) ([]ExpiryRisk, error)
+	FlashCandidates(metricDB DBI, params FlashCandidateParams) ([]FlashCandidate, error)
+	Markdown(flashDB DBI, params MarkdownParams) ([]Markdown, error)
+	OriginPerformance(params OriginPerformanceParams) ([]OriginPerformance, error)
+	DaysToSell(params DaysToSellParams) ([]DaysToSellDistribution, error)
+	Forecast(params ForecastParams) ([]Forecast, error)
+	Anomalies(metricDB DBI, params AnomalyParams) ([]Anomaly, error)
+	ExpireAlerts() error
+	RecordAlert(key string, expiresAt time.Time) (bool, error)
+	ApplyRollup(inv *Inventory) error
+	RetractRollup(itemID uuuid.UUID, version int64) error
+	RebuildRollup() error
+	InsertInventory(inv *Inventory, version int64) (bool, error)
+	UpdateInventory(u InventoryUpdate, version int64) (int64, error)
+	DeleteInventory(filter map[string]interface{}, version int64) (int64, error)
+	Drop() error
+	SwapInto(target string) error
 }
 
 type DB struct {
 	collection *mongo.Collection
+	clock      Clock
+	// rollup serves reports at daily granularity, if set
+	rollup *DB
 }
 
 func GenerateDB(dbConfig DBIConfig, schema interface{}) (*DB, error) {
@@ -79,7 +110,7 @@ func GenerateDB(dbConfig DBIConfig, schema interface{}) (*DB, error) {
 		Database:     dbConfig.Database,
 		Name:         dbConfig.Collection,
 		SchemaStruct: schema,
-		// Indexes:      indexConfigs,
+		Indexes:      dbConfig.Indexes,
 	}
 	c, err := mongo.EnsureCollection(collConfig)
 	if err != nil {
@@ -88,6 +119,7 @@ func GenerateDB(dbConfig DBIConfig, schema interface{}) (*DB, error) {
 	}
 	return &DB{
 		collection: c,
+		clock:      dbConfig.Clock,
 	}, nil
 }
 
@@ -95,113 +127,165 @@ func (d *DB) Collection() *mongo.Collection {
 	return d.collection
 }
 
-func (db *DB) InvAdvSearch(search map[string][]SearchParam) ([]Inventory, error) {
+// now returns the current time as per the configured Clock.
+func (d *DB) now() time.Time {
+	if d.clock == nil {
+		return time.Now()
+	}
+	return d.clock()
+}
 
-	var findResults []interface{}
-	var err error
-	// var type string
+// ErrNoResults is returned by InvAdvSearch if no inventory matches.
+var ErrNoResults = errors.New("No results found - InvAdvSearch")
 
-	inv := search["inventory"]
+// ErrInvalidParams is the cause of errors from invalid report-parameters,
+// such as unknown metrics or unresolvable periods. Such errors are not
+// transient. Use errors.Cause to compare errors against it.
+var ErrInvalidParams = errors.New("Invalid report-parameters")
 
+// searchFilter converts the SearchParams into a Mongo find-filter. Errors are
+// caused by ErrInvalidSearchParam, since they are all from malformed
+// SearchParams.
+func (db *DB) searchFilter(params []SearchParam) (map[string]interface{}, error) {
+	findParams, err := db.buildSearchFilter(params)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidSearchParam, err.Error())
+	}
+	return findParams, nil
+}
+
+func (db *DB) buildSearchFilter(params []SearchParam) (map[string]interface{}, error) {
+	var err error
 	findParams := map[string]interface{}{}
 
-	if inv != nil {
-		for _, v := range inv {
-			if v.Type == "" {
-				err = errors.New("Type required - InvAdvSearch.")
+	for _, v := range params {
+		if v.Type == "" {
+			err = errors.New("Type required.")
+			log.Println(err)
+			return nil, err
+		}
+		if v.Field == "" {
+			err = errors.New("Field is required")
+			log.Println(err)
+			return nil, err
+		}
+
+		// if v.Equal == "" && v.Field != "" && v.Type != "" {
+		// 	err = errors.New("Equal is required")
+		// 	log.Println(err)
+		// 	return nil, err
+		// }
+
+		if v.hasDateExpr() {
+			lower, upper, err := resolveDateRange(v, db.now())
+			if err != nil {
+				err = errors.Wrap(err, "Error resolving date-range")
 				log.Println(err)
 				return nil, err
 			}
-			if v.Field == "" {
-				err = errors.New("Field is required - InvAdvSearch")
-				log.Println(err)
-				return nil, err
+			limitMap := map[string]int64{}
+			if lower != 0 {
+				limitMap["$gte"] = lower
+			}
+			if upper != 0 {
+				limitMap["$lt"] = upper
 			}
+			findParams[v.Field] = limitMap
+			continue
+		}
 
-			// if v.Equal == "" && v.Field != "" && v.Type != "" {
-			// 	err = errors.New("Equal is required - InvAdvSearch")
-			// 	log.Println(err)
-			// 	return nil, err
-			// }
+		if v.Equal == "" && v.LowerLimit == 0 && v.UpperLimit == 0 && v.Field != "" && v.Type != "" {
+			err = errors.New("Missing value in equal. No lowerlimit and upperlimit set.")
+			log.Println(err)
+			return nil, err
+		}
 
-			if v.Equal == "" && v.LowerLimit == 0 && v.UpperLimit == 0 && v.Field != "" && v.Type != "" {
-				err = errors.New("Missing value in equal. No lowerlimit and upperlimit set - InvAdvSearch.")
-				log.Println(err)
-				return nil, err
+		switch v.Type {
+		case "string":
+			findParams[v.Field] = map[string]string{
+				"$eq": v.Equal,
 			}
 
-			switch v.Type {
-			case "string":
-				findParams[v.Field] = map[string]string{
-					"$eq": v.Equal,
+		case "float":
+			if v.Equal != "" {
+				floatValue, err := strconv.ParseFloat(v.Equal, 64)
+				if err != nil {
+					err = errors.Wrap(err, "Error converting value of equal to float")
+					log.Println(err)
+					return nil, err
 				}
-
-			case "float":
-				if v.Equal != "" {
-					floatValue, err := strconv.ParseFloat(v.Equal, 64)
-					if err != nil {
-						err = errors.Wrap(err, "Error converting value of equal to float - InvAdvSearch")
-						log.Println(err)
-						return nil, err
-					}
-					findParams[v.Field] = map[string]float64{
-						"$eq": floatValue,
-					}
-				} else {
-					limitMap := map[string]map[string]float64{}
-					if v.LowerLimit != 0 {
-						if limitMap[v.Field] == nil {
-							limitMap[v.Field] = map[string]float64{}
-						}
-						limitMap[v.Field]["$gte"] = v.LowerLimit
+				findParams[v.Field] = map[string]float64{
+					"$eq": floatValue,
+				}
+			} else {
+				limitMap := map[string]map[string]float64{}
+				if v.LowerLimit != 0 {
+					if limitMap[v.Field] == nil {
+						limitMap[v.Field] = map[string]float64{}
 					}
-					if v.UpperLimit != 0 {
-						if limitMap[v.Field] == nil {
-							limitMap[v.Field] = map[string]float64{}
-						}
-						limitMap[v.Field]["$lte"] = v.UpperLimit
+					limitMap[v.Field]["$gte"] = v.LowerLimit
+				}
+				if v.UpperLimit != 0 {
+					if limitMap[v.Field] == nil {
+						limitMap[v.Field] = map[string]float64{}
 					}
-					findParams[v.Field] = limitMap[v.Field]
+					limitMap[v.Field]["$lte"] = v.UpperLimit
 				}
+				findParams[v.Field] = limitMap[v.Field]
+			}
 
-			case "int":
-				if v.Equal != "" {
-					intValue, err := strconv.ParseInt(v.Equal, 10, 64)
-					if err != nil {
-						err = errors.Wrap(err, "Error converting equal to int - InvAdvSearch")
-						log.Println(err)
-						return nil, err
-					}
-					findParams[v.Field] = map[string]int64{
-						"$eq": intValue,
-					}
-				} else {
-					limitMap := map[string]map[string]int64{}
-					if v.LowerLimit != 0 {
-						if limitMap[v.Field] == nil {
-							limitMap[v.Field] = map[string]int64{}
-						}
-						limitMap[v.Field]["$gte"] = int64(v.LowerLimit)
+		case "int":
+			if v.Equal != "" {
+				intValue, err := strconv.ParseInt(v.Equal, 10, 64)
+				if err != nil {
+					err = errors.Wrap(err, "Error converting equal to int")
+					log.Println(err)
+					return nil, err
+				}
+				findParams[v.Field] = map[string]int64{
+					"$eq": intValue,
+				}
+			} else {
+				limitMap := map[string]map[string]int64{}
+				if v.LowerLimit != 0 {
+					if limitMap[v.Field] == nil {
+						limitMap[v.Field] = map[string]int64{}
 					}
-					if v.UpperLimit != 0 {
-						if limitMap[v.Field] == nil {
-							limitMap[v.Field] = map[string]int64{}
-						}
-						limitMap[v.Field]["$lte"] = int64(v.UpperLimit)
+					limitMap[v.Field]["$gte"] = int64(v.LowerLimit)
+				}
+				if v.UpperLimit != 0 {
+					if limitMap[v.Field] == nil {
+						limitMap[v.Field] = map[string]int64{}
 					}
-
-					findParams[v.Field] = limitMap[v.Field]
-					log.Println(findParams[v.Field])
+					limitMap[v.Field]["$lte"] = int64(v.UpperLimit)
 				}
+
+				findParams[v.Field] = limitMap[v.Field]
+				log.Println(findParams[v.Field])
 			}
-			if v.Type == "string" {
-				findParams[v.Field] = map[string]interface{}{
-					"$eq": v.Equal,
-				}
+		}
+		if v.Type == "string" {
+			findParams[v.Field] = map[string]interface{}{
+				"$eq": v.Equal,
 			}
 		}
 	}
 
+	return findParams, nil
+}
+
+func (db *DB) InvAdvSearch(search map[string][]SearchParam) ([]Inventory, error) {
+
+	var findResults []interface{}
+	// var type string
+
+	findParams, err := db.searchFilter(search["inventory"])
+	if err != nil {
+		err = errors.Wrap(err, "Error building search-filter - InvAdvSearch")
+		log.Println(err)
+		return nil, err
+	}
+
 	log.Println(findParams, "###123################")
 
 	findResults, err = db.collection.Find(findParams)
@@ -218,8 +302,7 @@ func (db *DB) InvAdvSearch(search map[string][]SearchParam) ([]Inventory, error)
 
 	//length
 	if len(findResults) == 0 {
-		msg := "No results found - InvAdvSearch"
-		return nil, errors.New(msg)
+		return nil, ErrNoResults
 	}
 
 	inventory := []Inventory{}
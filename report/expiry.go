@@ -0,0 +1,155 @@
+package report
+
+import (
+	"log"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/pkg/errors"
+)
+
+// ExpiryRiskParams configures the expiry-risk report.
+type ExpiryRiskParams struct {
+	// Until is the date-expression up to which expiring lots are reported,
+	// such as "now+3d" or an ISO-8601 date. Defaults to "now+3d".
+	Until string `json:"until,omitempty"`
+	// IncludeExpired includes lots that have already expired with
+	// weight still unsold.
+	IncludeExpired bool `json:"include_expired,omitempty"`
+	// Filters restrict the inventory being reported.
+	Filters []SearchParam `json:"filters,omitempty"`
+	// Limit caps the number of lots returned. Zero returns all.
+	Limit int `json:"limit,omitempty"`
+}
+
+// ExpiryRisk is an inventory-lot expiring with weight still unsold.
+type ExpiryRisk struct {
+	ItemID     string `json:"item_id,omitempty" proto:"1"`
+	SKU        int64  `json:"sku" proto:"2"`
+	Name       string `json:"name,omitempty" proto:"3"`
+	Origin     string `json:"origin,omitempty" proto:"4"`
+	Lot        string `json:"lot,omitempty" proto:"5"`
+	ExpiryDate int64  `json:"expiry_date" proto:"6"`
+	// SecondsToExpiry is negative for lots that have already expired.
+	SecondsToExpiry int64   `json:"seconds_to_expiry" proto:"7"`
+	RemainingWeight float64 `json:"remaining_weight" proto:"8"`
+	Price           float64 `json:"price" proto:"9"`
+	RevenueAtRisk   float64 `json:"revenue_at_risk" proto:"10"`
+}
+
+// remainingWeightExpr is the weight of an inventory document that is
+// neither sold, wasted nor donated.
+var remainingWeightExpr = map[string]interface{}{
+	"$subtract": []interface{}{
+		ifNullZero("$total_weight"),
+		map[string]interface{}{
+			"$add": []interface{}{
+				ifNullZero("$sold_weight"),
+				ifNullZero("$waste_weight"),
+				ifNullZero("$donate_weight"),
+			},
+		},
+	},
+}
+
+// ifNullZero substitutes 0 for a missing field.
+func ifNullZero(field string) map[string]interface{} {
+	return map[string]interface{}{
+		"$ifNull": []interface{}{field, 0},
+	}
+}
+
+// ExpiryRisk lists the inventory-lots expiring before the configured time
+// that still have remaining weight, sorted by urgency. Lots expiring sooner
+// come first, and lots expiring together are ordered by revenue at risk.
+func (db *DB) ExpiryRisk(params ExpiryRiskParams) ([]ExpiryRisk, error) {
+	if params.Until == "" {
+		params.Until = "now+3d"
+	}
+
+	now := db.now()
+	until, err := resolveInstant(params.Until, now)
+	if err != nil {
+		err = errors.Wrapf(ErrInvalidParams, "Error resolving Until: %s - ExpiryRisk", err)
+		log.Println(err)
+		return nil, err
+	}
+
+	match, err := db.searchFilter(params.Filters)
+	if err != nil {
+		err = errors.Wrap(err, "Error building search-filter - ExpiryRisk")
+		log.Println(err)
+		return nil, err
+	}
+	expiryFilter := map[string]int64{
+		"$lt": until.Unix(),
+	}
+	if params.IncludeExpired {
+		// Documents without an expiry-date must still be excluded
+		expiryFilter["$gt"] = 0
+	} else {
+		expiryFilter["$gte"] = now.Unix()
+	}
+	match["expiry_date"] = expiryFilter
+
+	pipeline := []interface{}{
+		map[string]interface{}{
+			"$match": match,
+		},
+		map[string]interface{}{
+			"$addFields": map[string]interface{}{
+				"remaining_weight": remainingWeightExpr,
+			},
+		},
+		map[string]interface{}{
+			"$match": map[string]interface{}{
+				"remaining_weight": map[string]interface{}{
+					"$gt": 0,
+				},
+			},
+		},
+		map[string]interface{}{
+			"$addFields": map[string]interface{}{
+				"revenue_at_risk": map[string]interface{}{
+					"$multiply": []interface{}{"$remaining_weight", ifNullZero("$price")},
+				},
+			},
+		},
+		map[string]interface{}{
+			"$sort": bson.NewDocument(
+				bson.EC.Int32("expiry_date", 1),
+				bson.EC.Int32("revenue_at_risk", -1),
+			),
+		},
+	}
+	if params.Limit > 0 {
+		pipeline = append(pipeline, map[string]interface{}{
+			"$limit": params.Limit,
+		})
+	}
+
+	docs, err := db.aggregate(pipeline)
+	if err != nil {
+		err = errors.Wrap(err, "Error aggregating expiring inventory - ExpiryRisk")
+		log.Println(err)
+		return nil, err
+	}
+
+	risks := make([]ExpiryRisk, len(docs))
+	for i, doc := range docs {
+		expiry := toInt64(doc["expiry_date"])
+		risks[i] = ExpiryRisk{
+			ItemID:          toString(doc["item_id"]),
+			SKU:             toInt64(doc["sku"]),
+			Name:            toString(doc["name"]),
+			Origin:          toString(doc["origin"]),
+			Lot:             toString(doc["lot"]),
+			ExpiryDate:      expiry,
+			SecondsToExpiry: int64(time.Unix(expiry, 0).Sub(now) / time.Second),
+			RemainingWeight: toFloat64(doc["remaining_weight"]),
+			Price:           toFloat64(doc["price"]),
+			RevenueAtRisk:   toFloat64(doc["revenue_at_risk"]),
+		}
+	}
+	return risks, nil
+}
@@ -0,0 +1,136 @@
+package report
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+var _ = Describe("Expiry risk", func() {
+	now := time.Date(2018, 10, 17, 12, 0, 0, 0, time.UTC)
+	inDays := func(days int) int64 {
+		return now.AddDate(0, 0, days).Unix()
+	}
+
+	It("should reject unrecognized Until expressions", func() {
+		_, err := (&DB{}).ExpiryRisk(ExpiryRiskParams{Until: "soon"})
+		Expect(errors.Cause(err)).To(Equal(ErrInvalidParams))
+	})
+
+	Describe("in Mongo", func() {
+		var dbInventory *DB
+
+		testDatabase := "rns_report_expiry_test"
+
+		// skus returns the SKUs of the risks in order.
+		skus := func(risks []ExpiryRisk) []int64 {
+			s := make([]int64, len(risks))
+			for i, r := range risks {
+				s[i] = r.SKU
+			}
+			return s
+		}
+
+		BeforeEach(func() {
+			config := testDBConfig(testDatabase, "agg_inventory")
+			config.Clock = func() time.Time {
+				return now
+			}
+			var err error
+			dbInventory, err = GenerateDB(config, &Inventory{})
+			Expect(err).ToNot(HaveOccurred())
+
+			insertTestInventory(
+				dbInventory,
+				Inventory{
+					SKU: 1, Lot: "A", ExpiryDate: inDays(1),
+					TotalWeight: 100, SoldWeight: 40, WasteWeight: 10, Price: 2,
+				},
+				// Expires with the first lot, with more revenue at risk
+				Inventory{
+					SKU: 2, Lot: "B", ExpiryDate: inDays(1),
+					TotalWeight: 100, Price: 3,
+				},
+				// Without a price
+				Inventory{
+					SKU: 3, Lot: "C", ExpiryDate: inDays(2),
+					TotalWeight: 10,
+				},
+				// Sold out
+				Inventory{
+					SKU: 4, Lot: "D", ExpiryDate: inDays(1),
+					TotalWeight: 100, SoldWeight: 60, DonateWeight: 40, Price: 2,
+				},
+				// Expired
+				Inventory{
+					SKU: 5, Lot: "E", ExpiryDate: inDays(-1),
+					TotalWeight: 50, Price: 1,
+				},
+				// Expires after the default window
+				Inventory{
+					SKU: 6, Lot: "F", ExpiryDate: inDays(5),
+					TotalWeight: 50, Price: 1,
+				},
+				// Without an expiry-date
+				Inventory{
+					SKU: 7, Lot: "G",
+					TotalWeight: 50, Price: 1,
+				},
+			)
+		})
+
+		AfterEach(func() {
+			dropTestDB(testDatabase)
+		})
+
+		It("should list unsold lots by expiry, then by revenue at risk", func() {
+			risks, err := dbInventory.ExpiryRisk(ExpiryRiskParams{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(skus(risks)).To(Equal([]int64{2, 1, 3}))
+
+			Expect(risks[1].Lot).To(Equal("A"))
+			Expect(risks[1].ExpiryDate).To(Equal(inDays(1)))
+			Expect(risks[1].SecondsToExpiry).To(Equal(int64(86400)))
+			Expect(risks[1].RemainingWeight).To(Equal(float64(50)))
+			Expect(risks[1].RevenueAtRisk).To(Equal(float64(100)))
+
+			Expect(risks[2].RemainingWeight).To(Equal(float64(10)))
+			Expect(risks[2].RevenueAtRisk).To(BeZero())
+		})
+
+		It("should include expired lots only when requested", func() {
+			risks, err := dbInventory.ExpiryRisk(ExpiryRiskParams{
+				IncludeExpired: true,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(skus(risks)).To(Equal([]int64{5, 2, 1, 3}))
+			Expect(risks[0].SecondsToExpiry).To(Equal(int64(-86400)))
+		})
+
+		It("should report lots expiring until the configured time", func() {
+			risks, err := dbInventory.ExpiryRisk(ExpiryRiskParams{
+				Until: "now+1w",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(skus(risks)).To(Equal([]int64{2, 1, 3, 6}))
+		})
+
+		It("should filter and limit the lots", func() {
+			risks, err := dbInventory.ExpiryRisk(ExpiryRiskParams{
+				Limit: 2,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(skus(risks)).To(Equal([]int64{2, 1}))
+
+			risks, err = dbInventory.ExpiryRisk(ExpiryRiskParams{
+				Filters: []SearchParam{
+					{Field: "lot", Type: "string", Equal: "A"},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(skus(risks)).To(Equal([]int64{1}))
+		})
+	})
+})
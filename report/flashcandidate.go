@@ -0,0 +1,262 @@
+package report
+
+import (
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Weights of each factor in the flash-sale candidate-score.
+// The weights add up to 1, so scores range from 0 to 1.
+const (
+	ripenessWeight = 0.5
+	urgencyWeight  = 0.3
+	stockWeight    = 0.2
+)
+
+// DiscountRule suggests a discount for candidates scoring at least MinScore.
+type DiscountRule struct {
+	MinScore float64 `json:"min_score"`
+	// Discount is the fraction of the price taken off, from 0 to 1.
+	Discount float64 `json:"discount"`
+}
+
+// DefaultDiscountRules are used when no discount-rules are configured.
+var DefaultDiscountRules = []DiscountRule{
+	DiscountRule{MinScore: 0.8, Discount: 0.5},
+	DiscountRule{MinScore: 0.6, Discount: 0.3},
+	DiscountRule{MinScore: 0.4, Discount: 0.15},
+}
+
+// FlashCandidateParams configures the flash-sale candidate report.
+type FlashCandidateParams struct {
+	// EthyleneThreshold is the ethylene-reading at which an item is
+	// considered fully ripe. Defaults to 100.
+	EthyleneThreshold float64 `json:"ethylene_threshold,omitempty"`
+	// HorizonDays is the number of days before expiry after which the
+	// urgency of selling an item starts rising. Defaults to 7.
+	HorizonDays float64 `json:"horizon_days,omitempty"`
+	// DiscountRules map candidate-scores to discounts.
+	// Items not matching any rule are not candidates.
+	// Defaults to DefaultDiscountRules.
+	DiscountRules []DiscountRule `json:"discount_rules,omitempty"`
+	// Filters restrict the inventory being considered.
+	Filters []SearchParam `json:"filters,omitempty"`
+	// Limit caps the number of candidates returned. Zero returns all.
+	Limit int `json:"limit,omitempty"`
+}
+
+// FlashCandidate is an inventory-item suggested for a flash-sale.
+type FlashCandidate struct {
+	ItemID          string  `json:"item_id,omitempty" proto:"1"`
+	SKU             int64   `json:"sku" proto:"2"`
+	Name            string  `json:"name,omitempty" proto:"3"`
+	Lot             string  `json:"lot,omitempty" proto:"4"`
+	Ethylene        float64 `json:"ethylene" proto:"5"`
+	MetricTimestamp int64   `json:"metric_timestamp,omitempty" proto:"6"`
+	RemainingWeight float64 `json:"remaining_weight" proto:"7"`
+	DaysToExpiry    float64 `json:"days_to_expiry" proto:"8"`
+	Score           float64 `json:"score" proto:"9"`
+	Price           float64 `json:"price" proto:"10"`
+	Discount        float64 `json:"discount" proto:"11"`
+	SalePrice       float64 `json:"sale_price" proto:"12"`
+}
+
+// latestMetric is the most recent sensor-reading for an item.
+type latestMetric struct {
+	ethylene  float64
+	timestamp int64
+}
+
+// FlashCandidates scores the unexpired inventory with remaining weight as
+// flash-sale candidates, using the latest ethylene-reading of each item from
+// metricDB, the remaining weight, and the days left until expiry.
+// A sale-price is suggested for each candidate as per the discount-rules.
+// Candidates are sorted by descending score.
+func (db *DB) FlashCandidates(
+	metricDB DBI,
+	params FlashCandidateParams,
+) ([]FlashCandidate, error) {
+	if params.EthyleneThreshold <= 0 {
+		params.EthyleneThreshold = 100
+	}
+	if params.HorizonDays <= 0 {
+		params.HorizonDays = 7
+	}
+	if len(params.DiscountRules) == 0 {
+		params.DiscountRules = DefaultDiscountRules
+	}
+
+	now := db.now()
+	match, err := db.searchFilter(params.Filters)
+	if err != nil {
+		err = errors.Wrap(err, "Error building search-filter - FlashCandidates")
+		log.Println(err)
+		return nil, err
+	}
+	match["expiry_date"] = map[string]int64{
+		"$gte": now.Unix(),
+	}
+
+	invDocs, err := db.aggregate([]interface{}{
+		map[string]interface{}{
+			"$match": match,
+		},
+		map[string]interface{}{
+			"$addFields": map[string]interface{}{
+				"remaining_weight": remainingWeightExpr,
+			},
+		},
+		map[string]interface{}{
+			"$match": map[string]interface{}{
+				"remaining_weight": map[string]interface{}{
+					"$gt": 0,
+				},
+			},
+		},
+	})
+	if err != nil {
+		err = errors.Wrap(err, "Error aggregating inventory - FlashCandidates")
+		log.Println(err)
+		return nil, err
+	}
+	if len(invDocs) == 0 {
+		return []FlashCandidate{}, nil
+	}
+
+	itemIDs := make([]interface{}, 0, len(invDocs))
+	for _, doc := range invDocs {
+		if id := toString(doc["item_id"]); id != "" {
+			itemIDs = append(itemIDs, id)
+		}
+	}
+	metrics, err := latestMetrics(metricDB, itemIDs)
+	if err != nil {
+		err = errors.Wrap(err, "Error aggregating metrics - FlashCandidates")
+		log.Println(err)
+		return nil, err
+	}
+
+	candidates := []FlashCandidate{}
+	for _, doc := range invDocs {
+		itemID := toString(doc["item_id"])
+		metric := metrics[itemID]
+
+		remaining := toFloat64(doc["remaining_weight"])
+		total := toFloat64(doc["total_weight"])
+		expiry := time.Unix(toInt64(doc["expiry_date"]), 0)
+		daysToExpiry := expiry.Sub(now).Hours() / 24
+
+		score := flashScore(
+			metric.ethylene/params.EthyleneThreshold,
+			daysToExpiry/params.HorizonDays,
+			remaining/total,
+		)
+		discount, isCandidate := matchDiscount(score, params.DiscountRules)
+		if !isCandidate {
+			continue
+		}
+
+		price := toFloat64(doc["price"])
+		candidates = append(candidates, FlashCandidate{
+			ItemID:          itemID,
+			SKU:             toInt64(doc["sku"]),
+			Name:            toString(doc["name"]),
+			Lot:             toString(doc["lot"]),
+			Ethylene:        metric.ethylene,
+			MetricTimestamp: metric.timestamp,
+			RemainingWeight: remaining,
+			DaysToExpiry:    daysToExpiry,
+			Score:           score,
+			Price:           price,
+			Discount:        discount,
+			SalePrice:       math.Round(price*(1-discount)*100) / 100,
+		})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	if params.Limit > 0 && len(candidates) > params.Limit {
+		candidates = candidates[:params.Limit]
+	}
+	return candidates, nil
+}
+
+// latestMetrics returns the most recent metric of each item, keyed by ItemID.
+func latestMetrics(metricDB DBI, itemIDs []interface{}) (map[string]latestMetric, error) {
+	docs, err := aggregateDocs(metricDB.Collection(), []interface{}{
+		map[string]interface{}{
+			"$match": map[string]interface{}{
+				"item_id": map[string]interface{}{
+					"$in": itemIDs,
+				},
+			},
+		},
+		map[string]interface{}{
+			"$sort": map[string]interface{}{
+				"timestamp": -1,
+			},
+		},
+		map[string]interface{}{
+			"$group": map[string]interface{}{
+				"_id": "$item_id",
+				"ethylene": map[string]interface{}{
+					"$first": "$ethylene",
+				},
+				"timestamp": map[string]interface{}{
+					"$first": "$timestamp",
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := map[string]latestMetric{}
+	for _, doc := range docs {
+		metrics[toString(doc["_id"])] = latestMetric{
+			ethylene:  toFloat64(doc["ethylene"]),
+			timestamp: toInt64(doc["timestamp"]),
+		}
+	}
+	return metrics, nil
+}
+
+// flashScore combines the ripeness (ethylene relative to the ripe-threshold),
+// the expiry (days to expiry relative to the horizon), and the unsold share
+// of stock into a score from 0 to 1.
+func flashScore(ripeness, expiry, unsold float64) float64 {
+	ripeness = clamp(ripeness, 0, 1)
+	urgency := 1 - clamp(expiry, 0, 1)
+	unsold = clamp(unsold, 0, 1)
+
+	score := ripenessWeight*ripeness + urgencyWeight*urgency + stockWeight*unsold
+	return math.Round(score*1000) / 1000
+}
+
+// matchDiscount returns the discount of the rule with the highest MinScore
+// that the score satisfies. False is returned if no rule matches.
+func matchDiscount(score float64, rules []DiscountRule) (float64, bool) {
+	var matched *DiscountRule
+	for i, rule := range rules {
+		if score >= rule.MinScore && (matched == nil || rule.MinScore > matched.MinScore) {
+			matched = &rules[i]
+		}
+	}
+	if matched == nil {
+		return 0, false
+	}
+	return clamp(matched.Discount, 0, 1), true
+}
+
+func clamp(v, min, max float64) float64 {
+	if math.IsNaN(v) {
+		return min
+	}
+	return math.Max(min, math.Min(max, v))
+}
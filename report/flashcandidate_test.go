@@ -0,0 +1,29 @@
+package report
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Flash-sale candidates", func() {
+	It("should score ripe, expiring and unsold items highest", func() {
+		Expect(flashScore(1, 0, 1)).To(Equal(float64(1)))
+		Expect(flashScore(0, 1, 0)).To(Equal(float64(0)))
+		Expect(flashScore(0.5, 0.5, 0.5)).To(Equal(0.5))
+		// Out-of-range factors are clamped
+		Expect(flashScore(3, -2, 1)).To(Equal(float64(1)))
+	})
+
+	It("should apply the discount of the highest matching rule", func() {
+		discount, ok := matchDiscount(0.85, DefaultDiscountRules)
+		Expect(ok).To(BeTrue())
+		Expect(discount).To(Equal(0.5))
+
+		discount, ok = matchDiscount(0.65, DefaultDiscountRules)
+		Expect(ok).To(BeTrue())
+		Expect(discount).To(Equal(0.3))
+
+		_, ok = matchDiscount(0.2, DefaultDiscountRules)
+		Expect(ok).To(BeFalse())
+	})
+})
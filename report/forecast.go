@@ -0,0 +1,335 @@
+package report
+
+import (
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Forecasting methods.
+const (
+	MovingAverage        = "moving_average"
+	ExponentialSmoothing = "exponential_smoothing"
+)
+
+// ForecastParams configures the demand-forecast report.
+type ForecastParams struct {
+	// Method is either ExponentialSmoothing (default) or MovingAverage.
+	Method string `json:"method,omitempty"`
+	// HistoryDays is the number of past days the forecast is built on.
+	// Defaults to 56.
+	HistoryDays int `json:"history_days,omitempty"`
+	// Horizon is the number of days predicted. Defaults to 7.
+	Horizon int `json:"horizon,omitempty"`
+	// Window is the number of days averaged by MovingAverage. Defaults to 7.
+	Window int `json:"window,omitempty"`
+	// Alpha is the smoothing-factor of ExponentialSmoothing, from 0 to 1.
+	// Defaults to 0.3.
+	Alpha float64 `json:"alpha,omitempty"`
+	// NoSeasonality disables the weekday-seasonality adjustment.
+	NoSeasonality bool `json:"no_seasonality,omitempty"`
+	// Z is the z-score of the confidence-band. Defaults to 1.96 (95%).
+	Z float64 `json:"z,omitempty"`
+	// Filters restrict the inventory being forecast, such as by SKU.
+	Filters []SearchParam `json:"filters,omitempty"`
+}
+
+// Prediction is the forecast sold-weight for a day.
+type Prediction struct {
+	// Day is the Unix timestamp of the start of the day (UTC).
+	Day   int64   `json:"day" proto:"1"`
+	Date  string  `json:"date" proto:"2"`
+	Value float64 `json:"value" proto:"3"`
+	Lower float64 `json:"lower" proto:"4"`
+	Upper float64 `json:"upper" proto:"5"`
+}
+
+// Forecast is the predicted daily demand of an SKU.
+type Forecast struct {
+	SKU  int64  `json:"sku" proto:"1"`
+	Name string `json:"name,omitempty" proto:"2"`
+	// Velocity is the mean daily sold-weight over the history.
+	Velocity    float64      `json:"velocity" proto:"3"`
+	Method      string       `json:"method" proto:"4"`
+	Predictions []Prediction `json:"predictions" proto:"5"`
+}
+
+// skuDaily is the daily sold-weight series of an SKU, keyed by the Unix
+// timestamp of the start of each day.
+type skuDaily struct {
+	name string
+	sold map[int64]float64
+}
+
+// Forecast predicts the next days' sold-weight of each SKU from its daily
+// history, using moving-average or exponential-smoothing, adjusted for
+// weekday-seasonality. The confidence-band is derived from the residuals
+// of the one-step-ahead fit over the history.
+func (db *DB) Forecast(params ForecastParams) ([]Forecast, error) {
+	if params.Method == "" {
+		params.Method = ExponentialSmoothing
+	}
+	if params.Method != ExponentialSmoothing && params.Method != MovingAverage {
+		err := errors.Wrapf(ErrInvalidParams, "Unknown method: %s - Forecast", params.Method)
+		log.Println(err)
+		return nil, err
+	}
+	if params.HistoryDays <= 0 {
+		params.HistoryDays = 56
+	}
+	if params.Horizon <= 0 {
+		params.Horizon = 7
+	}
+	if params.Window <= 0 {
+		params.Window = 7
+	}
+	if params.Alpha <= 0 || params.Alpha > 1 {
+		params.Alpha = 0.3
+	}
+	if params.Z <= 0 {
+		params.Z = 1.96
+	}
+
+	today := startOfDay(db.now().In(rollupZone))
+	history := Period{
+		Start: today.AddDate(0, 0, -params.HistoryDays).Unix(),
+		End:   today.Unix(),
+	}
+	daily, err := db.dailySold(params.Filters, history)
+	if err != nil {
+		err = errors.Wrap(err, "Error aggregating daily sales - Forecast")
+		log.Println(err)
+		return nil, err
+	}
+
+	forecasts := make([]Forecast, 0, len(daily))
+	for sku, series := range daily {
+		days, values := denseSeries(series.sold, history)
+		forecasts = append(forecasts, Forecast{
+			SKU:         sku,
+			Name:        series.name,
+			Velocity:    mean(values),
+			Method:      params.Method,
+			Predictions: forecastSeries(days, values, params),
+		})
+	}
+
+	sort.Slice(forecasts, func(i, j int) bool {
+		return forecasts[i].SKU < forecasts[j].SKU
+	})
+	return forecasts, nil
+}
+
+// dailySold aggregates the sold-weight per SKU per day (UTC) in the period.
+// The rollup is used if it serves the filters.
+func (db *DB) dailySold(filters []SearchParam, p Period) (map[int64]skuDaily, error) {
+	source := db
+	var match map[string]interface{}
+	var err error
+	var day interface{}
+
+	if db.rollupServes(filters, p) {
+		source = db.rollup
+		match, err = db.rollupMatch(filters, p)
+		day = "$day"
+	} else {
+		match, err = db.searchFilter(filters)
+		if err == nil {
+			match["date_sold"] = map[string]int64{
+				"$gte": p.Start,
+				"$lt":  p.End,
+			}
+		}
+		day = map[string]interface{}{
+			"$subtract": []interface{}{
+				"$date_sold",
+				map[string]interface{}{
+					"$mod": []interface{}{"$date_sold", secondsPerDay},
+				},
+			},
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	docs, err := source.aggregate([]interface{}{
+		map[string]interface{}{
+			"$match": match,
+		},
+		map[string]interface{}{
+			"$group": map[string]interface{}{
+				"_id": map[string]interface{}{
+					"sku": "$sku",
+					"day": day,
+				},
+				"name": map[string]interface{}{
+					"$first": "$name",
+				},
+				"sold_weight": map[string]interface{}{
+					"$sum": "$sold_weight",
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	daily := map[int64]skuDaily{}
+	for _, doc := range docs {
+		key, _ := doc["_id"].(map[string]interface{})
+		sku := toInt64(key["sku"])
+
+		series, exists := daily[sku]
+		if !exists {
+			series = skuDaily{
+				name: toString(doc["name"]),
+				sold: map[int64]float64{},
+			}
+			daily[sku] = series
+		}
+		series.sold[toInt64(key["day"])] += toFloat64(doc["sold_weight"])
+	}
+	return daily, nil
+}
+
+// denseSeries converts the sparse daily-series into consecutive days over
+// the period, filling in zero for days without sales.
+func denseSeries(sold map[int64]float64, p Period) ([]time.Time, []float64) {
+	days := []time.Time{}
+	values := []float64{}
+	for day := p.Start; day < p.End; day += secondsPerDay {
+		days = append(days, time.Unix(day, 0).UTC())
+		values = append(values, sold[day])
+	}
+	return days, values
+}
+
+// forecastSeries predicts params.Horizon days following the daily values.
+func forecastSeries(days []time.Time, values []float64, params ForecastParams) []Prediction {
+	seasonal := weekdayIndices(days, values)
+	if params.NoSeasonality {
+		seasonal = [7]float64{1, 1, 1, 1, 1, 1, 1}
+	}
+
+	// Remove seasonality, so the level reflects the underlying demand.
+	// Days of weekdays that never sell carry no information on the level.
+	points := []int{}
+	adjusted := []float64{}
+	for i, v := range values {
+		if index := seasonal[days[i].Weekday()]; index > 0 {
+			points = append(points, i)
+			adjusted = append(adjusted, v/index)
+		}
+	}
+
+	// One-step-ahead fit over the history, for the final level and residuals
+	var level float64
+	residuals := []float64{}
+	for j, i := range points {
+		var fitted float64
+		var hasFit bool
+
+		switch params.Method {
+		case MovingAverage:
+			if j >= params.Window {
+				fitted = mean(adjusted[j-params.Window : j])
+				hasFit = true
+			}
+		case ExponentialSmoothing:
+			if j == 0 {
+				level = adjusted[0]
+			} else {
+				fitted = level
+				hasFit = true
+				level = params.Alpha*adjusted[j] + (1-params.Alpha)*level
+			}
+		}
+
+		if hasFit {
+			fitted *= seasonal[days[i].Weekday()]
+			residuals = append(residuals, values[i]-fitted)
+		}
+	}
+	if params.Method == MovingAverage {
+		window := params.Window
+		if window > len(adjusted) {
+			window = len(adjusted)
+		}
+		level = mean(adjusted[len(adjusted)-window:])
+	}
+	sigma := stddev(residuals)
+
+	predictions := make([]Prediction, params.Horizon)
+	next := days[len(days)-1]
+	for h := 1; h <= params.Horizon; h++ {
+		next = next.AddDate(0, 0, 1)
+		value := level * seasonal[next.Weekday()]
+
+		// The uncertainty of smoothed forecasts grows with the horizon
+		spread := sigma
+		if params.Method == ExponentialSmoothing {
+			spread *= math.Sqrt(1 + float64(h-1)*params.Alpha*params.Alpha)
+		}
+		spread *= params.Z
+
+		predictions[h-1] = Prediction{
+			Day:   next.Unix(),
+			Date:  next.Format("2006-01-02"),
+			Value: value,
+			Lower: math.Max(0, value-spread),
+			Upper: value + spread,
+		}
+	}
+	return predictions
+}
+
+// weekdayIndices returns, for each weekday, the ratio of its mean value to
+// the overall mean. Weekdays without any data get an index of 1.
+func weekdayIndices(days []time.Time, values []float64) [7]float64 {
+	var sums [7]float64
+	var counts [7]int
+	for i, v := range values {
+		wd := days[i].Weekday()
+		sums[wd] += v
+		counts[wd]++
+	}
+
+	overall := mean(values)
+	var indices [7]float64
+	for wd := range indices {
+		indices[wd] = 1
+		if overall > 0 && counts[wd] > 0 {
+			indices[wd] = sums[wd] / float64(counts[wd]) / overall
+		}
+	}
+	return indices
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// stddev returns the sample standard-deviation of values.
+func stddev(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	m := mean(values)
+	var sum float64
+	for _, v := range values {
+		sum += (v - m) * (v - m)
+	}
+	return math.Sqrt(sum / float64(len(values)-1))
+}
@@ -0,0 +1,71 @@
+package report
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Demand forecast", func() {
+	var (
+		days   []time.Time
+		params ForecastParams
+	)
+
+	BeforeEach(func() {
+		// Four weeks, starting on a Monday
+		start := time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC)
+		days = []time.Time{}
+		for i := 0; i < 28; i++ {
+			days = append(days, start.AddDate(0, 0, i))
+		}
+		params = ForecastParams{
+			Horizon: 7,
+			Window:  7,
+			Alpha:   0.3,
+			Z:       1.96,
+		}
+	})
+
+	It("should predict a constant series exactly", func() {
+		values := make([]float64, len(days))
+		for i := range values {
+			values[i] = 40
+		}
+
+		for _, method := range []string{MovingAverage, ExponentialSmoothing} {
+			params.Method = method
+			predictions := forecastSeries(days, values, params)
+			Expect(predictions).To(HaveLen(7))
+			for _, p := range predictions {
+				Expect(p.Value).To(BeNumerically("~", 40, 1e-9))
+				Expect(p.Lower).To(BeNumerically("~", 40, 1e-9))
+				Expect(p.Upper).To(BeNumerically("~", 40, 1e-9))
+			}
+			Expect(predictions[0].Date).To(Equal("2018-10-29"))
+		}
+	})
+
+	It("should follow the weekday-seasonality", func() {
+		// Sells double on Saturdays, and nothing on Sundays
+		values := make([]float64, len(days))
+		for i, day := range days {
+			switch day.Weekday() {
+			case time.Saturday:
+				values[i] = 20
+			case time.Sunday:
+				values[i] = 0
+			default:
+				values[i] = 10
+			}
+		}
+
+		params.Method = ExponentialSmoothing
+		predictions := forecastSeries(days, values, params)
+		// Monday 29th to Sunday 4th
+		Expect(predictions[0].Value).To(BeNumerically("~", 10, 1e-9))
+		Expect(predictions[5].Value).To(BeNumerically("~", 20, 1e-9))
+		Expect(predictions[6].Value).To(BeNumerically("~", 0, 1e-9))
+	})
+})
@@ -0,0 +1,53 @@
+package report
+
+import (
+	"github.com/TerrexTech/go-commonutils/commonutil"
+	mongo "github.com/TerrexTech/go-mongoutils/mongo"
+	"github.com/TerrexTech/uuuid"
+	. "github.com/onsi/gomega"
+)
+
+// testDBConfig returns the DBIConfig for a collection in the test-database.
+func testDBConfig(database, collection string) DBIConfig {
+	return DBIConfig{
+		Hosts:               *commonutil.ParseHosts("localhost:27017"),
+		Username:            "root",
+		Password:            "root",
+		TimeoutMilliseconds: 3000,
+		Database:            database,
+		Collection:          collection,
+	}
+}
+
+// dropTestDB drops the test-database.
+func dropTestDB(database string) {
+	client, err := mongo.NewClient(mongo.ClientConfig{
+		Hosts:               *commonutil.ParseHosts("localhost:27017"),
+		Username:            "root",
+		Password:            "root",
+		TimeoutMilliseconds: 3000,
+	})
+	Expect(err).ToNot(HaveOccurred())
+
+	dbCtx, dbCancel := newTimeoutContext(3000)
+	err = client.Database(database).Drop(dbCtx)
+	dbCancel()
+	Expect(err).ToNot(HaveOccurred())
+
+	err = client.Disconnect()
+	Expect(err).ToNot(HaveOccurred())
+}
+
+// insertTestInventory inserts the inventory into the collection, assigning
+// ItemIDs to items without one.
+func insertTestInventory(db *DB, invs ...Inventory) {
+	for _, inv := range invs {
+		if inv.ItemID == (uuuid.UUID{}) {
+			itemID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			inv.ItemID = itemID
+		}
+		_, err := db.collection.InsertOne(&inv)
+		Expect(err).ToNot(HaveOccurred())
+	}
+}
@@ -603,3 +603,13 @@ func (i *Inventory) UnmarshalJSON(in []byte) error {
 
 	return nil
 }
+
+// Revenue is the realized revenue of the item: the sold-weight at the
+// sale-price if one was set, else at the list-price.
+func (i *Inventory) Revenue() float64 {
+	price := i.Price
+	if i.SalePrice > 0 {
+		price = i.SalePrice
+	}
+	return i.SoldWeight * price
+}
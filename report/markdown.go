@@ -0,0 +1,162 @@
+package report
+
+import (
+	"log"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// MarkdownParams configures the markdown report.
+type MarkdownParams struct {
+	// Filters restrict the inventory being reported,
+	// such as a date_sold range.
+	Filters []SearchParam `json:"filters,omitempty"`
+	// Limit caps the number of SKUs returned. Zero returns all.
+	Limit int `json:"limit,omitempty"`
+}
+
+// Markdown is the revenue lost to discounts on a SKU.
+type Markdown struct {
+	SKU  int64  `json:"sku" proto:"1"`
+	Name string `json:"name,omitempty" proto:"2"`
+	// ListRevenue is the revenue had everything sold at list-price.
+	ListRevenue float64 `json:"list_revenue" proto:"3"`
+	// Revenue is the revenue realized at the actual sale-prices.
+	Revenue      float64 `json:"revenue" proto:"4"`
+	MarkdownCost float64 `json:"markdown_cost" proto:"5"`
+
+	SoldWeight       float64 `json:"sold_weight" proto:"6"`
+	DiscountedWeight float64 `json:"discounted_weight" proto:"7"`
+	FlashWeight      float64 `json:"flash_weight" proto:"8"`
+	// The shares of sold-weight sold at a discount, in total, through
+	// flash-sales, and through regular discounts.
+	DiscountedShare      float64 `json:"discounted_share" proto:"9"`
+	FlashShare           float64 `json:"flash_share" proto:"10"`
+	RegularDiscountShare float64 `json:"regular_discount_share" proto:"11"`
+}
+
+// Markdown reports per SKU the list-price revenue, the revenue realized at
+// sale-price, and the markdown-cost between them. The discounted share of
+// sold-weight is split between flash-sales, which are items present in
+// flashDB, and regular discounts. SKUs are sorted by descending markdown-cost.
+// The flash-collection must be in the same database as the inventory, since
+// flash-sales are joined using $lookup.
+func (db *DB) Markdown(flashDB DBI, params MarkdownParams) ([]Markdown, error) {
+	flashColl := flashDB.Collection()
+	if flashColl.Database != db.collection.Database {
+		err := errors.Errorf(
+			"Flash-collection must be in database %s, got %s - Markdown",
+			db.collection.Database, flashColl.Database,
+		)
+		log.Println(err)
+		return nil, err
+	}
+
+	match, err := db.searchFilter(params.Filters)
+	if err != nil {
+		err = errors.Wrap(err, "Error building search-filter - Markdown")
+		log.Println(err)
+		return nil, err
+	}
+
+	isDiscounted := map[string]interface{}{
+		"$and": []interface{}{
+			map[string]interface{}{
+				"$gt": []interface{}{"$sale_price", 0},
+			},
+			map[string]interface{}{
+				"$lt": []interface{}{"$sale_price", "$price"},
+			},
+		},
+	}
+	isFlash := map[string]interface{}{
+		"$gt": []interface{}{
+			map[string]interface{}{
+				"$size": "$flash_sales",
+			},
+			0,
+		},
+	}
+	soldIf := func(cond interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"$sum": map[string]interface{}{
+				"$cond": []interface{}{cond, ifNullZero("$sold_weight"), 0},
+			},
+		}
+	}
+
+	docs, err := db.aggregate([]interface{}{
+		map[string]interface{}{
+			"$match": match,
+		},
+		// Only the matched inventory is joined with its flash-sales
+		map[string]interface{}{
+			"$lookup": map[string]interface{}{
+				"from":         flashColl.Name,
+				"localField":   "item_id",
+				"foreignField": "item_id",
+				"as":           "flash_sales",
+			},
+		},
+		map[string]interface{}{
+			"$group": map[string]interface{}{
+				"_id": "$sku",
+				"name": map[string]interface{}{
+					"$first": "$name",
+				},
+				"sold_weight": map[string]interface{}{
+					"$sum": "$sold_weight",
+				},
+				"list_revenue": map[string]interface{}{
+					"$sum": map[string]interface{}{
+						"$multiply": []interface{}{"$sold_weight", "$price"},
+					},
+				},
+				"revenue": map[string]interface{}{
+					"$sum": revenueExpr,
+				},
+				"discounted_weight": soldIf(isDiscounted),
+				"flash_weight": soldIf(map[string]interface{}{
+					"$and": []interface{}{isDiscounted, isFlash},
+				}),
+			},
+		},
+	})
+	if err != nil {
+		err = errors.Wrap(err, "Error aggregating inventory - Markdown")
+		log.Println(err)
+		return nil, err
+	}
+
+	markdowns := make([]Markdown, len(docs))
+	for i, doc := range docs {
+		md := Markdown{
+			SKU:              toInt64(doc["_id"]),
+			Name:             toString(doc["name"]),
+			ListRevenue:      toFloat64(doc["list_revenue"]),
+			Revenue:          toFloat64(doc["revenue"]),
+			SoldWeight:       toFloat64(doc["sold_weight"]),
+			DiscountedWeight: toFloat64(doc["discounted_weight"]),
+			FlashWeight:      toFloat64(doc["flash_weight"]),
+		}
+		md.MarkdownCost = md.ListRevenue - md.Revenue
+		if md.SoldWeight > 0 {
+			md.DiscountedShare = md.DiscountedWeight / md.SoldWeight
+			md.FlashShare = md.FlashWeight / md.SoldWeight
+			md.RegularDiscountShare = md.DiscountedShare - md.FlashShare
+		}
+		markdowns[i] = md
+	}
+
+	sort.Slice(markdowns, func(i, j int) bool {
+		if markdowns[i].MarkdownCost != markdowns[j].MarkdownCost {
+			return markdowns[i].MarkdownCost > markdowns[j].MarkdownCost
+		}
+		return markdowns[i].SKU < markdowns[j].SKU
+	})
+	if params.Limit > 0 && len(markdowns) > params.Limit {
+		markdowns = markdowns[:params.Limit]
+	}
+	return markdowns, nil
+}
@@ -0,0 +1,150 @@
+package report
+
+import (
+	mongo "github.com/TerrexTech/go-mongoutils/mongo"
+	"github.com/TerrexTech/uuuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Markdown", func() {
+	It("should require the flash-collection in the inventory database", func() {
+		dbInventory := &DB{
+			collection: &mongo.Collection{Database: "rns_projections"},
+		}
+		dbFlash := &DB{
+			collection: &mongo.Collection{Database: "rns_flash"},
+		}
+		_, err := dbInventory.Markdown(dbFlash, MarkdownParams{})
+		Expect(err).To(HaveOccurred())
+	})
+
+	Describe("in Mongo", func() {
+		var (
+			dbInventory *DB
+			dbFlash     *DB
+		)
+
+		testDatabase := "rns_report_markdown_test"
+		canada := []SearchParam{
+			{Field: "origin", Type: "string", Equal: "Canada"},
+		}
+
+		// flashed returns an ItemID that has been on flash-sale.
+		flashed := func() uuuid.UUID {
+			itemID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = dbFlash.collection.InsertOne(&Flash{
+				ItemID:    itemID,
+				SalePrice: 1,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			return itemID
+		}
+
+		BeforeEach(func() {
+			var err error
+			dbInventory, err = GenerateDB(
+				testDBConfig(testDatabase, "agg_inventory"), &Inventory{},
+			)
+			Expect(err).ToNot(HaveOccurred())
+			dbFlash, err = GenerateDB(
+				testDBConfig(testDatabase, "agg_flash"), &Flash{},
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			// Flash-sales of items not in the inventory are ignored
+			flashed()
+
+			insertTestInventory(
+				dbInventory,
+				// Apples sold through a flash-sale, a regular discount, and
+				// at list-price
+				Inventory{
+					ItemID: flashed(), SKU: 1, Name: "apple", Origin: "Canada",
+					Price: 2, SalePrice: 1, SoldWeight: 10,
+				},
+				Inventory{
+					SKU: 1, Name: "apple", Origin: "Canada",
+					Price: 2, SalePrice: 1.5, SoldWeight: 10,
+				},
+				Inventory{
+					SKU: 1, Name: "apple", Origin: "Canada",
+					Price: 2, SoldWeight: 20,
+				},
+				Inventory{
+					ItemID: flashed(), SKU: 2, Name: "pear", Origin: "Canada",
+					Price: 4, SalePrice: 2, SoldWeight: 10,
+				},
+				// Nothing sold
+				Inventory{
+					SKU: 3, Name: "plum", Origin: "Canada",
+					Price: 3,
+				},
+				// Ties with the plum on markdown-cost
+				Inventory{
+					SKU: 4, Name: "kiwi", Origin: "Canada",
+					Price: 1, SoldWeight: 10,
+				},
+				Inventory{
+					SKU: 5, Name: "mango", Origin: "Mexico",
+					Price: 10, SalePrice: 1, SoldWeight: 10,
+				},
+			)
+		})
+
+		AfterEach(func() {
+			dropTestDB(testDatabase)
+		})
+
+		It("should split discounted weight between flash-sales and regular discounts", func() {
+			markdowns, err := dbInventory.Markdown(dbFlash, MarkdownParams{
+				Filters: canada,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(markdowns).To(HaveLen(4))
+
+			Expect(markdowns[1]).To(Equal(Markdown{
+				SKU:                  1,
+				Name:                 "apple",
+				ListRevenue:          80,
+				Revenue:              65,
+				MarkdownCost:         15,
+				SoldWeight:           40,
+				DiscountedWeight:     20,
+				FlashWeight:          10,
+				DiscountedShare:      0.5,
+				FlashShare:           0.25,
+				RegularDiscountShare: 0.25,
+			}))
+			Expect(markdowns[0].SKU).To(Equal(int64(2)))
+			Expect(markdowns[0].MarkdownCost).To(Equal(float64(20)))
+			Expect(markdowns[0].FlashShare).To(Equal(float64(1)))
+		})
+
+		It("should order SKUs by markdown-cost, breaking ties by SKU", func() {
+			markdowns, err := dbInventory.Markdown(dbFlash, MarkdownParams{
+				Filters: canada,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(markdowns[2].SKU).To(Equal(int64(3)))
+			Expect(markdowns[3].SKU).To(Equal(int64(4)))
+
+			// SKUs without sales have no shares
+			Expect(markdowns[2].SoldWeight).To(BeZero())
+			Expect(markdowns[2].MarkdownCost).To(BeZero())
+			Expect(markdowns[2].DiscountedShare).To(BeZero())
+		})
+
+		It("should limit the SKUs", func() {
+			markdowns, err := dbInventory.Markdown(dbFlash, MarkdownParams{
+				Limit: 2,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(markdowns).To(HaveLen(2))
+			Expect(markdowns[0].SKU).To(Equal(int64(5)))
+			Expect(markdowns[0].MarkdownCost).To(Equal(float64(90)))
+			Expect(markdowns[1].SKU).To(Equal(int64(2)))
+		})
+	})
+})
@@ -0,0 +1,189 @@
+package report
+
+import (
+	"log"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Groupings supported by the origin-performance report.
+const (
+	GroupByOrigin    = "origin"
+	GroupByLot       = "lot"
+	GroupByOriginLot = "origin_lot"
+)
+
+// secondsPerDay converts Unix-timestamp differences to days.
+const secondsPerDay = 86400
+
+// OriginPerformanceParams configures the origin/supplier-performance report.
+type OriginPerformanceParams struct {
+	// GroupBy is one of GroupByOrigin (default), GroupByLot or
+	// GroupByOriginLot.
+	GroupBy string `json:"group_by,omitempty"`
+	// SortBy is one of "sell_through" (default), "waste_rate",
+	// "arrival_weight" or "avg_days_to_sell".
+	SortBy string `json:"sort_by,omitempty"`
+	// Ascending reverses the default descending sort.
+	Ascending bool `json:"ascending,omitempty"`
+	// Filters restrict the inventory being reported,
+	// such as a date_arrived range.
+	Filters []SearchParam `json:"filters,omitempty"`
+	// Limit caps the number of groups returned. Zero returns all.
+	Limit int `json:"limit,omitempty"`
+}
+
+// OriginPerformance is how well the product from an origin and/or lot sells.
+type OriginPerformance struct {
+	Origin        string  `json:"origin,omitempty" proto:"1"`
+	Lot           string  `json:"lot,omitempty" proto:"2"`
+	Items         int64   `json:"items" proto:"3"`
+	ArrivalWeight float64 `json:"arrival_weight" proto:"4"`
+	SoldWeight    float64 `json:"sold_weight" proto:"5"`
+	WasteWeight   float64 `json:"waste_weight" proto:"6"`
+	// SellThrough is the share of arrived weight that has sold.
+	SellThrough float64 `json:"sell_through" proto:"7"`
+	// WasteRate is the share of arrived weight that was wasted.
+	WasteRate float64 `json:"waste_rate" proto:"8"`
+	// AvgDaysToSell is the mean days from date_arrived to date_sold,
+	// over the items that have sold.
+	AvgDaysToSell float64 `json:"avg_days_to_sell" proto:"9"`
+}
+
+// OriginPerformance reports the arrival-volume, sell-through, waste-rate and
+// average days-to-sell of inventory grouped by origin and/or lot.
+func (db *DB) OriginPerformance(params OriginPerformanceParams) ([]OriginPerformance, error) {
+	var groupKey interface{}
+	switch params.GroupBy {
+	case "", GroupByOrigin:
+		groupKey = map[string]interface{}{"origin": "$origin"}
+	case GroupByLot:
+		groupKey = map[string]interface{}{"lot": "$lot"}
+	case GroupByOriginLot:
+		groupKey = map[string]interface{}{"origin": "$origin", "lot": "$lot"}
+	default:
+		err := errors.Wrapf(
+			ErrInvalidParams, "Unsupported group_by: %s - OriginPerformance", params.GroupBy,
+		)
+		log.Println(err)
+		return nil, err
+	}
+
+	sortValue, err := originSortValue(params.SortBy)
+	if err != nil {
+		err = errors.Wrap(err, "OriginPerformance")
+		log.Println(err)
+		return nil, err
+	}
+
+	match, err := db.searchFilter(params.Filters)
+	if err != nil {
+		err = errors.Wrap(err, "Error building search-filter - OriginPerformance")
+		log.Println(err)
+		return nil, err
+	}
+
+	hasSold := map[string]interface{}{
+		"$and": []interface{}{
+			map[string]interface{}{
+				"$gt": []interface{}{"$date_sold", 0},
+			},
+			map[string]interface{}{
+				"$gt": []interface{}{"$date_arrived", 0},
+			},
+		},
+	}
+	daysToSell := map[string]interface{}{
+		"$divide": []interface{}{
+			map[string]interface{}{
+				"$subtract": []interface{}{"$date_sold", "$date_arrived"},
+			},
+			secondsPerDay,
+		},
+	}
+
+	docs, err := db.aggregate([]interface{}{
+		map[string]interface{}{
+			"$match": match,
+		},
+		map[string]interface{}{
+			"$group": map[string]interface{}{
+				"_id": groupKey,
+				"items": map[string]interface{}{
+					"$sum": 1,
+				},
+				"arrival_weight": map[string]interface{}{
+					"$sum": "$total_weight",
+				},
+				"sold_weight": map[string]interface{}{
+					"$sum": "$sold_weight",
+				},
+				"waste_weight": map[string]interface{}{
+					"$sum": "$waste_weight",
+				},
+				// $avg ignores the nulls of unsold items
+				"avg_days_to_sell": map[string]interface{}{
+					"$avg": map[string]interface{}{
+						"$cond": []interface{}{hasSold, daysToSell, nil},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		err = errors.Wrap(err, "Error aggregating inventory - OriginPerformance")
+		log.Println(err)
+		return nil, err
+	}
+
+	perfs := make([]OriginPerformance, len(docs))
+	for i, doc := range docs {
+		key, _ := doc["_id"].(map[string]interface{})
+		perf := OriginPerformance{
+			Origin:        toString(key["origin"]),
+			Lot:           toString(key["lot"]),
+			Items:         toInt64(doc["items"]),
+			ArrivalWeight: toFloat64(doc["arrival_weight"]),
+			SoldWeight:    toFloat64(doc["sold_weight"]),
+			WasteWeight:   toFloat64(doc["waste_weight"]),
+			AvgDaysToSell: toFloat64(doc["avg_days_to_sell"]),
+		}
+		if perf.ArrivalWeight > 0 {
+			perf.SellThrough = perf.SoldWeight / perf.ArrivalWeight
+			perf.WasteRate = perf.WasteWeight / perf.ArrivalWeight
+		}
+		perfs[i] = perf
+	}
+
+	sort.Slice(perfs, func(i, j int) bool {
+		vi := sortValue(perfs[i])
+		vj := sortValue(perfs[j])
+		if vi != vj {
+			return (vi > vj) != params.Ascending
+		}
+		if perfs[i].Origin != perfs[j].Origin {
+			return perfs[i].Origin < perfs[j].Origin
+		}
+		return perfs[i].Lot < perfs[j].Lot
+	})
+	if params.Limit > 0 && len(perfs) > params.Limit {
+		perfs = perfs[:params.Limit]
+	}
+	return perfs, nil
+}
+
+// originSortValue returns the accessor for the value the report is sorted by.
+func originSortValue(sortBy string) (func(OriginPerformance) float64, error) {
+	switch sortBy {
+	case "", "sell_through":
+		return func(p OriginPerformance) float64 { return p.SellThrough }, nil
+	case "waste_rate":
+		return func(p OriginPerformance) float64 { return p.WasteRate }, nil
+	case "arrival_weight":
+		return func(p OriginPerformance) float64 { return p.ArrivalWeight }, nil
+	case "avg_days_to_sell":
+		return func(p OriginPerformance) float64 { return p.AvgDaysToSell }, nil
+	}
+	return nil, errors.Wrapf(ErrInvalidParams, "Unsupported sort_by: %s", sortBy)
+}
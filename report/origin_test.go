@@ -0,0 +1,158 @@
+package report
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+var _ = Describe("Origin performance", func() {
+	It("should reject unsupported groupings and sort-fields", func() {
+		db := &DB{}
+		_, err := db.OriginPerformance(OriginPerformanceParams{GroupBy: "sku"})
+		Expect(errors.Cause(err)).To(Equal(ErrInvalidParams))
+		_, err = db.OriginPerformance(OriginPerformanceParams{SortBy: "revenue"})
+		Expect(errors.Cause(err)).To(Equal(ErrInvalidParams))
+	})
+
+	Describe("in Mongo", func() {
+		var dbInventory *DB
+
+		testDatabase := "rns_report_origin_test"
+		arrived := int64(1539734400)
+		soldAfter := func(days int64) int64 {
+			return arrived + days*secondsPerDay
+		}
+
+		// origins returns the origins of the performances in order.
+		origins := func(perfs []OriginPerformance) []string {
+			o := make([]string, len(perfs))
+			for i, p := range perfs {
+				o[i] = p.Origin
+			}
+			return o
+		}
+		// lots returns the lots of the performances in order.
+		lots := func(perfs []OriginPerformance) []string {
+			l := make([]string, len(perfs))
+			for i, p := range perfs {
+				l[i] = p.Lot
+			}
+			return l
+		}
+
+		BeforeEach(func() {
+			var err error
+			dbInventory, err = GenerateDB(
+				testDBConfig(testDatabase, "agg_inventory"), &Inventory{},
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			insertTestInventory(
+				dbInventory,
+				Inventory{
+					Origin: "Canada", Lot: "A1", TotalWeight: 100,
+					SoldWeight: 80, WasteWeight: 10,
+					DateArrived: arrived, DateSold: soldAfter(2),
+				},
+				Inventory{
+					Origin: "Canada", Lot: "A2", TotalWeight: 100,
+					SoldWeight: 40, WasteWeight: 20,
+					DateArrived: arrived, DateSold: soldAfter(4),
+				},
+				// Unsold, so excluded from the days-to-sell
+				Inventory{
+					Origin: "Canada", Lot: "A2", TotalWeight: 100,
+					DateArrived: arrived,
+				},
+				Inventory{
+					Origin: "Mexico", Lot: "M1", TotalWeight: 200,
+					SoldWeight: 100, WasteWeight: 50,
+					DateArrived: arrived, DateSold: soldAfter(1),
+				},
+				// Ties with Mexico on sell-through, without dates
+				Inventory{
+					Origin: "Chile", Lot: "C1", TotalWeight: 100,
+					SoldWeight: 50,
+				},
+				// Without any weights
+				Inventory{
+					Origin: "Peru", Lot: "P1",
+				},
+			)
+		})
+
+		AfterEach(func() {
+			dropTestDB(testDatabase)
+		})
+
+		It("should report the performance of each origin", func() {
+			perfs, err := dbInventory.OriginPerformance(OriginPerformanceParams{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(origins(perfs)).To(Equal([]string{"Chile", "Mexico", "Canada", "Peru"}))
+
+			Expect(perfs[2]).To(Equal(OriginPerformance{
+				Origin:        "Canada",
+				Items:         3,
+				ArrivalWeight: 300,
+				SoldWeight:    120,
+				WasteWeight:   30,
+				SellThrough:   0.4,
+				WasteRate:     0.1,
+				AvgDaysToSell: 3,
+			}))
+			Expect(perfs[0].AvgDaysToSell).To(BeZero())
+			Expect(perfs[3].Items).To(Equal(int64(1)))
+			Expect(perfs[3].SellThrough).To(BeZero())
+		})
+
+		It("should sort by the requested value in either direction", func() {
+			perfs, err := dbInventory.OriginPerformance(OriginPerformanceParams{
+				Ascending: true,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(origins(perfs)).To(Equal([]string{"Peru", "Canada", "Chile", "Mexico"}))
+
+			perfs, err = dbInventory.OriginPerformance(OriginPerformanceParams{
+				SortBy: "avg_days_to_sell",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(origins(perfs)).To(Equal([]string{"Canada", "Mexico", "Chile", "Peru"}))
+
+			perfs, err = dbInventory.OriginPerformance(OriginPerformanceParams{
+				SortBy: "waste_rate",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(origins(perfs)).To(Equal([]string{"Mexico", "Canada", "Chile", "Peru"}))
+		})
+
+		It("should group by lot, and by origin and lot", func() {
+			perfs, err := dbInventory.OriginPerformance(OriginPerformanceParams{
+				GroupBy: GroupByLot,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lots(perfs)).To(Equal([]string{"A1", "C1", "M1", "A2", "P1"}))
+			Expect(perfs[0].Origin).To(BeEmpty())
+
+			perfs, err = dbInventory.OriginPerformance(OriginPerformanceParams{
+				GroupBy: GroupByOriginLot,
+				Filters: []SearchParam{
+					{Field: "origin", Type: "string", Equal: "Canada"},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lots(perfs)).To(Equal([]string{"A1", "A2"}))
+			Expect(perfs[1].Origin).To(Equal("Canada"))
+			Expect(perfs[1].Items).To(Equal(int64(2)))
+			Expect(perfs[1].AvgDaysToSell).To(Equal(float64(4)))
+		})
+
+		It("should limit the groups", func() {
+			perfs, err := dbInventory.OriginPerformance(OriginPerformanceParams{
+				Limit: 2,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(origins(perfs)).To(Equal([]string{"Chile", "Mexico"}))
+		})
+	})
+})
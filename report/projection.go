@@ -0,0 +1,355 @@
+package report
+
+import (
+	"log"
+
+	"github.com/TerrexTech/uuuid"
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/mongo/updateopt"
+	"github.com/pkg/errors"
+)
+
+// ErrVersionConflict is the cause of errors from writes of events older than
+// the inventory they apply to, such as reordered events. Such writes are
+// not applied. Use errors.Cause to compare errors against it.
+var ErrVersionConflict = errors.New("Version conflict")
+
+// InventoryUpdate is the data of an inventory update-event.
+type InventoryUpdate struct {
+	Filter map[string]interface{} `json:"filter"`
+	Update map[string]interface{} `json:"update"`
+}
+
+// immutableFields cannot be changed by update-events.
+var immutableFields = []string{"_id", "item_id", "aggregate_version"}
+
+// intFields are the integer inventory-fields, which JSON decodes as float64.
+var intFields = []string{
+	"upc", "sku", "date_arrived", "expiry_date", "timestamp",
+	"date_sold", "prod_quantity", "version", "aggregate_version",
+}
+
+// versionCheck is the outcome of comparing an event's aggregate-version with
+// that of the inventory it applies to.
+type versionCheck int
+
+const (
+	// versionApply is for events newer than the inventory
+	versionApply versionCheck = iota
+	// versionDuplicate is for events already applied to the inventory
+	versionDuplicate
+	// versionConflict is for events older than the inventory
+	versionConflict
+)
+
+// checkVersion compares the aggregate-version of an event with the stored
+// aggregate-version of the inventory it applies to.
+func checkVersion(stored, event int64) versionCheck {
+	switch {
+	case event > stored:
+		return versionApply
+	case event == stored:
+		return versionDuplicate
+	}
+	return versionConflict
+}
+
+// InsertInventory applies an inventory insert-event of the aggregate-version
+// to the projection and the rollup. The insert only happens if the item does
+// not exist. Returns false without error if the item was inserted by the same
+// version, such as for redelivered events, and an ErrVersionConflict if the
+// item exists from any other version. The rollup is applied for redelivered
+// events too, completing it if that failed before.
+func (db *DB) InsertInventory(inv *Inventory, version int64) (bool, error) {
+	if inv.ItemID.String() == (uuuid.UUID{}).String() {
+		err := errors.New("Inventory has no item_id - InsertInventory")
+		log.Println(err)
+		return false, err
+	}
+
+	inv.AggregateVersion = version
+	inserted, err := db.insertIfAbsent(inv)
+	if err != nil {
+		err = errors.Wrap(err, "Error inserting inventory - InsertInventory")
+		log.Println(err)
+		return false, err
+	}
+
+	if !inserted {
+		existing, err := db.findInventory(map[string]interface{}{
+			"item_id": inv.ItemID.String(),
+		})
+		if err != nil {
+			err = errors.Wrap(err, "Error fetching existing inventory - InsertInventory")
+			log.Println(err)
+			return false, err
+		}
+		if len(existing) > 0 && existing[0].AggregateVersion == version {
+			err = db.applyRollup(existing[0])
+			if err != nil {
+				return false, errors.Wrap(err, "InsertInventory")
+			}
+			return false, nil
+		}
+		err = errors.Wrapf(
+			ErrVersionConflict,
+			"Inventory %s already exists, cannot insert version %d - InsertInventory",
+			inv.ItemID, version,
+		)
+		log.Println(err)
+		return false, err
+	}
+
+	err = db.applyRollup(inv)
+	if err != nil {
+		return true, errors.Wrap(err, "InsertInventory")
+	}
+	return true, nil
+}
+
+// insertIfAbsent atomically inserts the inventory unless an inventory with
+// its item_id exists. Returns whether it was inserted.
+func (db *DB) insertIfAbsent(inv *Inventory) (bool, error) {
+	invBSON, err := inv.MarshalBSON()
+	if err != nil {
+		return false, errors.Wrap(err, "Error marshalling inventory")
+	}
+	invDoc, err := bson.ReadDocument(invBSON)
+	if err != nil {
+		return false, errors.Wrap(err, "Error reading inventory document")
+	}
+	// The zero-ObjectID is marshalled, which would be the same for every item
+	invDoc.Delete("_id")
+
+	ctx, cancel := db.timeoutContext()
+	defer cancel()
+	result, err := db.collection.Collection().UpdateOne(
+		ctx,
+		map[string]interface{}{
+			"item_id": inv.ItemID.String(),
+		},
+		bson.NewDocument(
+			bson.EC.SubDocument("$setOnInsert", invDoc),
+		),
+		updateopt.Upsert(true),
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.UpsertedID != nil, nil
+}
+
+// UpdateInventory applies an inventory update-event of the aggregate-version
+// to the projection and the rollup. Only inventory from older versions is
+// updated, so redelivered events have no effect on the projection, while the
+// rollup is applied again to complete it. Returns the number of updated
+// items, and an ErrVersionConflict if any matched item is from a newer
+// version.
+func (db *DB) UpdateInventory(u InventoryUpdate, version int64) (int64, error) {
+	if len(u.Filter) == 0 {
+		err := errors.New("Filter is required - UpdateInventory")
+		log.Println(err)
+		return 0, err
+	}
+
+	update := normalizeFields(u.Update)
+	for _, field := range immutableFields {
+		delete(update, field)
+	}
+	if len(update) == 0 {
+		err := errors.New("Update is required - UpdateInventory")
+		log.Println(err)
+		return 0, err
+	}
+	update["aggregate_version"] = version
+
+	filter := normalizeFields(u.Filter)
+	before, applied, conflicts, err := db.findApplicable(filter, version)
+	if err != nil {
+		err = errors.Wrap(err, "Error fetching inventory - UpdateInventory")
+		log.Println(err)
+		return 0, err
+	}
+
+	var updated int64
+	if len(before) > 0 {
+		result, err := db.collection.UpdateMany(olderThan(filter, version), update)
+		if err != nil {
+			err = errors.Wrap(err, "Error updating inventory - UpdateInventory")
+			log.Println(err)
+			return 0, err
+		}
+		updated = result.ModifiedCount
+	}
+
+	// Items updated by earlier deliveries of the event are included, in case
+	// their rollup failed
+	for _, b := range append(before, applied...) {
+		after, err := db.findInventory(map[string]interface{}{
+			"_id": b.ID,
+		})
+		if err != nil {
+			err = errors.Wrap(err, "Error fetching updated inventory - UpdateInventory")
+			log.Println(err)
+			return updated, err
+		}
+		if len(after) == 0 || after[0].AggregateVersion != version {
+			continue
+		}
+		err = db.applyRollup(after[0])
+		if err != nil {
+			return updated, errors.Wrap(err, "UpdateInventory")
+		}
+	}
+
+	if conflicts > 0 {
+		err = errors.Wrapf(
+			ErrVersionConflict,
+			"%d items are newer than version %d - UpdateInventory", conflicts, version,
+		)
+		log.Println(err)
+		return updated, err
+	}
+	return updated, nil
+}
+
+// DeleteInventory applies an inventory delete-event of the aggregate-version
+// to the projection and the rollup. Only inventory from older versions is
+// deleted. The rollup is retracted before deleting, so a redelivered event
+// completes a failed retraction. Returns the number of deleted items, and an
+// ErrVersionConflict if any matched item is from a newer version.
+func (db *DB) DeleteInventory(filter map[string]interface{}, version int64) (int64, error) {
+	if len(filter) == 0 {
+		err := errors.New("Filter is required - DeleteInventory")
+		log.Println(err)
+		return 0, err
+	}
+
+	filter = normalizeFields(filter)
+	before, _, conflicts, err := db.findApplicable(filter, version)
+	if err != nil {
+		err = errors.Wrap(err, "Error fetching inventory - DeleteInventory")
+		log.Println(err)
+		return 0, err
+	}
+
+	var deleted int64
+	if len(before) > 0 {
+		for _, b := range before {
+			err = db.retractRollup(b.ItemID, version)
+			if err != nil {
+				return 0, errors.Wrap(err, "DeleteInventory")
+			}
+		}
+
+		result, err := db.collection.DeleteMany(olderThan(filter, version))
+		if err != nil {
+			err = errors.Wrap(err, "Error deleting inventory - DeleteInventory")
+			log.Println(err)
+			return 0, err
+		}
+		deleted = result.DeletedCount
+	}
+
+	if conflicts > 0 {
+		err = errors.Wrapf(
+			ErrVersionConflict,
+			"%d items are newer than version %d - DeleteInventory", conflicts, version,
+		)
+		log.Println(err)
+		return deleted, err
+	}
+	return deleted, nil
+}
+
+// findApplicable returns the inventory matching the filter that the event of
+// the version applies to, the inventory it was already applied to, and the
+// number of matched items that are newer.
+func (db *DB) findApplicable(
+	filter map[string]interface{},
+	version int64,
+) ([]*Inventory, []*Inventory, int, error) {
+	matched, err := db.findInventory(filter)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	applicable := []*Inventory{}
+	applied := []*Inventory{}
+	conflicts := 0
+	for _, inv := range matched {
+		switch checkVersion(inv.AggregateVersion, version) {
+		case versionApply:
+			applicable = append(applicable, inv)
+		case versionDuplicate:
+			applied = append(applied, inv)
+		case versionConflict:
+			conflicts++
+		}
+	}
+	return applicable, applied, conflicts, nil
+}
+
+// findInventory returns the inventory matching the filter.
+func (db *DB) findInventory(filter map[string]interface{}) ([]*Inventory, error) {
+	findResults, err := db.collection.Find(filter)
+	if err != nil {
+		return nil, err
+	}
+	invs := make([]*Inventory, len(findResults))
+	for i, r := range findResults {
+		invs[i] = r.(*Inventory)
+	}
+	return invs, nil
+}
+
+// applyRollup sets the contribution of the inventory to the rollup, if one
+// is set.
+func (db *DB) applyRollup(inv *Inventory) error {
+	if db.rollup == nil {
+		return nil
+	}
+	return db.rollup.ApplyRollup(inv)
+}
+
+// retractRollup removes the contribution of the deleted item from the
+// rollup, if one is set.
+func (db *DB) retractRollup(itemID uuuid.UUID, version int64) error {
+	if db.rollup == nil {
+		return nil
+	}
+	return db.rollup.RetractRollup(itemID, version)
+}
+
+// olderThan restricts the filter to inventory from aggregate-versions before
+// version, including inventory without an aggregate-version. Writes are
+// conditioned on it, so concurrently applied newer versions are kept.
+func olderThan(filter map[string]interface{}, version int64) map[string]interface{} {
+	return map[string]interface{}{
+		"$and": []interface{}{
+			filter,
+			map[string]interface{}{
+				"aggregate_version": map[string]interface{}{
+					"$not": map[string]interface{}{
+						"$gte": version,
+					},
+				},
+			},
+		},
+	}
+}
+
+// normalizeFields converts the JSON-decoded float64 values of the integer
+// inventory-fields to int64, so they are stored and matched as integers.
+func normalizeFields(fields map[string]interface{}) map[string]interface{} {
+	normalized := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		normalized[k] = v
+	}
+	for _, field := range intFields {
+		if f, ok := normalized[field].(float64); ok {
+			normalized[field] = int64(f)
+		}
+	}
+	return normalized
+}
@@ -0,0 +1,45 @@
+package report
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Inventory projection", func() {
+	It("should store JSON-decoded integer fields as integers", func() {
+		fields := map[string]interface{}{
+			"sku":         float64(12),
+			"date_sold":   float64(1539907200),
+			"sold_weight": 4.5,
+		}
+		normalized := normalizeFields(fields)
+		Expect(normalized["sku"]).To(Equal(int64(12)))
+		Expect(normalized["date_sold"]).To(Equal(int64(1539907200)))
+		Expect(normalized["sold_weight"]).To(Equal(4.5))
+		// The input is left unchanged
+		Expect(fields["sku"]).To(Equal(float64(12)))
+	})
+
+	It("should restrict filters to older aggregate-versions", func() {
+		filter := map[string]interface{}{"sku": int64(12)}
+		Expect(olderThan(filter, 7)).To(Equal(map[string]interface{}{
+			"$and": []interface{}{
+				filter,
+				map[string]interface{}{
+					"aggregate_version": map[string]interface{}{
+						"$not": map[string]interface{}{
+							"$gte": int64(7),
+						},
+					},
+				},
+			},
+		}))
+	})
+
+	It("should classify event-versions against stored versions", func() {
+		Expect(checkVersion(3, 4)).To(Equal(versionApply))
+		Expect(checkVersion(0, 1)).To(Equal(versionApply))
+		Expect(checkVersion(4, 4)).To(Equal(versionDuplicate))
+		Expect(checkVersion(5, 4)).To(Equal(versionConflict))
+	})
+})
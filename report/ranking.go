@@ -0,0 +1,206 @@
+package report
+
+import (
+	"log"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/pkg/errors"
+)
+
+// Metrics by which products can be ranked.
+const (
+	MetricSoldWeight = "sold_weight"
+	MetricRevenue    = "revenue"
+	MetricWasteRatio = "waste_ratio"
+	MetricMargin     = "margin"
+)
+
+// Ranking-directions.
+const (
+	RankTop    = "top"
+	RankBottom = "bottom"
+)
+
+// rankingGroupKeys are the inventory fields products can be grouped by.
+var rankingGroupKeys = map[string]bool{
+	"sku":    true,
+	"name":   true,
+	"origin": true,
+	"lot":    true,
+}
+
+// RankingParams configures the Top-N/Bottom-N ranking report.
+type RankingParams struct {
+	// Metric to rank by. Defaults to MetricRevenue.
+	// MetricMargin is the share of list-price revenue realized after
+	// markdowns, since item-costs are not tracked.
+	Metric string `json:"metric,omitempty"`
+	// N is the number of ranked groups returned. Defaults to 10.
+	N int `json:"n,omitempty"`
+	// Direction is either RankTop (default) or RankBottom.
+	Direction string `json:"direction,omitempty"`
+	// GroupBy is one of "sku" (default), "name", "origin" or "lot".
+	GroupBy string `json:"group_by,omitempty"`
+	// Filters restrict the inventory being ranked.
+	Filters []SearchParam `json:"filters,omitempty"`
+}
+
+// Ranking is a ranked group of inventory.
+type Ranking struct {
+	Rank int `json:"rank" proto:"1"`
+	// Key is the value of the GroupBy field for this group.
+	Key         interface{} `json:"key" proto:"2"`
+	Name        string      `json:"name,omitempty" proto:"3"`
+	Value       float64     `json:"value" proto:"4"`
+	TotalWeight float64     `json:"total_weight" proto:"5"`
+	SoldWeight  float64     `json:"sold_weight" proto:"6"`
+	WasteWeight float64     `json:"waste_weight" proto:"7"`
+	Revenue     float64     `json:"revenue" proto:"8"`
+	ListRevenue float64     `json:"list_revenue" proto:"9"`
+}
+
+// rankingMetricExprs are the aggregation-expressions computing each metric
+// from the grouped totals.
+var rankingMetricExprs = map[string]interface{}{
+	MetricSoldWeight: "$sold_weight",
+	MetricRevenue:    "$revenue",
+	MetricWasteRatio: ratioExpr("$waste_weight", "$total_weight"),
+	MetricMargin:     ratioExpr("$revenue", "$list_revenue"),
+}
+
+// ratioExpr divides numerator by denominator, yielding 0 if the
+// denominator is not positive.
+func ratioExpr(numerator, denominator string) map[string]interface{} {
+	return map[string]interface{}{
+		"$cond": []interface{}{
+			map[string]interface{}{
+				"$gt": []interface{}{denominator, 0},
+			},
+			map[string]interface{}{
+				"$divide": []interface{}{numerator, denominator},
+			},
+			0,
+		},
+	}
+}
+
+// Rankings ranks the inventory, grouped by the configured key, by the
+// requested metric. The ranking is evaluated in Mongo.
+func (db *DB) Rankings(params RankingParams) ([]Ranking, error) {
+	if params.Metric == "" {
+		params.Metric = MetricRevenue
+	}
+	if params.N <= 0 {
+		params.N = 10
+	}
+	if params.GroupBy == "" {
+		params.GroupBy = "sku"
+	}
+
+	metricExpr, exists := rankingMetricExprs[params.Metric]
+	if !exists {
+		err := errors.Wrapf(ErrInvalidParams, "Unknown metric: %s - Rankings", params.Metric)
+		log.Println(err)
+		return nil, err
+	}
+	if !rankingGroupKeys[params.GroupBy] {
+		err := errors.Wrapf(ErrInvalidParams, "Unsupported group_by: %s - Rankings", params.GroupBy)
+		log.Println(err)
+		return nil, err
+	}
+
+	var sortOrder int32
+	switch params.Direction {
+	case "", RankTop:
+		sortOrder = -1
+	case RankBottom:
+		sortOrder = 1
+	default:
+		err := errors.Wrapf(ErrInvalidParams, "Unknown direction: %s - Rankings", params.Direction)
+		log.Println(err)
+		return nil, err
+	}
+
+	match, err := db.searchFilter(params.Filters)
+	if err != nil {
+		err = errors.Wrap(err, "Error building search-filter - Rankings")
+		log.Println(err)
+		return nil, err
+	}
+
+	pipeline := []interface{}{
+		map[string]interface{}{
+			"$match": match,
+		},
+		map[string]interface{}{
+			"$group": map[string]interface{}{
+				"_id": "$" + params.GroupBy,
+				"name": map[string]interface{}{
+					"$first": "$name",
+				},
+				"total_weight": map[string]interface{}{
+					"$sum": "$total_weight",
+				},
+				"sold_weight": map[string]interface{}{
+					"$sum": "$sold_weight",
+				},
+				"waste_weight": map[string]interface{}{
+					"$sum": "$waste_weight",
+				},
+				"revenue": map[string]interface{}{
+					"$sum": revenueExpr,
+				},
+				"list_revenue": map[string]interface{}{
+					"$sum": map[string]interface{}{
+						"$multiply": []interface{}{"$sold_weight", "$price"},
+					},
+				},
+			},
+		},
+		map[string]interface{}{
+			"$addFields": map[string]interface{}{
+				"value": metricExpr,
+			},
+		},
+		map[string]interface{}{
+			// Ties are broken by group-key, so the ranking is stable
+			"$sort": bson.NewDocument(
+				bson.EC.Int32("value", sortOrder),
+				bson.EC.Int32("_id", 1),
+			),
+		},
+		map[string]interface{}{
+			"$limit": params.N,
+		},
+	}
+
+	docs, err := db.aggregate(pipeline)
+	if err != nil {
+		err = errors.Wrap(err, "Error aggregating rankings - Rankings")
+		log.Println(err)
+		return nil, err
+	}
+
+	rankings := make([]Ranking, len(docs))
+	for i, doc := range docs {
+		var key interface{}
+		if params.GroupBy == "sku" {
+			key = toInt64(doc["_id"])
+		} else {
+			key = toString(doc["_id"])
+		}
+
+		rankings[i] = Ranking{
+			Rank:        i + 1,
+			Key:         key,
+			Name:        toString(doc["name"]),
+			Value:       toFloat64(doc["value"]),
+			TotalWeight: toFloat64(doc["total_weight"]),
+			SoldWeight:  toFloat64(doc["sold_weight"]),
+			WasteWeight: toFloat64(doc["waste_weight"]),
+			Revenue:     toFloat64(doc["revenue"]),
+			ListRevenue: toFloat64(doc["list_revenue"]),
+		}
+	}
+	return rankings, nil
+}
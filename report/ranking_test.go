@@ -0,0 +1,145 @@
+package report
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+var _ = Describe("Rankings", func() {
+	It("should reject unknown metrics, groupings and directions", func() {
+		db := &DB{}
+		_, err := db.Rankings(RankingParams{Metric: "profit"})
+		Expect(errors.Cause(err)).To(Equal(ErrInvalidParams))
+		_, err = db.Rankings(RankingParams{GroupBy: "device_id"})
+		Expect(errors.Cause(err)).To(Equal(ErrInvalidParams))
+		_, err = db.Rankings(RankingParams{Direction: "middle"})
+		Expect(errors.Cause(err)).To(Equal(ErrInvalidParams))
+	})
+
+	Describe("in Mongo", func() {
+		var dbInventory *DB
+
+		testDatabase := "rns_report_ranking_test"
+		canada := []SearchParam{
+			{Field: "origin", Type: "string", Equal: "Canada"},
+		}
+
+		BeforeEach(func() {
+			var err error
+			dbInventory, err = GenerateDB(
+				testDBConfig(testDatabase, "agg_inventory"), &Inventory{},
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			insertTestInventory(
+				dbInventory,
+				// Two lots of apples, one sold at a discount
+				Inventory{
+					SKU: 1, Name: "apple", Origin: "Canada",
+					TotalWeight: 100, SoldWeight: 50, WasteWeight: 10, Price: 2,
+				},
+				Inventory{
+					SKU: 1, Name: "apple", Origin: "Canada",
+					TotalWeight: 100, SoldWeight: 30, Price: 2, SalePrice: 1,
+				},
+				// Ties with the apples on revenue
+				Inventory{
+					SKU: 2, Name: "pear", Origin: "Canada",
+					TotalWeight: 100, SoldWeight: 65, Price: 2,
+				},
+				// Nothing sold
+				Inventory{
+					SKU: 3, Name: "plum", Origin: "Canada",
+					TotalWeight: 50, WasteWeight: 20, Price: 3,
+				},
+				Inventory{
+					SKU: 4, Name: "kiwi", Origin: "Mexico",
+					TotalWeight: 100, SoldWeight: 100, Price: 5,
+				},
+			)
+		})
+
+		AfterEach(func() {
+			dropTestDB(testDatabase)
+		})
+
+		It("should rank the filtered inventory, breaking ties by key", func() {
+			rankings, err := dbInventory.Rankings(RankingParams{
+				Filters: canada,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rankings).To(HaveLen(3))
+
+			Expect(rankings[0]).To(Equal(Ranking{
+				Rank:        1,
+				Key:         int64(1),
+				Name:        "apple",
+				Value:       130,
+				TotalWeight: 200,
+				SoldWeight:  80,
+				WasteWeight: 10,
+				Revenue:     130,
+				ListRevenue: 160,
+			}))
+			Expect(rankings[1].Key).To(Equal(int64(2)))
+			Expect(rankings[1].Value).To(Equal(float64(130)))
+			Expect(rankings[2].Key).To(Equal(int64(3)))
+			Expect(rankings[2].Rank).To(Equal(3))
+			Expect(rankings[2].Revenue).To(BeZero())
+		})
+
+		It("should limit the ranking to N groups in either direction", func() {
+			rankings, err := dbInventory.Rankings(RankingParams{
+				N: 1,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rankings).To(HaveLen(1))
+			Expect(rankings[0].Key).To(Equal(int64(4)))
+			Expect(rankings[0].Revenue).To(Equal(float64(500)))
+
+			rankings, err = dbInventory.Rankings(RankingParams{
+				N:         2,
+				Direction: RankBottom,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rankings).To(HaveLen(2))
+			Expect(rankings[0].Key).To(Equal(int64(3)))
+			Expect(rankings[1].Key).To(Equal(int64(1)))
+		})
+
+		It("should rank by ratios without dividing by zero", func() {
+			rankings, err := dbInventory.Rankings(RankingParams{
+				Metric:  MetricWasteRatio,
+				Filters: canada,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rankings[0].Key).To(Equal(int64(3)))
+			Expect(rankings[0].Value).To(Equal(0.4))
+
+			// The plum has no list-revenue, since nothing sold
+			rankings, err = dbInventory.Rankings(RankingParams{
+				Metric:    MetricMargin,
+				Direction: RankBottom,
+				Filters:   canada,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rankings[0].Key).To(Equal(int64(3)))
+			Expect(rankings[0].Value).To(BeZero())
+			Expect(rankings[1].Key).To(Equal(int64(1)))
+			Expect(rankings[1].Value).To(Equal(130.0 / 160))
+		})
+
+		It("should rank groups of other fields", func() {
+			rankings, err := dbInventory.Rankings(RankingParams{
+				Metric:  MetricSoldWeight,
+				GroupBy: "origin",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rankings).To(HaveLen(2))
+			Expect(rankings[0].Key).To(Equal("Canada"))
+			Expect(rankings[0].SoldWeight).To(Equal(float64(145)))
+			Expect(rankings[1].Key).To(Equal("Mexico"))
+		})
+	})
+})
@@ -0,0 +1,484 @@
+package report
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/TerrexTech/go-mongoutils/mongo"
+	"github.com/TerrexTech/uuuid"
+	"github.com/mongodb/mongo-go-driver/mongo/updateopt"
+	"github.com/pkg/errors"
+)
+
+// RollupCollection is the default collection of the daily sales-rollup.
+const RollupCollection = "agg_productsold_daily"
+
+// rollupZone is the time-zone of the rollup-days. Report-periods are resolved
+// in the same zone, so whole-day periods are served from the rollup
+// regardless of the server's zone.
+var rollupZone = time.UTC
+
+// DailySold is the sales-rollup of an SKU for a tenant and day (rollupZone).
+// It is keyed by (rs_customer_id, sku, day), and only covers sold inventory,
+// with waste and donations counted on the day the inventory sold.
+type DailySold struct {
+	RsCustomerID string `bson:"rs_customer_id" json:"rs_customer_id"`
+	SKU          int64  `bson:"sku" json:"sku"`
+	// Day is the Unix timestamp of the start of the day.
+	Day          int64   `bson:"day" json:"day"`
+	Name         string  `bson:"name,omitempty" json:"name,omitempty"`
+	SoldWeight   float64 `bson:"sold_weight" json:"sold_weight"`
+	WasteWeight  float64 `bson:"waste_weight" json:"waste_weight"`
+	DonateWeight float64 `bson:"donate_weight" json:"donate_weight"`
+	Revenue      float64 `bson:"revenue" json:"revenue"`
+	// Count is the number of inventory-items sold.
+	Count int64 `bson:"count" json:"count"`
+	// Items are the contributions of each inventory-item to the totals.
+	Items []RollupItem `bson:"items,omitempty" json:"items,omitempty"`
+}
+
+// RollupItem is the contribution of an inventory-item to a DailySold, as of
+// the aggregate-version of the item.
+type RollupItem struct {
+	ItemID       string  `bson:"item_id" json:"item_id"`
+	Version      int64   `bson:"version" json:"version"`
+	SoldWeight   float64 `bson:"sold_weight" json:"sold_weight"`
+	WasteWeight  float64 `bson:"waste_weight" json:"waste_weight"`
+	DonateWeight float64 `bson:"donate_weight" json:"donate_weight"`
+	Revenue      float64 `bson:"revenue" json:"revenue"`
+}
+
+// item returns the contribution of the item, or nil if it has none.
+func (d *DailySold) item(itemID string) *RollupItem {
+	for i := range d.Items {
+		if d.Items[i].ItemID == itemID {
+			return &d.Items[i]
+		}
+	}
+	return nil
+}
+
+// doc converts the RollupItem to a document for updates.
+func (ri *RollupItem) doc() map[string]interface{} {
+	return map[string]interface{}{
+		"item_id":       ri.ItemID,
+		"version":       ri.Version,
+		"sold_weight":   ri.SoldWeight,
+		"waste_weight":  ri.WasteWeight,
+		"donate_weight": ri.DonateWeight,
+		"revenue":       ri.Revenue,
+	}
+}
+
+// RollupIndexes are the indexes of the rollup-collection. The unique key
+// keeps concurrent upserts of a (tenant, sku, day) from duplicating it, and
+// the item-index finds the contributions of an item.
+var RollupIndexes = []mongo.IndexConfig{
+	mongo.IndexConfig{
+		ColumnConfig: []mongo.IndexColumnConfig{
+			mongo.IndexColumnConfig{Name: "rs_customer_id"},
+			mongo.IndexColumnConfig{Name: "sku"},
+			mongo.IndexColumnConfig{Name: "day"},
+		},
+		IsUnique: true,
+		Name:     "rollup_key_index",
+	},
+	mongo.IndexConfig{
+		ColumnConfig: []mongo.IndexColumnConfig{
+			mongo.IndexColumnConfig{Name: "items.item_id"},
+		},
+		Name: "rollup_item_index",
+	},
+}
+
+// rollupFields are the inventory-fields also present in the rollup, so
+// filters on only these can be served from it.
+var rollupFields = map[string]bool{
+	"rs_customer_id": true,
+	"sku":            true,
+	"name":           true,
+}
+
+// rollupKey identifies a rollup-document.
+type rollupKey struct {
+	tenant string
+	sku    int64
+	day    int64
+}
+
+// UseRollup makes the reports read from the rollup when their filters and
+// granularity allow it. The rollup must be kept current using ApplyRollup
+// and RetractRollup, else reports will read stale data.
+func (db *DB) UseRollup(rollup *DB) {
+	db.rollup = rollup
+}
+
+// ApplyRollup sets the contribution of the inventory-item to the rollup, as
+// of its aggregate-version. The contribution of an older version is replaced,
+// or moved if the rollup-key of the item changed, and removed if the item is
+// no longer sold. The contribution of the same or a newer version is kept,
+// so ApplyRollup can be retried, such as for redelivered events.
+// The rollup must be the receiver, as created with RollupCollection.
+func (db *DB) ApplyRollup(inv *Inventory) error {
+	var target *rollupKey
+	key, item, sold := rollupContribution(inv)
+	if sold {
+		target = &key
+	}
+
+	err := db.setRollupItem(inv.ItemID.String(), inv.AggregateVersion, target, item, inv.Name)
+	if err != nil {
+		err = errors.Wrap(err, "Error updating rollup - ApplyRollup")
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// RetractRollup removes the contribution of the inventory-item from the
+// rollup, for its deletion by the aggregate-version. Like ApplyRollup, it
+// can be retried.
+func (db *DB) RetractRollup(itemID uuuid.UUID, version int64) error {
+	err := db.setRollupItem(itemID.String(), version, nil, RollupItem{}, "")
+	if err != nil {
+		err = errors.Wrap(err, "Error updating rollup - RetractRollup")
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// rollupContribution returns the rollup-key and contribution of the
+// inventory, and false if it is unsold, and so not part of the rollup.
+func rollupContribution(inv *Inventory) (rollupKey, RollupItem, bool) {
+	if inv.DateSold <= 0 {
+		return rollupKey{}, RollupItem{}, false
+	}
+
+	key := rollupKey{
+		tenant: tenantOf(inv),
+		sku:    inv.SKU,
+		day:    rollupDay(inv.DateSold),
+	}
+	return key, RollupItem{
+		ItemID:       inv.ItemID.String(),
+		Version:      inv.AggregateVersion,
+		SoldWeight:   inv.SoldWeight,
+		WasteWeight:  inv.WasteWeight,
+		DonateWeight: inv.DonateWeight,
+		Revenue:      inv.Revenue(),
+	}, true
+}
+
+// rollupDay returns the start of the rollup-day of the Unix timestamp.
+func rollupDay(timestamp int64) int64 {
+	return startOfDay(time.Unix(timestamp, 0).In(rollupZone)).Unix()
+}
+
+// tenantOf returns the tenant of the inventory as stored by MarshalBSON,
+// which is empty for a missing rs_customer_id.
+func tenantOf(inv *Inventory) string {
+	if inv.RsCustomerID.String() == (uuuid.UUID{}).String() {
+		return ""
+	}
+	return inv.RsCustomerID.String()
+}
+
+// setRollupItem sets the contribution of the item of the version to item
+// under the target-key, removing it from any other keys. A nil target only
+// removes it. Nothing is changed if a contribution of the same or a newer
+// version exists. Contributions under other keys are removed first, so a
+// failure midway is completed by a retry.
+func (db *DB) setRollupItem(
+	itemID string,
+	version int64,
+	target *rollupKey,
+	item RollupItem,
+	name string,
+) error {
+	results, err := db.collection.Find(map[string]interface{}{
+		"items.item_id": itemID,
+	})
+	if err != nil {
+		return errors.Wrap(err, "Error fetching rollup of item")
+	}
+
+	type keyedItem struct {
+		key  rollupKey
+		item *RollupItem
+	}
+	stored := []keyedItem{}
+	for _, r := range results {
+		doc := r.(*DailySold)
+		ri := doc.item(itemID)
+		if ri == nil {
+			continue
+		}
+		if ri.Version >= version {
+			return nil
+		}
+		stored = append(stored, keyedItem{
+			key:  rollupKey{tenant: doc.RsCustomerID, sku: doc.SKU, day: doc.Day},
+			item: ri,
+		})
+	}
+
+	var current *RollupItem
+	for _, s := range stored {
+		if target != nil && s.key == *target {
+			current = s.item
+			continue
+		}
+		err = db.updateRollupItem(s.key, s.item, nil, "")
+		if err != nil {
+			return err
+		}
+	}
+	if target == nil {
+		return nil
+	}
+	return db.updateRollupItem(*target, current, &item, name)
+}
+
+// updateRollupItem replaces the contribution prev with next in the
+// rollup-document of key. Either may be nil, for adding and removing
+// contributions respectively.
+func (db *DB) updateRollupItem(key rollupKey, prev, next *RollupItem, name string) error {
+	filter, update := rollupItemUpdate(key, prev, next, name)
+
+	ctx, cancel := db.timeoutContext()
+	defer cancel()
+	result, err := db.collection.Collection().UpdateOne(
+		ctx,
+		filter,
+		update,
+		// Only new contributions can create rollup-documents
+		updateopt.Upsert(prev == nil),
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 && result.UpsertedID == nil {
+		return errors.Errorf(
+			"Contribution of item %s changed concurrently", contributionID(prev, next),
+		)
+	}
+	return nil
+}
+
+// rollupItemUpdate returns the filter and update replacing the contribution
+// prev with next in the rollup-document of key. The filter only matches if the
+// document has the contribution prev, or has none if prev is nil.
+func rollupItemUpdate(
+	key rollupKey,
+	prev *RollupItem,
+	next *RollupItem,
+	name string,
+) (map[string]interface{}, map[string]interface{}) {
+	filter := map[string]interface{}{
+		"rs_customer_id": key.tenant,
+		"sku":            key.sku,
+		"day":            key.day,
+	}
+	if prev != nil {
+		filter["items"] = map[string]interface{}{
+			"$elemMatch": map[string]interface{}{
+				"item_id": prev.ItemID,
+				"version": prev.Version,
+			},
+		}
+	} else {
+		filter["items.item_id"] = map[string]interface{}{
+			"$ne": next.ItemID,
+		}
+	}
+
+	var delta RollupItem
+	var count int64
+	if next != nil {
+		delta = *next
+		count++
+	}
+	if prev != nil {
+		delta.SoldWeight -= prev.SoldWeight
+		delta.WasteWeight -= prev.WasteWeight
+		delta.DonateWeight -= prev.DonateWeight
+		delta.Revenue -= prev.Revenue
+		count--
+	}
+
+	set := map[string]interface{}{}
+	update := map[string]interface{}{
+		"$inc": map[string]interface{}{
+			"sold_weight":   delta.SoldWeight,
+			"waste_weight":  delta.WasteWeight,
+			"donate_weight": delta.DonateWeight,
+			"revenue":       delta.Revenue,
+			"count":         count,
+		},
+	}
+	switch {
+	case prev == nil:
+		update["$push"] = map[string]interface{}{
+			"items": next.doc(),
+		}
+	case next == nil:
+		update["$pull"] = map[string]interface{}{
+			"items": map[string]interface{}{
+				"item_id": prev.ItemID,
+			},
+		}
+	default:
+		set["items.$"] = next.doc()
+	}
+	if name != "" {
+		set["name"] = name
+	}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	return filter, update
+}
+
+// contributionID returns the ItemID of either contribution.
+func contributionID(prev, next *RollupItem) string {
+	if prev != nil {
+		return prev.ItemID
+	}
+	return next.ItemID
+}
+
+// RebuildRollup recomputes the whole rollup from the inventory, such as for
+// backfills. The rollup is replaced atomically once the rebuild completes,
+// keeping its indexes. Changes applied to the rollup during the rebuild
+// are lost, so event-processing should be paused while rebuilding.
+func (db *DB) RebuildRollup() error {
+	if db.rollup == nil {
+		err := errors.New("No rollup set, see UseRollup - RebuildRollup")
+		log.Println(err)
+		return err
+	}
+
+	_, err := db.aggregate([]interface{}{
+		map[string]interface{}{
+			"$match": map[string]interface{}{
+				"date_sold": map[string]int64{
+					"$gt": 0,
+				},
+			},
+		},
+		map[string]interface{}{
+			"$group": map[string]interface{}{
+				"_id": map[string]interface{}{
+					"rs_customer_id": map[string]interface{}{
+						"$ifNull": []interface{}{"$rs_customer_id", ""},
+					},
+					"sku": "$sku",
+					// The start of the UTC-day, as rollupZone is UTC
+					"day": map[string]interface{}{
+						"$subtract": []interface{}{
+							"$date_sold",
+							map[string]interface{}{
+								"$mod": []interface{}{"$date_sold", secondsPerDay},
+							},
+						},
+					},
+				},
+				"name": map[string]interface{}{
+					"$last": "$name",
+				},
+				"sold_weight": map[string]interface{}{
+					"$sum": "$sold_weight",
+				},
+				"waste_weight": map[string]interface{}{
+					"$sum": "$waste_weight",
+				},
+				"donate_weight": map[string]interface{}{
+					"$sum": "$donate_weight",
+				},
+				"revenue": map[string]interface{}{
+					"$sum": revenueExpr,
+				},
+				"count": map[string]interface{}{
+					"$sum": 1,
+				},
+				"items": map[string]interface{}{
+					"$push": map[string]interface{}{
+						"item_id":       "$item_id",
+						"version":       ifNullZero("$aggregate_version"),
+						"sold_weight":   ifNullZero("$sold_weight"),
+						"waste_weight":  ifNullZero("$waste_weight"),
+						"donate_weight": ifNullZero("$donate_weight"),
+						"revenue": map[string]interface{}{
+							"$ifNull": []interface{}{revenueExpr, 0},
+						},
+					},
+				},
+			},
+		},
+		map[string]interface{}{
+			"$project": map[string]interface{}{
+				"_id":            0,
+				"rs_customer_id": "$_id.rs_customer_id",
+				"sku":            "$_id.sku",
+				"day":            "$_id.day",
+				"name":           1,
+				"sold_weight":    1,
+				"waste_weight":   1,
+				"donate_weight":  1,
+				"revenue":        1,
+				"count":          1,
+				"items":          1,
+			},
+		},
+		map[string]interface{}{
+			"$out": db.rollup.collection.Name,
+		},
+	})
+	if err != nil {
+		err = errors.Wrap(err, "Error rebuilding rollup - RebuildRollup")
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// rollupServes returns whether the rollup can serve a report over the period
+// with the filters. This requires a period aligned to rollup-days, and only
+// filters on fields present in the rollup.
+func (db *DB) rollupServes(filters []SearchParam, p Period) bool {
+	if db.rollup == nil {
+		return false
+	}
+	if rollupDay(p.Start) != p.Start || rollupDay(p.End) != p.End {
+		return false
+	}
+	for _, f := range filters {
+		if !rollupFields[f.Field] {
+			return false
+		}
+	}
+	return true
+}
+
+// rollupMatch builds the $match of a rollup-aggregation over the period.
+func (db *DB) rollupMatch(filters []SearchParam, p Period) (map[string]interface{}, error) {
+	match, err := db.searchFilter(filters)
+	if err != nil {
+		return nil, err
+	}
+	match["day"] = map[string]int64{
+		"$gte": p.Start,
+		"$lt":  p.End,
+	}
+	return match, nil
+}
+
+// timeoutContext returns a context bound by the collection's timeout.
+func (db *DB) timeoutContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(
+		context.Background(),
+		time.Duration(db.collection.Connection.Timeout)*time.Millisecond,
+	)
+}
@@ -0,0 +1,140 @@
+package report
+
+import (
+	"time"
+
+	"github.com/TerrexTech/uuuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Daily rollup", func() {
+	var (
+		inv    *Inventory
+		tenant uuuid.UUID
+	)
+
+	BeforeEach(func() {
+		var err error
+		tenant, err = uuuid.NewV4()
+		Expect(err).ToNot(HaveOccurred())
+
+		inv = &Inventory{
+			SKU:          12,
+			Name:         "Banana",
+			Price:        2,
+			SalePrice:    1.5,
+			SoldWeight:   10,
+			WasteWeight:  1,
+			DateSold:     1539907200 + 3600,
+			RsCustomerID: tenant,
+		}
+	})
+
+	It("should key the contribution of sold inventory by tenant, SKU and day", func() {
+		inv.AggregateVersion = 3
+		key, item, sold := rollupContribution(inv)
+		Expect(sold).To(BeTrue())
+		Expect(key).To(Equal(rollupKey{tenant: tenant.String(), sku: 12, day: 1539907200}))
+		Expect(item.ItemID).To(Equal(inv.ItemID.String()))
+		Expect(item.Version).To(Equal(int64(3)))
+		Expect(item.SoldWeight).To(Equal(10.0))
+		Expect(item.WasteWeight).To(Equal(1.0))
+		Expect(item.Revenue).To(Equal(15.0))
+	})
+
+	It("should not contribute unsold inventory", func() {
+		unsold := *inv
+		unsold.DateSold = 0
+		_, _, sold := rollupContribution(&unsold)
+		Expect(sold).To(BeFalse())
+	})
+
+	Describe("item-updates", func() {
+		var (
+			key  rollupKey
+			prev RollupItem
+			next RollupItem
+		)
+
+		BeforeEach(func() {
+			key = rollupKey{tenant: tenant.String(), sku: 12, day: 1539907200}
+			prev = RollupItem{ItemID: "item", Version: 1, SoldWeight: 10, Revenue: 15}
+			next = RollupItem{ItemID: "item", Version: 2, SoldWeight: 14, Revenue: 28}
+		})
+
+		It("should add new contributions to documents without the item", func() {
+			filter, update := rollupItemUpdate(key, nil, &next, "Banana")
+			Expect(filter).To(HaveKeyWithValue("day", int64(1539907200)))
+			Expect(filter).To(HaveKeyWithValue("items.item_id", map[string]interface{}{
+				"$ne": "item",
+			}))
+
+			inc := update["$inc"].(map[string]interface{})
+			Expect(inc["sold_weight"]).To(Equal(14.0))
+			Expect(inc["count"]).To(Equal(int64(1)))
+			Expect(update["$push"]).To(Equal(map[string]interface{}{
+				"items": next.doc(),
+			}))
+			Expect(update["$set"]).To(Equal(map[string]interface{}{
+				"name": "Banana",
+			}))
+		})
+
+		It("should replace only the stored version of contributions", func() {
+			filter, update := rollupItemUpdate(key, &prev, &next, "")
+			Expect(filter["items"]).To(Equal(map[string]interface{}{
+				"$elemMatch": map[string]interface{}{
+					"item_id": "item",
+					"version": int64(1),
+				},
+			}))
+
+			inc := update["$inc"].(map[string]interface{})
+			Expect(inc["sold_weight"]).To(Equal(4.0))
+			Expect(inc["revenue"]).To(Equal(13.0))
+			Expect(inc["count"]).To(BeZero())
+			Expect(update["$set"]).To(Equal(map[string]interface{}{
+				"items.$": next.doc(),
+			}))
+		})
+
+		It("should retract removed contributions", func() {
+			_, update := rollupItemUpdate(key, &prev, nil, "")
+			inc := update["$inc"].(map[string]interface{})
+			Expect(inc["sold_weight"]).To(Equal(-10.0))
+			Expect(inc["revenue"]).To(Equal(-15.0))
+			Expect(inc["count"]).To(Equal(int64(-1)))
+			Expect(update["$pull"]).To(Equal(map[string]interface{}{
+				"items": map[string]interface{}{"item_id": "item"},
+			}))
+			Expect(update).ToNot(HaveKey("$set"))
+		})
+	})
+
+	It("should only be served for day-aligned periods and rollup fields", func() {
+		db := &DB{rollup: &DB{}}
+		day := Period{Start: 1539907200, End: 1539993600}
+		Expect(db.rollupServes([]SearchParam{{Field: "sku"}}, day)).To(BeTrue())
+		Expect(db.rollupServes([]SearchParam{{Field: "origin"}}, day)).To(BeFalse())
+		Expect(db.rollupServes(nil, Period{Start: day.Start + 60, End: day.End})).To(BeFalse())
+		Expect((&DB{}).rollupServes(nil, day)).To(BeFalse())
+	})
+
+	It("should serve whole-day periods resolved on hosts in other zones", func() {
+		toronto := time.FixedZone("EDT", -4*3600)
+		db := &DB{
+			rollup: &DB{},
+			clock: func() time.Time {
+				return time.Date(2018, 10, 17, 22, 0, 0, 0, toronto)
+			},
+		}
+		p, err := db.reportPeriod("yesterday", "", "")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p).To(Equal(Period{
+			Start: time.Date(2018, 10, 17, 0, 0, 0, 0, time.UTC).Unix(),
+			End:   time.Date(2018, 10, 18, 0, 0, 0, 0, time.UTC).Unix(),
+		}))
+		Expect(db.rollupServes(nil, p)).To(BeTrue())
+	})
+})
@@ -0,0 +1,97 @@
+package report
+
+import (
+	"log"
+	"strings"
+
+	"github.com/mongodb/mongo-go-driver/mongo/findopt"
+	"github.com/pkg/errors"
+)
+
+// SearchOptions sorts and limits the results of SearchFlash and
+// SearchMetrics.
+type SearchOptions struct {
+	// SortBy is the field to sort by, in descending order if prefixed
+	// with "-". Results are unsorted if empty.
+	SortBy string
+	// Limit caps the number of results. Zero returns all.
+	Limit int64
+}
+
+// findOptions converts the SearchOptions into Mongo find-options.
+func (o SearchOptions) findOptions() []findopt.Find {
+	opts := []findopt.Find{}
+	if o.SortBy != "" {
+		field, order := o.SortBy, 1
+		if strings.HasPrefix(field, "-") {
+			field, order = field[1:], -1
+		}
+		opts = append(opts, findopt.Sort(map[string]interface{}{
+			field: order,
+		}))
+	}
+	if o.Limit > 0 {
+		opts = append(opts, findopt.Limit(o.Limit))
+	}
+	return opts
+}
+
+// SearchFlash returns the flash-sales matching the SearchParams.
+// Returns an empty slice if none match.
+func (db *DB) SearchFlash(params []SearchParam, opts SearchOptions) ([]Flash, error) {
+	findResults, err := db.search(params, opts)
+	if err != nil {
+		err = errors.Wrap(err, "Error searching flash-sales - SearchFlash")
+		log.Println(err)
+		return nil, err
+	}
+
+	flash := []Flash{}
+	for _, v := range findResults {
+		result, ok := v.(*Flash)
+		if !ok {
+			err = errors.Errorf("Unexpected result-type %T - SearchFlash", v)
+			log.Println(err)
+			return nil, err
+		}
+		flash = append(flash, *result)
+	}
+	return flash, nil
+}
+
+// SearchMetrics returns the sensor-metrics matching the SearchParams.
+// Returns an empty slice if none match.
+func (db *DB) SearchMetrics(params []SearchParam, opts SearchOptions) ([]Metric, error) {
+	findResults, err := db.search(params, opts)
+	if err != nil {
+		err = errors.Wrap(err, "Error searching metrics - SearchMetrics")
+		log.Println(err)
+		return nil, err
+	}
+
+	metrics := []Metric{}
+	for _, v := range findResults {
+		result, ok := v.(*Metric)
+		if !ok {
+			err = errors.Errorf("Unexpected result-type %T - SearchMetrics", v)
+			log.Println(err)
+			return nil, err
+		}
+		metrics = append(metrics, *result)
+	}
+	return metrics, nil
+}
+
+// search finds the documents matching the SearchParams. Errors from
+// malformed SearchParams are caused by ErrInvalidSearchParam.
+func (db *DB) search(params []SearchParam, opts SearchOptions) ([]interface{}, error) {
+	findParams, err := db.searchFilter(params)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error building search-filter")
+	}
+	findResults, err := db.collection.Find(findParams, opts.findOptions()...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error while fetching results")
+	}
+	return findResults, nil
+}
@@ -0,0 +1,46 @@
+package report
+
+import (
+	"github.com/mongodb/mongo-go-driver/mongo/findopt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+var _ = Describe("Search", func() {
+	It("should convert SearchOptions into find-options", func() {
+		Expect(SearchOptions{}.findOptions()).To(BeEmpty())
+
+		opts := SearchOptions{
+			SortBy: "-timestamp",
+			Limit:  5,
+		}.findOptions()
+		Expect(opts).To(Equal([]findopt.Find{
+			findopt.Sort(map[string]interface{}{"timestamp": -1}),
+			findopt.Limit(5),
+		}))
+
+		opts = SearchOptions{SortBy: "sku"}.findOptions()
+		Expect(opts).To(Equal([]findopt.Find{
+			findopt.Sort(map[string]interface{}{"sku": 1}),
+		}))
+	})
+
+	It("should cause errors of malformed SearchParams by ErrInvalidSearchParam", func() {
+		db := &DB{}
+		_, err := db.SearchFlash([]SearchParam{{Field: "sku"}}, SearchOptions{})
+		Expect(errors.Cause(err)).To(Equal(ErrInvalidSearchParam))
+		_, err = db.SearchMetrics([]SearchParam{{Field: "sku"}}, SearchOptions{})
+		Expect(errors.Cause(err)).To(Equal(ErrInvalidSearchParam))
+	})
+
+	It("should compute the revenue at the sale-price if one was set", func() {
+		inv := &Inventory{
+			SoldWeight: 4,
+			Price:      3,
+		}
+		Expect(inv.Revenue()).To(Equal(12.0))
+		inv.SalePrice = 2.5
+		Expect(inv.Revenue()).To(Equal(10.0))
+	})
+})
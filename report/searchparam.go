@@ -1,9 +1,25 @@
 package report
 
+import "github.com/pkg/errors"
+
+// ErrInvalidSearchParam is the cause of errors from malformed SearchParams,
+// such as missing fields or unparsable values. Such errors are not transient.
+// Use errors.Cause to compare errors against it.
+var ErrInvalidSearchParam = errors.New("Invalid SearchParam")
+
 type SearchParam struct {
 	Field      string  `json:"field,omitempty"`
 	Type       string  `json:"type,omitempty"`
 	Equal      string  `json:"equal,omitempty"`
 	UpperLimit float64 `json:"upper_limit,omitempty"`
 	LowerLimit float64 `json:"lower_limit,omitempty"`
+
+	// Range is a relative date-range, such as "last_7_days", "this_month"
+	// or "yesterday". Only valid for time fields.
+	Range string `json:"range,omitempty"`
+	// From and To bound a date-range using ISO-8601 dates or expressions
+	// relative to now, such as "now-30d". A date-only To includes the whole
+	// of that day. Only valid for time fields.
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
 }
@@ -0,0 +1,39 @@
+package report
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+var _ = Describe("SearchParam", func() {
+	It("should cause search-filter errors by ErrInvalidSearchParam", func() {
+		db := &DB{}
+		invalid := [][]SearchParam{
+			{{Field: "sku", Equal: "1"}},
+			{{Type: "int", Equal: "1"}},
+			{{Field: "sku", Type: "int"}},
+			{{Field: "sku", Type: "int", Equal: "one"}},
+			{{Field: "name", Type: "string", Range: "last_7_days"}},
+		}
+		for _, params := range invalid {
+			_, err := db.searchFilter(params)
+			Expect(errors.Cause(err)).To(Equal(ErrInvalidSearchParam), "%+v", params)
+		}
+
+		filter, err := db.searchFilter([]SearchParam{
+			{Field: "sku", Type: "int", Equal: "1"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(filter).To(HaveKey("sku"))
+	})
+
+	It("should ignore SearchParams with unknown types", func() {
+		db := &DB{}
+		filter, err := db.searchFilter([]SearchParam{
+			{Field: "sku", Type: "bool", Equal: "1"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(filter).To(BeEmpty())
+	})
+})
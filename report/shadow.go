@@ -0,0 +1,53 @@
+package report
+
+import (
+	"log"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/pkg/errors"
+)
+
+// ShadowSuffix is appended to a collection's name for the shadow-collection
+// projections are rebuilt into, before being swapped in.
+const ShadowSuffix = "_shadow"
+
+// Drop drops the collection, such as a stale shadow-collection.
+func (db *DB) Drop() error {
+	ctx, cancel := db.timeoutContext()
+	defer cancel()
+
+	err := db.collection.Collection().Drop(ctx)
+	if err != nil {
+		err = errors.Wrapf(err, "Error dropping collection %s - Drop", db.collection.Name)
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// SwapInto atomically replaces the target collection of the same database
+// with this collection, which is renamed to target. The indexes of this
+// collection are kept, and the existing target is dropped.
+func (db *DB) SwapInto(target string) error {
+	database := db.collection.Database
+	cmd := bson.NewDocument(
+		bson.EC.String("renameCollection", database+"."+db.collection.Name),
+		bson.EC.String("to", database+"."+target),
+		bson.EC.Boolean("dropTarget", true),
+	)
+
+	ctx, cancel := db.timeoutContext()
+	defer cancel()
+
+	_, err := db.collection.Connection.Client.
+		Database("admin").
+		RunCommand(ctx, cmd)
+	if err != nil {
+		err = errors.Wrapf(
+			err, "Error renaming %s to %s - SwapInto", db.collection.Name, target,
+		)
+		log.Println(err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package report
+
+import (
+	"log"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// DaysToSellParams configures the days-to-sell distribution report.
+type DaysToSellParams struct {
+	// GroupBy is either "sku" (default) or "origin".
+	GroupBy string `json:"group_by,omitempty"`
+	// BucketDays is the width of each histogram-bucket. Defaults to 1.
+	BucketDays float64 `json:"bucket_days,omitempty"`
+	// Filters restrict the sold inventory being reported.
+	Filters []SearchParam `json:"filters,omitempty"`
+}
+
+// HistogramBucket counts the items that sold in [From, To) days.
+type HistogramBucket struct {
+	From  float64 `json:"from" proto:"1"`
+	To    float64 `json:"to" proto:"2"`
+	Count int     `json:"count" proto:"3"`
+}
+
+// ShelfLifeExceeded is a sold item that took longer to sell than its
+// shelf-life, which is the time from date_arrived to expiry_date.
+type ShelfLifeExceeded struct {
+	ItemID        string  `json:"item_id,omitempty" proto:"1"`
+	Lot           string  `json:"lot,omitempty" proto:"2"`
+	DaysToSell    float64 `json:"days_to_sell" proto:"3"`
+	ShelfLifeDays float64 `json:"shelf_life_days" proto:"4"`
+}
+
+// DaysToSellDistribution is the distribution of days from date_arrived to
+// date_sold of an SKU or origin.
+type DaysToSellDistribution struct {
+	SKU       int64             `json:"sku,omitempty" proto:"1"`
+	Name      string            `json:"name,omitempty" proto:"2"`
+	Origin    string            `json:"origin,omitempty" proto:"3"`
+	Count     int               `json:"count" proto:"4"`
+	Mean      float64           `json:"mean" proto:"5"`
+	P50       float64           `json:"p50" proto:"6"`
+	P90       float64           `json:"p90" proto:"7"`
+	Max       float64           `json:"max" proto:"8"`
+	Histogram []HistogramBucket `json:"histogram" proto:"9"`
+	// Exceeded lists the items whose days-to-sell exceeded their shelf-life.
+	Exceeded []ShelfLifeExceeded `json:"exceeded,omitempty" proto:"10"`
+}
+
+// DaysToSell reports the histogram and percentiles of the days-to-sell of
+// sold inventory, per SKU or origin. Items that took longer to sell than
+// their shelf-life are flagged.
+func (db *DB) DaysToSell(params DaysToSellParams) ([]DaysToSellDistribution, error) {
+	if params.BucketDays <= 0 {
+		params.BucketDays = 1
+	}
+	if params.GroupBy == "" {
+		params.GroupBy = "sku"
+	}
+	if params.GroupBy != "sku" && params.GroupBy != "origin" {
+		err := errors.Wrapf(ErrInvalidParams, "Unsupported group_by: %s - DaysToSell", params.GroupBy)
+		log.Println(err)
+		return nil, err
+	}
+
+	findParams, err := db.searchFilter(params.Filters)
+	if err != nil {
+		err = errors.Wrap(err, "Error building search-filter - DaysToSell")
+		log.Println(err)
+		return nil, err
+	}
+	// Only sold items with a known arrival have a days-to-sell
+	for _, field := range []string{"date_sold", "date_arrived"} {
+		if _, exists := findParams[field]; !exists {
+			findParams[field] = map[string]int64{
+				"$gt": 0,
+			}
+		}
+	}
+
+	findResults, err := db.collection.Find(findParams)
+	if err != nil {
+		err = errors.Wrap(err, "Error while fetching results from inventory - DaysToSell")
+		log.Println(err)
+		return nil, err
+	}
+
+	groups := map[string]*DaysToSellDistribution{}
+	samples := map[string][]float64{}
+	// Maintains the order of groups
+	groupKeys := []string{}
+
+	for _, r := range findResults {
+		inv := r.(*Inventory)
+		if inv.DateSold < inv.DateArrived {
+			continue
+		}
+
+		var key string
+		if params.GroupBy == "sku" {
+			key = strconv.FormatInt(inv.SKU, 10)
+		} else {
+			key = inv.Origin
+		}
+		group, exists := groups[key]
+		if !exists {
+			group = &DaysToSellDistribution{}
+			if params.GroupBy == "sku" {
+				group.SKU = inv.SKU
+				group.Name = inv.Name
+			} else {
+				group.Origin = inv.Origin
+			}
+			groups[key] = group
+			groupKeys = append(groupKeys, key)
+		}
+
+		days := float64(inv.DateSold-inv.DateArrived) / secondsPerDay
+		samples[key] = append(samples[key], days)
+
+		if inv.ExpiryDate > inv.DateArrived {
+			shelfLife := float64(inv.ExpiryDate-inv.DateArrived) / secondsPerDay
+			if days > shelfLife {
+				group.Exceeded = append(group.Exceeded, ShelfLifeExceeded{
+					ItemID:        inv.ItemID.String(),
+					Lot:           inv.Lot,
+					DaysToSell:    days,
+					ShelfLifeDays: shelfLife,
+				})
+			}
+		}
+	}
+
+	dists := make([]DaysToSellDistribution, len(groupKeys))
+	for i, key := range groupKeys {
+		dist := groups[key]
+		values := samples[key]
+		sort.Float64s(values)
+
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		dist.Count = len(values)
+		dist.Mean = sum / float64(len(values))
+		dist.P50 = percentile(values, 50)
+		dist.P90 = percentile(values, 90)
+		dist.Max = values[len(values)-1]
+		dist.Histogram = histogram(values, params.BucketDays)
+		dists[i] = *dist
+	}
+
+	sort.Slice(dists, func(i, j int) bool {
+		if dists[i].SKU != dists[j].SKU {
+			return dists[i].SKU < dists[j].SKU
+		}
+		return dists[i].Origin < dists[j].Origin
+	})
+	return dists, nil
+}
+
+// percentile returns the p-th percentile of the sorted values, linearly
+// interpolating between the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return sorted[lower]
+	}
+	frac := rank - float64(lower)
+	return sorted[lower] + frac*(sorted[upper]-sorted[lower])
+}
+
+// histogram counts the sorted values into buckets of the given width,
+// starting from 0. Empty buckets between populated ones are included.
+func histogram(sorted []float64, width float64) []HistogramBucket {
+	if len(sorted) == 0 {
+		return []HistogramBucket{}
+	}
+
+	bucketCount := int(sorted[len(sorted)-1]/width) + 1
+	buckets := make([]HistogramBucket, bucketCount)
+	for i := range buckets {
+		buckets[i] = HistogramBucket{
+			From: float64(i) * width,
+			To:   float64(i+1) * width,
+		}
+	}
+	for _, v := range sorted {
+		buckets[int(v/width)].Count++
+	}
+	return buckets
+}
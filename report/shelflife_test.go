@@ -0,0 +1,24 @@
+package report
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Days-to-sell distribution", func() {
+	It("should interpolate percentiles", func() {
+		values := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+		Expect(percentile(values, 50)).To(BeNumerically("~", 5.5))
+		Expect(percentile(values, 90)).To(BeNumerically("~", 9.1))
+		Expect(percentile([]float64{4}, 90)).To(Equal(float64(4)))
+	})
+
+	It("should bucket values into a histogram", func() {
+		buckets := histogram([]float64{0.5, 1, 1.5, 4.2}, 2)
+		Expect(buckets).To(Equal([]HistogramBucket{
+			HistogramBucket{From: 0, To: 2, Count: 3},
+			HistogramBucket{From: 2, To: 4, Count: 0},
+			HistogramBucket{From: 4, To: 6, Count: 1},
+		}))
+	})
+})
@@ -0,0 +1,252 @@
+package report
+
+import (
+	"github.com/TerrexTech/go-commonutils/commonutil"
+	mongo "github.com/TerrexTech/go-mongoutils/mongo"
+	"github.com/TerrexTech/uuuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+var _ = Describe("Versioned inventory writes", func() {
+	var (
+		dbInventory *DB
+		dbRollup    *DB
+		itemID      uuuid.UUID
+		inv         *Inventory
+	)
+
+	testDatabase := "rns_report_versioning_test"
+
+	newConfig := func(collection string) DBIConfig {
+		return DBIConfig{
+			Hosts:               *commonutil.ParseHosts("localhost:27017"),
+			Username:            "root",
+			Password:            "root",
+			TimeoutMilliseconds: 3000,
+			Database:            testDatabase,
+			Collection:          collection,
+		}
+	}
+
+	// rollupOf returns the rollup-documents of the test SKU.
+	rollupOf := func() []*DailySold {
+		results, err := dbRollup.collection.Find(map[string]interface{}{
+			"sku": int64(343434),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		rollups := make([]*DailySold, len(results))
+		for i, r := range results {
+			rollups[i] = r.(*DailySold)
+		}
+		return rollups
+	}
+
+	BeforeEach(func() {
+		var err error
+		dbInventory, err = GenerateDB(newConfig("agg_inventory"), &Inventory{})
+		Expect(err).ToNot(HaveOccurred())
+
+		rollupConfig := newConfig(RollupCollection)
+		rollupConfig.Indexes = RollupIndexes
+		dbRollup, err = GenerateDB(rollupConfig, &DailySold{})
+		Expect(err).ToNot(HaveOccurred())
+		dbInventory.UseRollup(dbRollup)
+
+		itemID, err = uuuid.NewV4()
+		Expect(err).ToNot(HaveOccurred())
+		inv = &Inventory{
+			ItemID:      itemID,
+			SKU:         343434,
+			Name:        "test",
+			TotalWeight: 2000,
+			Price:       100,
+			SoldWeight:  800,
+			DateSold:    86400 + 3600,
+		}
+	})
+
+	AfterEach(func() {
+		client, err := mongo.NewClient(mongo.ClientConfig{
+			Hosts:               *commonutil.ParseHosts("localhost:27017"),
+			Username:            "root",
+			Password:            "root",
+			TimeoutMilliseconds: 3000,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		dbCtx, dbCancel := newTimeoutContext(3000)
+		err = client.Database(testDatabase).Drop(dbCtx)
+		dbCancel()
+		Expect(err).ToNot(HaveOccurred())
+
+		err = client.Disconnect()
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should apply duplicate insert-events once", func() {
+		inserted, err := dbInventory.InsertInventory(inv, 1)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inserted).To(BeTrue())
+
+		dup := *inv
+		inserted, err = dbInventory.InsertInventory(&dup, 1)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inserted).To(BeFalse())
+
+		invs, err := dbInventory.findInventory(map[string]interface{}{
+			"item_id": itemID.String(),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(invs).To(HaveLen(1))
+
+		rollups := rollupOf()
+		Expect(rollups).To(HaveLen(1))
+		Expect(rollups[0].SoldWeight).To(Equal(800.0))
+		Expect(rollups[0].Count).To(Equal(int64(1)))
+	})
+
+	It("should apply duplicate update-events once", func() {
+		_, err := dbInventory.InsertInventory(inv, 1)
+		Expect(err).ToNot(HaveOccurred())
+
+		update := InventoryUpdate{
+			Filter: map[string]interface{}{"item_id": itemID.String()},
+			Update: map[string]interface{}{"sold_weight": 1000.0},
+		}
+		updated, err := dbInventory.UpdateInventory(update, 2)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(updated).To(Equal(int64(1)))
+
+		updated, err = dbInventory.UpdateInventory(update, 2)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(updated).To(BeZero())
+
+		rollups := rollupOf()
+		Expect(rollups).To(HaveLen(1))
+		Expect(rollups[0].SoldWeight).To(Equal(1000.0))
+		Expect(rollups[0].Count).To(Equal(int64(1)))
+	})
+
+	It("should reject reordered update-events with a version conflict", func() {
+		_, err := dbInventory.InsertInventory(inv, 1)
+		Expect(err).ToNot(HaveOccurred())
+
+		filter := map[string]interface{}{"item_id": itemID.String()}
+		_, err = dbInventory.UpdateInventory(InventoryUpdate{
+			Filter: filter,
+			Update: map[string]interface{}{"sold_weight": 1200.0},
+		}, 3)
+		Expect(err).ToNot(HaveOccurred())
+
+		// Version 2 arrives after version 3
+		updated, err := dbInventory.UpdateInventory(InventoryUpdate{
+			Filter: filter,
+			Update: map[string]interface{}{"sold_weight": 1000.0},
+		}, 2)
+		Expect(errors.Cause(err)).To(Equal(ErrVersionConflict))
+		Expect(updated).To(BeZero())
+
+		invs, err := dbInventory.findInventory(filter)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(invs[0].SoldWeight).To(Equal(1200.0))
+		Expect(invs[0].AggregateVersion).To(Equal(int64(3)))
+		Expect(rollupOf()[0].SoldWeight).To(Equal(1200.0))
+	})
+
+	It("should reject inserts of existing items from other versions", func() {
+		_, err := dbInventory.InsertInventory(inv, 2)
+		Expect(err).ToNot(HaveOccurred())
+
+		stale := *inv
+		_, err = dbInventory.InsertInventory(&stale, 1)
+		Expect(errors.Cause(err)).To(Equal(ErrVersionConflict))
+		Expect(rollupOf()[0].Count).To(Equal(int64(1)))
+	})
+
+	It("should reject reordered delete-events with a version conflict", func() {
+		_, err := dbInventory.InsertInventory(inv, 1)
+		Expect(err).ToNot(HaveOccurred())
+		filter := map[string]interface{}{"item_id": itemID.String()}
+		_, err = dbInventory.UpdateInventory(InventoryUpdate{
+			Filter: filter,
+			Update: map[string]interface{}{"sold_weight": 1200.0},
+		}, 3)
+		Expect(err).ToNot(HaveOccurred())
+
+		deleted, err := dbInventory.DeleteInventory(filter, 2)
+		Expect(errors.Cause(err)).To(Equal(ErrVersionConflict))
+		Expect(deleted).To(BeZero())
+
+		deleted, err = dbInventory.DeleteInventory(filter, 4)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(deleted).To(Equal(int64(1)))
+
+		// Redelivered deletes have nothing left to delete
+		deleted, err = dbInventory.DeleteInventory(filter, 4)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(deleted).To(BeZero())
+
+		rollups := rollupOf()
+		Expect(rollups).To(HaveLen(1))
+		Expect(rollups[0].SoldWeight).To(BeZero())
+		Expect(rollups[0].Count).To(BeZero())
+	})
+
+	It("should complete the rollup of redelivered events", func() {
+		// The projection was written, but its rollup failed
+		inv.AggregateVersion = 1
+		_, err := dbInventory.insertIfAbsent(inv)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rollupOf()).To(BeEmpty())
+
+		redelivered := *inv
+		inserted, err := dbInventory.InsertInventory(&redelivered, 1)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inserted).To(BeFalse())
+
+		filter := map[string]interface{}{"item_id": itemID.String()}
+		update := map[string]interface{}{"sold_weight": 1000.0, "aggregate_version": int64(2)}
+		_, err = dbInventory.collection.UpdateMany(filter, update)
+		Expect(err).ToNot(HaveOccurred())
+		updated, err := dbInventory.UpdateInventory(InventoryUpdate{
+			Filter: filter,
+			Update: map[string]interface{}{"sold_weight": 1000.0},
+		}, 2)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(updated).To(BeZero())
+
+		rollups := rollupOf()
+		Expect(rollups).To(HaveLen(1))
+		Expect(rollups[0].SoldWeight).To(Equal(1000.0))
+		Expect(rollups[0].Count).To(Equal(int64(1)))
+		Expect(rollups[0].Items).To(HaveLen(1))
+		Expect(rollups[0].Items[0].Version).To(Equal(int64(2)))
+	})
+
+	It("should move contributions between days once", func() {
+		_, err := dbInventory.InsertInventory(inv, 1)
+		Expect(err).ToNot(HaveOccurred())
+
+		update := InventoryUpdate{
+			Filter: map[string]interface{}{"item_id": itemID.String()},
+			Update: map[string]interface{}{"date_sold": float64(inv.DateSold + secondsPerDay)},
+		}
+		for i := 0; i < 2; i++ {
+			_, err = dbInventory.UpdateInventory(update, 2)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		days := map[int64]*DailySold{}
+		for _, r := range rollupOf() {
+			days[r.Day] = r
+		}
+		Expect(days).To(HaveLen(2))
+		Expect(days[86400].Count).To(BeZero())
+		Expect(days[86400].SoldWeight).To(BeZero())
+		Expect(days[86400].Items).To(BeEmpty())
+		Expect(days[2*86400].Count).To(Equal(int64(1)))
+		Expect(days[2*86400].SoldWeight).To(Equal(800.0))
+	})
+})
@@ -0,0 +1,188 @@
+// Package schedule parses cron-expressions and computes their activations.
+package schedule
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Cron is a parsed standard 5-field cron-expression:
+// minute, hour, day-of-month, month and day-of-week.
+// Each field accepts "*", values, ranges ("1-5"), steps ("*/15", "0-30/10")
+// and comma-separated lists of these. Day-of-week is 0-7, where both
+// 0 and 7 are Sunday.
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+	// As in standard cron, if both day-of-month and day-of-week are
+	// restricted, a day matching either of them matches.
+	domRestricted, dowRestricted bool
+}
+
+// bounds are the inclusive value-bounds of a cron-field.
+type bounds struct {
+	name     string
+	min, max int
+}
+
+var fieldBounds = []bounds{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day-of-month", 1, 31},
+	{"month", 1, 12},
+	{"day-of-week", 0, 7},
+}
+
+// shorthands are the supported predefined schedules.
+var shorthands = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+// Parse parses a 5-field cron-expression, or one of the shorthands
+// @hourly, @daily, @midnight, @weekly, @monthly, @yearly and @annually.
+func Parse(expr string) (*Cron, error) {
+	expr = strings.TrimSpace(expr)
+	if full, exists := shorthands[expr]; exists {
+		expr = full
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != len(fieldBounds) {
+		return nil, errors.Errorf(
+			"Expected 5 fields in cron-expression, got %d: %s", len(fields), expr,
+		)
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		b, err := parseField(field, fieldBounds[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error parsing cron-expression: %s", expr)
+		}
+		bits[i] = b
+	}
+
+	// Sunday is both 0 and 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+		bits[4] &^= 1 << 7
+	}
+
+	return &Cron{
+		minute:        bits[0],
+		hour:          bits[1],
+		dom:           bits[2],
+		month:         bits[3],
+		dow:           bits[4],
+		domRestricted: fields[2] != "*",
+		dowRestricted: fields[4] != "*",
+	}, nil
+}
+
+// parseField returns the bitset of the values matched by the field.
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart := part
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, errors.Errorf("Invalid step in %s: %s", b.name, part)
+			}
+			rangePart = part[:i]
+		}
+
+		var low, high int
+		switch {
+		case rangePart == "*":
+			low, high = b.min, b.max
+		case strings.Contains(rangePart, "-"):
+			ends := strings.SplitN(rangePart, "-", 2)
+			var err error
+			low, err = strconv.Atoi(ends[0])
+			if err != nil {
+				return 0, errors.Errorf("Invalid range in %s: %s", b.name, part)
+			}
+			high, err = strconv.Atoi(ends[1])
+			if err != nil {
+				return 0, errors.Errorf("Invalid range in %s: %s", b.name, part)
+			}
+		default:
+			value, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, errors.Errorf("Invalid value in %s: %s", b.name, part)
+			}
+			low, high = value, value
+			// "5/15" is from 5 to the maximum, in steps of 15
+			if step > 1 {
+				high = b.max
+			}
+		}
+
+		if low < b.min || high > b.max || low > high {
+			return 0, errors.Errorf(
+				"Out of bounds %s: %s, must be within %d-%d", b.name, part, b.min, b.max,
+			)
+		}
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// maxSearchYears bounds the search for the next activation, since
+// expressions such as "0 0 30 2 *" never activate.
+const maxSearchYears = 5
+
+// Next returns the first activation strictly after t, in t's location.
+// It returns the zero time if the expression never activates.
+func (c *Cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxSearchYears, 0, 0)
+
+	for t.Before(limit) {
+		if !has(c.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !has(c.hour, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if !has(c.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	domMatch := has(c.dom, t.Day())
+	dowMatch := has(c.dow, int(t.Weekday()))
+	if c.domRestricted && c.dowRestricted {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+func has(bits uint64, value int) bool {
+	return bits&(1<<uint(value)) != 0
+}
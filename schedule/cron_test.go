@@ -0,0 +1,95 @@
+package schedule
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cron", func() {
+	// A Wednesday
+	from := time.Date(2018, 10, 17, 10, 30, 15, 0, time.UTC)
+
+	next := func(expr string, t time.Time) time.Time {
+		c, err := Parse(expr)
+		Expect(err).ToNot(HaveOccurred())
+		return c.Next(t)
+	}
+
+	It("should activate on the next matching minute", func() {
+		Expect(next("* * * * *", from)).To(Equal(
+			time.Date(2018, 10, 17, 10, 31, 0, 0, time.UTC),
+		))
+		Expect(next("*/15 * * * *", from)).To(Equal(
+			time.Date(2018, 10, 17, 10, 45, 0, 0, time.UTC),
+		))
+	})
+
+	It("should activate strictly after the given time", func() {
+		at := time.Date(2018, 10, 17, 6, 0, 0, 0, time.UTC)
+		Expect(next("0 6 * * *", at)).To(Equal(
+			time.Date(2018, 10, 18, 6, 0, 0, 0, time.UTC),
+		))
+	})
+
+	It("should roll over days, months and years", func() {
+		Expect(next("@daily", from)).To(Equal(
+			time.Date(2018, 10, 18, 0, 0, 0, 0, time.UTC),
+		))
+		Expect(next("0 9 1 * *", from)).To(Equal(
+			time.Date(2018, 11, 1, 9, 0, 0, 0, time.UTC),
+		))
+		Expect(next("30 23 31 12 *", from)).To(Equal(
+			time.Date(2018, 12, 31, 23, 30, 0, 0, time.UTC),
+		))
+		Expect(next("0 0 29 2 *", from)).To(Equal(
+			time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC),
+		))
+	})
+
+	It("should match days-of-week, with 7 as Sunday", func() {
+		Expect(next("0 8 * * 1-5", time.Date(2018, 10, 19, 9, 0, 0, 0, time.UTC))).To(Equal(
+			time.Date(2018, 10, 22, 8, 0, 0, 0, time.UTC),
+		))
+		Expect(next("0 8 * * 7", from)).To(Equal(
+			time.Date(2018, 10, 21, 8, 0, 0, 0, time.UTC),
+		))
+	})
+
+	It("should match either day-of-month or day-of-week when both are set", func() {
+		// The 1st, or any Friday
+		Expect(next("0 0 1 * 5", from)).To(Equal(
+			time.Date(2018, 10, 19, 0, 0, 0, 0, time.UTC),
+		))
+	})
+
+	It("should activate in the location of the given time", func() {
+		loc := time.FixedZone("UTC+5", 5*3600)
+		Expect(next("0 6 * * *", from.In(loc))).To(Equal(
+			time.Date(2018, 10, 18, 6, 0, 0, 0, loc),
+		))
+	})
+
+	It("should return the zero time for expressions that never activate", func() {
+		Expect(next("0 0 30 2 *", from).IsZero()).To(BeTrue())
+	})
+
+	It("should reject invalid expressions", func() {
+		for _, expr := range []string{
+			"",
+			"* * * *",
+			"60 * * * *",
+			"* 24 * * *",
+			"* * 0 * *",
+			"* * * 13 *",
+			"* * * * 8",
+			"5-1 * * * *",
+			"*/0 * * * *",
+			"a * * * *",
+		} {
+			_, err := Parse(expr)
+			Expect(err).To(HaveOccurred(), expr)
+		}
+	})
+})